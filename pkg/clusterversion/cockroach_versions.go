@@ -553,6 +553,12 @@ const (
 	// DeleteSized operations.
 	V23_2_UseSizedPebblePointTombstones
 
+	// V23_2_IndexFetchSpecIndexMetadata is the version after which all nodes can
+	// decode IndexFetchSpecs at fetchpb.IndexFetchSpecVersionIndexMetadata. Until
+	// then, the DistSQL planner downgrades the fetch specs of the processors it
+	// plans to fetchpb.IndexFetchSpecVersionInitial.
+	V23_2_IndexFetchSpecIndexMetadata
+
 	// *************************************************
 	// Step (1) Add new versions here.
 	// Do not add new versions to a patch release.
@@ -962,6 +968,10 @@ var rawVersionsSingleton = keyedVersions{
 		Key:     V23_2_UseSizedPebblePointTombstones,
 		Version: roachpb.Version{Major: 23, Minor: 1, Internal: 14},
 	},
+	{
+		Key:     V23_2_IndexFetchSpecIndexMetadata,
+		Version: roachpb.Version{Major: 23, Minor: 1, Internal: 16},
+	},
 
 	// *************************************************
 	// Step (2): Add new versions here.
@@ -164,6 +164,12 @@ func MakeSQLCodec(tenID roachpb.TenantID) SQLCodec {
 // SystemSQLCodec is a SQL key codec for the system tenant.
 var SystemSQLCodec = MakeSQLCodec(roachpb.SystemTenantID)
 
+// IsInitialized returns whether the codec was created with MakeSQLCodec. The
+// methods of the zero value of SQLCodec panic.
+func (c SQLCodec) IsInitialized() bool {
+	return c.sqlEncoder.buf != nil
+}
+
 // ForSystemTenant returns whether the encoder is bound to the system tenant.
 func (e sqlEncoder) ForSystemTenant() bool {
 	return len(e.TenantPrefix()) == 0
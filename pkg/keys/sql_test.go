@@ -45,3 +45,9 @@ func TestRewriteKeyToTenantPrefix(t *testing.T) {
 		})
 	}
 }
+
+func TestSQLCodecIsInitialized(t *testing.T) {
+	require.True(t, SystemSQLCodec.IsInitialized())
+	require.True(t, MakeSQLCodec(roachpb.MustMakeTenantID(10)).IsInitialized())
+	require.False(t, SQLCodec{}.IsInitialized())
+}
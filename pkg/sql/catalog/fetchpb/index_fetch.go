@@ -11,9 +11,21 @@
 package fetchpb
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"sort"
+	"unsafe"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/catenumpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/catid"
 	"github.com/cockroachdb/cockroach/pkg/sql/types"
 	"github.com/cockroachdb/cockroach/pkg/util/encoding"
+	"github.com/cockroachdb/cockroach/pkg/util/intsets"
+	"github.com/cockroachdb/errors"
 )
 
 // TODO(yuzefovich): consider moving this package somewhere close to rowenc
@@ -22,8 +34,31 @@ import (
 // probably make keyside and valueside not depend on sql/catalog and then pull
 // them out of the sql tree altogether.
 
-// IndexFetchSpecVersionInitial is the initial IndexFetchSpec version.
-const IndexFetchSpecVersionInitial = 1
+const (
+	// IndexFetchSpecVersionInitial is the initial IndexFetchSpec version.
+	IndexFetchSpecVersionInitial = 1
+
+	// IndexFetchSpecVersionIndexMetadata adds the metadata of the index and of
+	// the roles of its columns. It consists of the fields of IndexFetchSpec with
+	// numbers 17 to 32 and the fields of IndexFetchSpec.Column with numbers 5 to
+	// 11; all the other fields are part of IndexFetchSpecVersionInitial. The
+	// layout of a version is fixed: new fields require a new version.
+	//
+	// Nodes running a binary from before this version reject it, so it can only
+	// be sent to other nodes once clusterversion.V23_2_IndexFetchSpecIndexMetadata
+	// is active.
+	IndexFetchSpecVersionIndexMetadata = 2
+
+	// IndexFetchSpecVersionCurrent is the version of the specs produced by
+	// rowenc.InitIndexFetchSpec.
+	IndexFetchSpecVersionCurrent = IndexFetchSpecVersionIndexMetadata
+)
+
+// IsSupportedIndexFetchSpecVersion returns whether specs with the given version
+// can be decoded.
+func IsSupportedIndexFetchSpecVersion(version uint32) bool {
+	return version >= IndexFetchSpecVersionInitial && version <= IndexFetchSpecVersionCurrent
+}
 
 // KeyColumns returns the key columns in the index, excluding any key suffix
 // columns.
@@ -48,15 +83,752 @@ func (s *IndexFetchSpec) KeySuffixColumns() []IndexFetchSpec_KeyColumn {
 	return s.KeyAndSuffixColumns[len(s.KeyAndSuffixColumns)-int(s.NumKeySuffixColumns):]
 }
 
-// FetchedColumnTypes returns the types of the fetched columns in a slice.
+// PrefixKeyColumns returns a spec which only considers the first k key columns
+// of the index, for example to find the distinct key prefixes in a skip scan.
+// The returned spec has no key suffix columns and is not unique (since a prefix
+// of the key columns is not unique in general). Its fetched columns are the
+// fetched columns of s which are among the first k key columns, and since the
+// rest of the key is not decoded, every KV is treated as a separate row (see
+// SingleKVPerRow).
+//
+// The slices of the returned spec can be shared with s, in which case they
+// must not be modified in place (see Clone). An error is returned if k is not
+// positive or exceeds the number of key columns.
+func (s *IndexFetchSpec) PrefixKeyColumns(k int) (IndexFetchSpec, error) {
+	if numKeyCols := len(s.KeyColumns()); k <= 0 || k > numKeyCols {
+		return IndexFetchSpec{}, errors.AssertionFailedf(
+			"invalid number of prefix key columns %d for index %s of table %s with %d key columns",
+			k, s.IndexName, s.TableName, numKeyCols,
+		)
+	}
+	res := *s
+	res.KeyAndSuffixColumns = s.KeyAndSuffixColumns[:k:k]
+	res.NumKeySuffixColumns = 0
+	res.KeySuffixColumnIDs = nil
+	res.IsUniqueIndex = false
+	res.MaxKeysPerRow = 1
+	res.StoredColumnsByFamily = nil
+
+	var prefixCols intsets.Fast
+	for i := range res.KeyAndSuffixColumns {
+		prefixCols.Add(int(res.KeyAndSuffixColumns[i].ColumnID))
+	}
+	res.FetchedColumns = nil
+	res.ColumnToOutputIdx = nil
+	for i := range s.FetchedColumns {
+		if prefixCols.Contains(int(s.FetchedColumns[i].ColumnID)) {
+			res.FetchedColumns = append(res.FetchedColumns, s.FetchedColumns[i])
+			if s.ColumnToOutputIdx != nil {
+				res.ColumnToOutputIdx = append(res.ColumnToOutputIdx, s.ColumnToOutputIdx[i])
+			}
+		}
+	}
+	res.ExpressionColumns = nil
+	for i := range s.ExpressionColumns {
+		if prefixCols.Contains(int(s.ExpressionColumns[i].ColumnID)) {
+			res.ExpressionColumns = append(res.ExpressionColumns, s.ExpressionColumns[i])
+		}
+	}
+	return res, nil
+}
+
+// StripKeyPrefix returns the given index key without the tenant, table and
+// index prefix (the first KeyPrefixLength bytes). An error is returned if the
+// key is too short or if the prefix doesn't end with the encoded table and
+// index IDs of the spec.
+func (s *IndexFetchSpec) StripKeyPrefix(key roachpb.Key) (roachpb.Key, error) {
+	if len(key) < int(s.KeyPrefixLength) {
+		return nil, errors.AssertionFailedf(
+			"key %s is too short for index %d of table %d (expected prefix length %d)",
+			key, s.IndexID, s.TableID, s.KeyPrefixLength,
+		)
+	}
+	// The prefix contains the (variable length) tenant prefix, followed by the
+	// table ID and the index ID; we only check the latter.
+	var buf [2 * binary.MaxVarintLen64]byte
+	ids := encoding.EncodeUvarintAscending(buf[:0], uint64(s.TableID))
+	ids = encoding.EncodeUvarintAscending(ids, uint64(s.IndexID))
+	if !bytes.HasSuffix(key[:s.KeyPrefixLength], ids) {
+		return nil, errors.AssertionFailedf(
+			"key %s does not have the prefix of index %d of table %d",
+			key, s.IndexID, s.TableID,
+		)
+	}
+	return key[s.KeyPrefixLength:], nil
+}
+
+// DefaultColumnForFamily returns the default column of the given family (see
+// FamilyDefaultColumns), if the family has one.
+func (s *IndexFetchSpec) DefaultColumnForFamily(id catid.FamilyID) (catid.ColumnID, bool) {
+	cols := s.FamilyDefaultColumns
+	if s.Version < IndexFetchSpecVersionIndexMetadata {
+		// Specs of the initial version (e.g. from a node running an older binary)
+		// list the families in the order of the table descriptor.
+		for i := range cols {
+			if cols[i].FamilyID == id {
+				return cols[i].DefaultColumnID, true
+			}
+		}
+		return 0, false
+	}
+	i := sort.Search(len(cols), func(i int) bool { return cols[i].FamilyID >= id })
+	if i < len(cols) && cols[i].FamilyID == id {
+		return cols[i].DefaultColumnID, true
+	}
+	return 0, false
+}
+
+// NeededFamilyIDs returns the IDs of the column families whose KVs must be
+// read to decode the fetched columns, in increasing order. Family 0 is always
+// included, since it is the only family with a KV for every row (see
+// rowenc.NeededColumnFamilyIDs, which uses the table descriptor to omit it when
+// another needed family can't be NULL). If a system column is fetched, all the
+// families up to MaxFamilyID are needed, since the values of these columns
+// depend on all the KVs of the row.
+//
+// It requires the spec to be at IndexFetchSpecVersionIndexMetadata or later
+// (which has the FamilyID of the columns).
+func (s *IndexFetchSpec) NeededFamilyIDs() []catid.FamilyID {
+	var families intsets.Fast
+	families.Add(0)
+	for i := range s.FetchedColumns {
+		c := &s.FetchedColumns[i]
+		if c.IsSystemColumn {
+			res := make([]catid.FamilyID, s.MaxFamilyID+1)
+			for id := range res {
+				res[id] = catid.FamilyID(id)
+			}
+			return res
+		}
+		if c.InValue() {
+			families.Add(int(c.FamilyID))
+		}
+	}
+	res := make([]catid.FamilyID, 0, families.Len())
+	families.ForEach(func(id int) {
+		res = append(res, catid.FamilyID(id))
+	})
+	return res
+}
+
+// SingleKVPerRow returns true if each row of the index is encoded in a single
+// KV (see MaxKeysPerRow), for example if the table has a single column family.
+// In that case, every KV starts a new row, so the fetchers don't need to check
+// whether a KV belongs to the same row as the previous one (or, for unique
+// secondary indexes, to decode the key suffix to find out).
+func (s *IndexFetchSpec) SingleKVPerRow() bool {
+	return s.MaxKeysPerRow == 1
+}
+
+// NumFetchedKeyColumns returns the number of fetched columns that are decoded
+// from the index key alone (see KeyFullColumns); the other fetched columns are
+// decoded from the KV values (or are system or virtual columns). Note that the
+// values of composite key columns are decoded from the KV value, since the key
+// encoding doesn't contain the full value, so they are not included.
+func (s *IndexFetchSpec) NumFetchedKeyColumns() int {
+	keyCols := s.KeyFullColumns()
+	n := 0
+	for i := range s.FetchedColumns {
+		for j := range keyCols {
+			if keyCols[j].ColumnID == s.FetchedColumns[i].ColumnID {
+				if !keyCols[j].IsComposite {
+					n++
+				}
+				break
+			}
+		}
+	}
+	return n
+}
+
+// KeyColumnDirections returns the directions of the key columns in the index,
+// including the key suffix columns if they are part of the key (see
+// KeyFullColumns).
+func (s *IndexFetchSpec) KeyColumnDirections() []catenumpb.IndexColumn_Direction {
+	cols := s.KeyFullColumns()
+	res := make([]catenumpb.IndexColumn_Direction, len(cols))
+	for i := range cols {
+		res[i] = cols[i].Direction
+	}
+	return res
+}
+
+// AllAscending returns true if all the key columns in the index (including the
+// key suffix columns if they are part of the key) are ascending.
+func (s *IndexFetchSpec) AllAscending() bool {
+	cols := s.KeyFullColumns()
+	for i := range cols {
+		if cols[i].Direction != catenumpb.IndexColumn_ASC {
+			return false
+		}
+	}
+	return true
+}
+
+// AllReferencedColumnIDs returns the IDs of all the columns that the spec
+// references: the key columns and key suffix columns of the index (whether or
+// not they are fetched) and the fetched columns (including system columns).
+func (s *IndexFetchSpec) AllReferencedColumnIDs() intsets.Fast {
+	var res intsets.Fast
+	for i := range s.KeyAndSuffixColumns {
+		res.Add(int(s.KeyAndSuffixColumns[i].ColumnID))
+	}
+	for _, id := range s.KeySuffixColumnIDs {
+		res.Add(int(id))
+	}
+	for i := range s.FetchedColumns {
+		res.Add(int(s.FetchedColumns[i].ColumnID))
+	}
+	return res
+}
+
+// TypeHydrator hydrates user-defined types in place (e.g.
+// descs.DistSQLTypeResolver).
+type TypeHydrator interface {
+	HydrateTypeSlice(ctx context.Context, typs []*types.T) error
+}
+
+// HydrateTypes hydrates the user-defined types of the fetched columns and of
+// the key and suffix columns. It must be called before decoding with a spec
+// whose types might not be hydrated: a spec that was unmarshaled (e.g. on a
+// remote node), or one that was initialized from a descriptor that was not
+// hydrated (see rowenc.IndexFetchSpecOptions.AllowUnhydratedTypes).
+//
+// Note that the types of a spec initialized by rowenc.InitIndexFetchSpec are
+// shared with the table descriptor, so they are hydrated for the descriptor as
+// well.
+func (s *IndexFetchSpec) HydrateTypes(ctx context.Context, resolver TypeHydrator) error {
+	var typs []*types.T
+	for i := range s.FetchedColumns {
+		if t := s.FetchedColumns[i].Type; t.UserDefined() {
+			typs = append(typs, t)
+		}
+	}
+	for i := range s.KeyAndSuffixColumns {
+		if t := s.KeyAndSuffixColumns[i].Type; t.UserDefined() {
+			typs = append(typs, t)
+		}
+	}
+	if len(typs) == 0 {
+		return nil
+	}
+	return resolver.HydrateTypeSlice(ctx, typs)
+}
+
+// FetchedColumnTypes returns the types of the fetched columns in a slice. For
+// the inverted column of an inverted index, this is the type of the inverted
+// key (see IndexFetchSpec_Column.Type).
 func (s *IndexFetchSpec) FetchedColumnTypes() []*types.T {
-	res := make([]*types.T, len(s.FetchedColumns))
-	for i := range res {
-		res[i] = s.FetchedColumns[i].Type
+	return s.AppendFetchedColumnTypes(make([]*types.T, 0, len(s.FetchedColumns)))
+}
+
+// AppendFetchedColumnTypes is a variant of FetchedColumnTypes which appends the
+// types to the given slice. It can be used to reuse a slice across scans:
+//
+//	typs = spec.AppendFetchedColumnTypes(typs[:0])
+func (s *IndexFetchSpec) AppendFetchedColumnTypes(appendTo []*types.T) []*types.T {
+	for i := range s.FetchedColumns {
+		appendTo = append(appendTo, s.FetchedColumns[i].Type)
+	}
+	return appendTo
+}
+
+// ProjectionTo returns the ordinals in FetchedColumns of the given columns, in
+// the order of colIDs, which can be used to project the decoded rows onto these
+// columns. A column can be requested more than once. It is an error if one of
+// the columns is not fetched.
+func (s *IndexFetchSpec) ProjectionTo(colIDs []catid.ColumnID) ([]int, error) {
+	res := make([]int, len(colIDs))
+	for i, colID := range colIDs {
+		res[i] = -1
+		for j := range s.FetchedColumns {
+			if s.FetchedColumns[j].ColumnID == colID {
+				res[i] = j
+				break
+			}
+		}
+		if res[i] == -1 {
+			return nil, errors.AssertionFailedf(
+				"column %d is not fetched from index %s of table %s", colID, s.IndexName, s.TableName,
+			)
+		}
+	}
+	return res, nil
+}
+
+// Clone returns a copy of the spec which can be modified (or used by another
+// goroutine) without affecting s. In particular, the slices are copied, so the
+// spec returned by the Init functions in rowenc (which shares some slices with
+// the table descriptor) can be safely modified through the copy.
+//
+// User-defined types (including array and tuple types which contain them) are
+// copied as well, since their metadata is hydrated in place (see
+// typedesc.EnsureTypeIsHydrated). Built-in types are immutable and are shared,
+// as is the GeoConfig.
+func (s *IndexFetchSpec) Clone() *IndexFetchSpec {
+	c := *s
+	cloned := make(map[*types.T]*types.T)
+	c.PredicateColumnIDs = cloneSlice(s.PredicateColumnIDs)
+	c.PredicateTypeIDs = cloneSlice(s.PredicateTypeIDs)
+	c.KeySuffixColumnIDs = cloneSlice(s.KeySuffixColumnIDs)
+	c.FamilyDefaultColumns = cloneSlice(s.FamilyDefaultColumns)
+	c.KeyAndSuffixColumns = cloneSlice(s.KeyAndSuffixColumns)
+	for i := range c.KeyAndSuffixColumns {
+		c.KeyAndSuffixColumns[i].Type = cloneType(c.KeyAndSuffixColumns[i].Type, cloned)
+	}
+	c.FetchedColumns = cloneSlice(s.FetchedColumns)
+	for i := range c.FetchedColumns {
+		c.FetchedColumns[i].Type = cloneType(c.FetchedColumns[i].Type, cloned)
+	}
+	c.VirtualColumnDependencyIDs = cloneSlice(s.VirtualColumnDependencyIDs)
+	c.StoredColumnsByFamily = cloneSlice(s.StoredColumnsByFamily)
+	for i := range c.StoredColumnsByFamily {
+		c.StoredColumnsByFamily[i].StoredColumnIDs = cloneSlice(c.StoredColumnsByFamily[i].StoredColumnIDs)
+	}
+	c.ExpressionColumns = cloneSlice(s.ExpressionColumns)
+	for i := range c.ExpressionColumns {
+		c.ExpressionColumns[i].ReferencedColumnIDs = cloneSlice(c.ExpressionColumns[i].ReferencedColumnIDs)
+	}
+	c.ColumnToOutputIdx = cloneSlice(s.ColumnToOutputIdx)
+	c.PartitioningColumnIDs = cloneSlice(s.PartitioningColumnIDs)
+	return &c
+}
+
+// cloneSlice returns a copy of the given slice; a nil slice stays nil.
+func cloneSlice[T any](s []T) []T {
+	if s == nil {
+		return nil
+	}
+	return append(make([]T, 0, len(s)), s...)
+}
+
+// cloneType returns a copy of t if it is (or contains) a user-defined type, and
+// t itself otherwise. The cloned map is used to preserve the sharing of types
+// within the spec (the same type is usually referenced both by a key column
+// and a fetched column).
+func cloneType(t *types.T, cloned map[*types.T]*types.T) *types.T {
+	if t == nil {
+		return nil
 	}
+	if c, ok := cloned[t]; ok {
+		return c
+	}
+	res := t
+	switch t.Family() {
+	case types.ArrayFamily:
+		if contents := cloneType(t.ArrayContents(), cloned); contents != t.ArrayContents() || t.UserDefined() {
+			c := *t
+			c.InternalType.ArrayContents = contents
+			res = &c
+		}
+	case types.TupleFamily:
+		changed := false
+		contents := make([]*types.T, len(t.TupleContents()))
+		for i, e := range t.TupleContents() {
+			contents[i] = cloneType(e, cloned)
+			changed = changed || contents[i] != e
+		}
+		if changed || t.UserDefined() {
+			c := *t
+			c.InternalType.TupleContents = contents
+			res = &c
+		}
+	default:
+		if t.UserDefined() {
+			c := *t
+			res = &c
+		}
+	}
+	cloned[t] = res
 	return res
 }
 
+// Equal returns true if the two specs have the same contents. Unlike
+// reflect.DeepEqual, it compares types by value (using types.T.Equivalent)
+// instead of by pointer, and it only compares the elements of the slices: the
+// capacity of a slice doesn't matter, nor whether it is shared with a table
+// descriptor or with another spec, and a nil slice is equal to an empty one.
+// In particular, a spec is equal to its Clone and to another spec initialized
+// for the same index and columns. Note that types which only differ in width
+// or precision are equivalent.
+func (s *IndexFetchSpec) Equal(other *IndexFetchSpec) bool {
+	if s == other {
+		return true
+	}
+	if s == nil || other == nil {
+		return false
+	}
+	if s.Version != other.Version ||
+		s.TableID != other.TableID ||
+		s.TableName != other.TableName ||
+		s.IndexID != other.IndexID ||
+		s.IndexName != other.IndexName ||
+		s.IsSecondaryIndex != other.IsSecondaryIndex ||
+		s.IsUniqueIndex != other.IsUniqueIndex ||
+		s.IsPartial != other.IsPartial ||
+		s.ShardColumnID != other.ShardColumnID ||
+		s.ShardBucketCount != other.ShardBucketCount ||
+		s.RegionColumnID != other.RegionColumnID ||
+		s.TTLExpirationColumnID != other.TTLExpirationColumnID ||
+		s.EncodingType != other.EncodingType ||
+		s.IndexVersion != other.IndexVersion ||
+		s.IsTemporaryIndex != other.IsTemporaryIndex ||
+		s.Invisibility != other.Invisibility ||
+		s.NumKeySuffixColumns != other.NumKeySuffixColumns ||
+		s.MaxKeysPerRow != other.MaxKeysPerRow ||
+		s.KeyPrefixLength != other.KeyPrefixLength ||
+		s.MaxFamilyID != other.MaxFamilyID {
+		return false
+	}
+	if !s.GeoConfig.Equal(&other.GeoConfig) ||
+		!slicesEqual(s.PredicateColumnIDs, other.PredicateColumnIDs) ||
+		!slicesEqual(s.PredicateTypeIDs, other.PredicateTypeIDs) ||
+		!slicesEqual(s.PartitioningColumnIDs, other.PartitioningColumnIDs) ||
+		!slicesEqual(s.KeySuffixColumnIDs, other.KeySuffixColumnIDs) ||
+		!slicesEqual(s.FamilyDefaultColumns, other.FamilyDefaultColumns) ||
+		!slicesEqual(s.VirtualColumnDependencyIDs, other.VirtualColumnDependencyIDs) ||
+		!slicesEqual(s.ColumnToOutputIdx, other.ColumnToOutputIdx) {
+		return false
+	}
+	if len(s.KeyAndSuffixColumns) != len(other.KeyAndSuffixColumns) {
+		return false
+	}
+	for i := range s.KeyAndSuffixColumns {
+		a, b := s.KeyAndSuffixColumns[i], other.KeyAndSuffixColumns[i]
+		if !typesEqual(a.Type, b.Type) {
+			return false
+		}
+		a.Type, b.Type = nil, nil
+		if a != b {
+			return false
+		}
+	}
+	if len(s.FetchedColumns) != len(other.FetchedColumns) {
+		return false
+	}
+	for i := range s.FetchedColumns {
+		a, b := s.FetchedColumns[i], other.FetchedColumns[i]
+		if !typesEqual(a.Type, b.Type) {
+			return false
+		}
+		a.Type, b.Type = nil, nil
+		if a != b {
+			return false
+		}
+	}
+	if len(s.StoredColumnsByFamily) != len(other.StoredColumnsByFamily) {
+		return false
+	}
+	for i := range s.StoredColumnsByFamily {
+		a, b := &s.StoredColumnsByFamily[i], &other.StoredColumnsByFamily[i]
+		if a.FamilyID != b.FamilyID || !slicesEqual(a.StoredColumnIDs, b.StoredColumnIDs) {
+			return false
+		}
+	}
+	if len(s.ExpressionColumns) != len(other.ExpressionColumns) {
+		return false
+	}
+	for i := range s.ExpressionColumns {
+		a, b := &s.ExpressionColumns[i], &other.ExpressionColumns[i]
+		if a.ColumnID != b.ColumnID || a.Expr != b.Expr ||
+			!slicesEqual(a.ReferencedColumnIDs, b.ReferencedColumnIDs) {
+			return false
+		}
+	}
+	return true
+}
+
+// slicesEqual returns true if the two slices have the same elements (a nil
+// slice is equal to an empty one).
+func slicesEqual[T comparable](a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// typesEqual returns true if the two types are equivalent (or both nil).
+func typesEqual(a, b *types.T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equivalent(b)
+}
+
+// Fingerprint returns a hash of the fields of the spec which affect decoding:
+// the table and index IDs, the index encoding, and the IDs and types of the key
+// and fetched columns (along with the key column directions). Names are not
+// included, so renaming the table, the index or a column doesn't change the
+// fingerprint. Specs which are compatible according to
+// rowenc.IndexFetchSpecsCompatible have the same fingerprint.
+func (s *IndexFetchSpec) Fingerprint() uint64 {
+	f := fingerprinter{h: fnv.New64a()}
+	f.add(uint64(s.Version))
+	f.add(uint64(s.TableID))
+	f.add(uint64(s.IndexID))
+	f.addBool(s.IsSecondaryIndex)
+	f.addBool(s.IsUniqueIndex)
+	f.add(uint64(s.EncodingType))
+	f.addBool(s.IsTemporaryIndex)
+	f.add(uint64(s.NumKeySuffixColumns))
+	f.add(uint64(s.MaxKeysPerRow))
+	f.add(uint64(s.MaxFamilyID))
+	f.add(uint64(len(s.FamilyDefaultColumns)))
+	for i := range s.FamilyDefaultColumns {
+		f.add(uint64(s.FamilyDefaultColumns[i].FamilyID))
+		f.add(uint64(s.FamilyDefaultColumns[i].DefaultColumnID))
+	}
+	f.add(uint64(len(s.KeyAndSuffixColumns)))
+	for i := range s.KeyAndSuffixColumns {
+		c := &s.KeyAndSuffixColumns[i]
+		f.add(uint64(c.ColumnID))
+		f.addType(c.Type)
+		f.add(uint64(c.Direction))
+		f.addBool(c.IsComposite)
+		f.addBool(c.IsInverted)
+	}
+	f.add(uint64(len(s.FetchedColumns)))
+	for i := range s.FetchedColumns {
+		f.add(uint64(s.FetchedColumns[i].ColumnID))
+		f.addType(s.FetchedColumns[i].Type)
+	}
+	return f.h.Sum64()
+}
+
+type fingerprinter struct {
+	h   hash.Hash64
+	buf [8]byte
+}
+
+func (f *fingerprinter) add(v uint64) {
+	binary.LittleEndian.PutUint64(f.buf[:], v)
+	_, _ = f.h.Write(f.buf[:])
+}
+
+func (f *fingerprinter) addBool(b bool) {
+	if b {
+		f.add(1)
+	} else {
+		f.add(0)
+	}
+}
+
+// addType adds the parts of the type which determine how values are encoded;
+// identical types have the same fingerprint.
+func (f *fingerprinter) addType(t *types.T) {
+	if t == nil {
+		f.add(0)
+		return
+	}
+	f.add(uint64(t.Oid()))
+	f.add(uint64(t.Width()))
+	f.add(uint64(t.Precision()))
+	f.add(uint64(len(t.Locale())))
+	_, _ = f.h.Write([]byte(t.Locale()))
+	switch t.Family() {
+	case types.ArrayFamily:
+		f.addType(t.ArrayContents())
+	case types.TupleFamily:
+		f.add(uint64(len(t.TupleContents())))
+		for _, elem := range t.TupleContents() {
+			f.addType(elem)
+		}
+	}
+}
+
+const (
+	sizeOfIndexFetchSpec      = int64(unsafe.Sizeof(IndexFetchSpec{}))
+	sizeOfColumn              = int64(unsafe.Sizeof(IndexFetchSpec_Column{}))
+	sizeOfKeyColumn           = int64(unsafe.Sizeof(IndexFetchSpec_KeyColumn{}))
+	sizeOfFamilyDefaultColumn = int64(unsafe.Sizeof(IndexFetchSpec_FamilyDefaultColumn{}))
+	sizeOfFamilyStoredColumns = int64(unsafe.Sizeof(IndexFetchSpec_FamilyStoredColumns{}))
+	sizeOfExpressionColumn    = int64(unsafe.Sizeof(IndexFetchSpec_ExpressionColumn{}))
+	sizeOfColumnID            = int64(unsafe.Sizeof(catid.ColumnID(0)))
+	sizeOfDescID              = int64(unsafe.Sizeof(catid.DescID(0)))
+	sizeOfType                = int64(unsafe.Sizeof(types.T{}))
+	sizeOfTypePointer         = int64(unsafe.Sizeof((*types.T)(nil)))
+)
+
+// SerializedSize returns the size of the spec once it is marshaled (e.g. as
+// part of a DistSQL flow sent to a remote node), in bytes, without marshaling
+// it. Unlike EstimatedMemoryUsage, it is exact. Note that its cost is
+// proportional to the size of the spec, since the sizes of the nested messages
+// (in particular the types) are computed as well.
+func (s *IndexFetchSpec) SerializedSize() int {
+	return s.Size()
+}
+
+// EstimatedMemoryUsage returns an estimate of the memory used by the spec, in
+// bytes, intended for memory accounting. It includes the backing arrays of all
+// the slices and the column names and types. Types that are shared between
+// columns are only accounted once.
+//
+// Note that KeyAndSuffixColumns and FamilyDefaultColumns are usually shared
+// with the table descriptor (see rowenc.InitIndexFetchSpec), so the estimate
+// can overcount the memory that is held exclusively by the spec.
+func (s *IndexFetchSpec) EstimatedMemoryUsage() int64 {
+	usage := sizeOfIndexFetchSpec + int64(len(s.TableName)+len(s.IndexName))
+	seenTypes := make(map[*types.T]struct{})
+	columnUsage := func(c *IndexFetchSpec_Column) int64 {
+		return int64(len(c.Name)) + typeMemoryUsage(c.Type, seenTypes)
+	}
+	usage += int64(cap(s.KeyAndSuffixColumns)) * sizeOfKeyColumn
+	for i := range s.KeyAndSuffixColumns {
+		usage += columnUsage(&s.KeyAndSuffixColumns[i].IndexFetchSpec_Column)
+	}
+	usage += int64(cap(s.FetchedColumns)) * sizeOfColumn
+	for i := range s.FetchedColumns {
+		usage += columnUsage(&s.FetchedColumns[i])
+	}
+	usage += int64(cap(s.FamilyDefaultColumns)) * sizeOfFamilyDefaultColumn
+	usage += int64(cap(s.StoredColumnsByFamily)) * sizeOfFamilyStoredColumns
+	for i := range s.StoredColumnsByFamily {
+		usage += int64(cap(s.StoredColumnsByFamily[i].StoredColumnIDs)) * sizeOfColumnID
+	}
+	usage += int64(cap(s.ExpressionColumns)) * sizeOfExpressionColumn
+	for i := range s.ExpressionColumns {
+		e := &s.ExpressionColumns[i]
+		usage += int64(len(e.Expr)) + int64(cap(e.ReferencedColumnIDs))*sizeOfColumnID
+	}
+	usage += int64(cap(s.KeySuffixColumnIDs)) * sizeOfColumnID
+	usage += int64(cap(s.VirtualColumnDependencyIDs)+cap(s.PredicateColumnIDs)) * sizeOfColumnID
+	usage += int64(cap(s.PartitioningColumnIDs)) * sizeOfColumnID
+	usage += int64(cap(s.PredicateTypeIDs)) * sizeOfDescID
+	return usage
+}
+
+// typeMemoryUsage returns an estimate of the memory used by the given type,
+// including any element types, or zero if the type was already accounted for.
+func typeMemoryUsage(t *types.T, seen map[*types.T]struct{}) int64 {
+	if t == nil {
+		return 0
+	}
+	if _, ok := seen[t]; ok {
+		return 0
+	}
+	seen[t] = struct{}{}
+	usage := sizeOfType + int64(len(t.Locale()))
+	switch t.Family() {
+	case types.ArrayFamily:
+		usage += typeMemoryUsage(t.ArrayContents(), seen)
+	case types.TupleFamily:
+		contents := t.TupleContents()
+		usage += int64(cap(contents)) * sizeOfTypePointer
+		for _, c := range contents {
+			usage += typeMemoryUsage(c, seen)
+		}
+		for _, label := range t.TupleLabels() {
+			usage += int64(len(label))
+		}
+	}
+	return usage
+}
+
+// EstimatedRowSize returns a rough estimate of the encoded size of the values
+// of the fetched columns of a row, in bytes, for use in cost models. It uses
+// the typical encoded size of each type (which is fixed for most types, and an
+// average for variable length types like strings and JSON); the actual values
+// are not taken into account.
+func (s *IndexFetchSpec) EstimatedRowSize() int64 {
+	var size int64
+	for i := range s.FetchedColumns {
+		size += estimatedEncodedSize(s.FetchedColumns[i].Type)
+	}
+	return size
+}
+
+const (
+	// estimatedVarLengthSize is the estimated size of a value of variable
+	// length (e.g. a string) without a maximum width.
+	estimatedVarLengthSize = 32
+	// estimatedJSONSize is the estimated size of a JSON value, as well as of
+	// the (also variable length) spatial and text search values.
+	estimatedJSONSize = 64
+	// estimatedArrayLength is the estimated number of elements of an array.
+	estimatedArrayLength = 4
+	// estimatedDefaultSize is the estimated size of values of other types.
+	estimatedDefaultSize = 16
+)
+
+// estimatedEncodedSize returns the typical encoded size of a value of the given
+// type (see EstimatedRowSize).
+func estimatedEncodedSize(t *types.T) int64 {
+	if t == nil {
+		return estimatedDefaultSize
+	}
+	switch t.Family() {
+	case types.BoolFamily:
+		return 1
+	case types.IntFamily:
+		if w := t.Width(); w > 0 {
+			return int64(w / 8)
+		}
+		return 8
+	case types.OidFamily:
+		return 4
+	case types.FloatFamily, types.DateFamily, types.TimeFamily, types.PGLSNFamily,
+		types.EnumFamily:
+		return 8
+	case types.TimestampFamily, types.TimestampTZFamily, types.TimeTZFamily, types.DecimalFamily:
+		return 12
+	case types.UuidFamily, types.IntervalFamily:
+		return 16
+	case types.INetFamily:
+		return 17
+	case types.Box2DFamily:
+		return 32
+	case types.BitFamily:
+		if w := t.Width(); w > 0 {
+			return int64(w+7) / 8
+		}
+		return 8
+	case types.StringFamily, types.CollatedStringFamily, types.BytesFamily:
+		// Width (for VARCHAR(n) and CHAR(n)) is a number of characters, which
+		// are usually encoded in a single byte each.
+		if w := t.Width(); w > 0 && w < estimatedVarLengthSize {
+			return int64(w)
+		}
+		return estimatedVarLengthSize
+	case types.JsonFamily, types.GeographyFamily, types.GeometryFamily, types.TSVectorFamily,
+		types.TSQueryFamily:
+		return estimatedJSONSize
+	case types.ArrayFamily:
+		return estimatedArrayLength * estimatedEncodedSize(t.ArrayContents())
+	case types.TupleFamily:
+		var size int64
+		for _, elem := range t.TupleContents() {
+			size += estimatedEncodedSize(elem)
+		}
+		return size
+	default:
+		return estimatedDefaultSize
+	}
+}
+
+// InKey returns true if the fetched column is encoded in the index key, i.e. it
+// is a key column or a key suffix column (see Role). Note that the key suffix
+// columns of a unique secondary index are only encoded in the key if one of
+// the key columns is NULL, and in the value otherwise (see IsExtraKeyColumn).
+//
+// Both InKey and InValue are false for columns of specs at the initial version,
+// which don't have column roles.
+func (c *IndexFetchSpec_Column) InKey() bool {
+	return c.Role == IndexFetchSpec_KEY || c.Role == IndexFetchSpec_KEY_SUFFIX
+}
+
+// InValue returns true if the fetched column is encoded in the value of the
+// index KVs: stored columns, as well as composite key columns (which are
+// encoded in both the key and the value, the latter being authoritative; see
+// IsCompositeKeyColumn).
+func (c *IndexFetchSpec_Column) InValue() bool {
+	return c.Role == IndexFetchSpec_STORED || c.IsCompositeKeyColumn
+}
+
 // DatumEncoding returns the datum encoding that corresponds to the key column
 // direction.
 func (c *IndexFetchSpec_KeyColumn) DatumEncoding() catenumpb.DatumEncoding {
@@ -73,3 +845,12 @@ func (c *IndexFetchSpec_KeyColumn) EncodingDirection() encoding.Direction {
 	}
 	return encoding.Ascending
 }
+
+// NullsLast returns true if NULL values of the key column sort after all other
+// values in the index. Indexes only support the null ordering implied by the
+// direction (NULLS FIRST for ascending columns and NULLS LAST for descending
+// columns), so this is derived from Direction: NULL is encoded as the smallest
+// key in the ascending encoding and as the largest in the descending one.
+func (c *IndexFetchSpec_KeyColumn) NullsLast() bool {
+	return c.Direction == catenumpb.IndexColumn_DESC
+}
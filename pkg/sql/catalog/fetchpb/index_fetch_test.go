@@ -0,0 +1,850 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package fetchpb_test
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/geo/geoindex"
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/catenumpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/fetchpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/catid"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/util/encoding"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/stretchr/testify/require"
+)
+
+// The tests in this file use specs built by hand, which only set the fields
+// that the tested method looks at. The specs produced by rowenc.InitIndexFetchSpec
+// for actual indexes are tested in rowenc (see testdata/index-fetch).
+
+// fetchedColumns returns fetched columns with the given types, with IDs
+// starting at 1 and names c1, c2, etc. The capacity of the slice is its length.
+func fetchedColumns(typs ...*types.T) []fetchpb.IndexFetchSpec_Column {
+	cols := make([]fetchpb.IndexFetchSpec_Column, len(typs))
+	for i, typ := range typs {
+		cols[i] = fetchpb.IndexFetchSpec_Column{
+			ColumnID: catid.ColumnID(i + 1),
+			Name:     fmt.Sprintf("c%d", i+1),
+			Type:     typ,
+		}
+	}
+	return cols
+}
+
+// keyColumns returns key and key suffix columns with the given directions. They
+// have type INT, and IDs starting at 1 and names c1, c2, etc, like the columns
+// returned by fetchedColumns.
+func keyColumns(directions ...catenumpb.IndexColumn_Direction) []fetchpb.IndexFetchSpec_KeyColumn {
+	cols := make([]fetchpb.IndexFetchSpec_KeyColumn, len(directions))
+	for i, dir := range directions {
+		cols[i] = fetchpb.IndexFetchSpec_KeyColumn{
+			IndexFetchSpec_Column: fetchpb.IndexFetchSpec_Column{
+				ColumnID: catid.ColumnID(i + 1),
+				Name:     fmt.Sprintf("c%d", i+1),
+				Type:     types.Int,
+			},
+			Direction: dir,
+		}
+	}
+	return cols
+}
+
+func TestIndexFetchSpecEstimatedMemoryUsage(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	usage := func(numColumns int) int64 {
+		typs := make([]*types.T, numColumns)
+		for i := range typs {
+			typs[i] = types.String
+		}
+		spec := fetchpb.IndexFetchSpec{
+			TableName:      "t",
+			IndexName:      "t_pkey",
+			FetchedColumns: fetchedColumns(typs...),
+		}
+		return spec.EstimatedMemoryUsage()
+	}
+	u10, u20, u40 := usage(10), usage(20), usage(40)
+	require.Less(t, u10, u20)
+	require.Less(t, u20, u40)
+	// The names of the columns after c9 all have the same length, so the estimate
+	// grows linearly with the number of columns (the type of all the columns is
+	// shared, so it is only accounted once).
+	require.Equal(t, 2*(u20-u10), u40-u20)
+
+	// Distinct types are accounted separately, but the same type is only
+	// accounted once.
+	intCopy := *types.Int
+	shared := fetchpb.IndexFetchSpec{FetchedColumns: fetchedColumns(types.Int, types.Int)}
+	distinct := fetchpb.IndexFetchSpec{FetchedColumns: fetchedColumns(types.Int, &intCopy)}
+	require.Less(t, shared.EstimatedMemoryUsage(), distinct.EstimatedMemoryUsage())
+
+	// The backing arrays are accounted for, including their unused capacity.
+	spec := fetchpb.IndexFetchSpec{FetchedColumns: fetchedColumns(types.Int)}
+	before := spec.EstimatedMemoryUsage()
+	spec.FetchedColumns = append(make([]fetchpb.IndexFetchSpec_Column, 0, 10), spec.FetchedColumns...)
+	withCapacity := spec.EstimatedMemoryUsage()
+	require.Less(t, before, withCapacity)
+	spec.KeySuffixColumnIDs = make([]catid.ColumnID, 0, 10)
+	require.Less(t, withCapacity, spec.EstimatedMemoryUsage())
+}
+
+func TestIndexFetchSpecKeyColumnDirections(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	type directions = []catenumpb.IndexColumn_Direction
+	const (
+		asc  = catenumpb.IndexColumn_ASC
+		desc = catenumpb.IndexColumn_DESC
+	)
+	for _, tc := range []struct {
+		name         string
+		key, suffix  directions
+		unique       bool
+		expected     directions
+		allAscending bool
+	}{
+		{name: "ascending", key: directions{asc}, expected: directions{asc}, allAscending: true},
+		{
+			name: "suffix", key: directions{asc, asc}, suffix: directions{asc},
+			expected: directions{asc, asc, asc}, allAscending: true,
+		},
+		{
+			name: "descending key", key: directions{desc, asc}, suffix: directions{asc},
+			expected: directions{desc, asc, asc},
+		},
+		{
+			name: "descending suffix", key: directions{asc}, suffix: directions{desc},
+			expected: directions{asc, desc},
+		},
+		// The suffix columns of a unique index are not part of the key.
+		{
+			name: "unique", key: directions{asc}, suffix: directions{desc}, unique: true,
+			expected: directions{asc}, allAscending: true,
+		},
+		{name: "no key columns", expected: directions{}, allAscending: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := fetchpb.IndexFetchSpec{
+				KeyAndSuffixColumns: keyColumns(append(append(directions(nil), tc.key...), tc.suffix...)...),
+				NumKeySuffixColumns: uint32(len(tc.suffix)),
+				IsUniqueIndex:       tc.unique,
+			}
+			require.Equal(t, tc.expected, spec.KeyColumnDirections())
+			require.Equal(t, tc.allAscending, spec.AllAscending())
+		})
+	}
+}
+
+func TestIndexFetchSpecFetchedColumnTypes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	spec := fetchpb.IndexFetchSpec{FetchedColumns: fetchedColumns(types.Jsonb, types.Int, types.String)}
+	requireTypes := func(expected, actual []*types.T) {
+		t.Helper()
+		require.Len(t, actual, len(expected))
+		for i := range expected {
+			require.Same(t, expected[i], actual[i], "column %d", i)
+		}
+	}
+	expected := []*types.T{types.Jsonb, types.Int, types.String}
+	requireTypes(expected, spec.FetchedColumnTypes())
+	typs := spec.AppendFetchedColumnTypes(nil)
+	requireTypes(expected, typs)
+
+	// The types are appended to the given slice, which is reused if it has
+	// enough capacity.
+	spec.FetchedColumns = fetchedColumns(types.Int, types.EncodedKey)
+	reused := spec.AppendFetchedColumnTypes(typs[:0])
+	requireTypes([]*types.T{types.Int, types.EncodedKey}, reused)
+	require.Same(t, &typs[0], &reused[0])
+	requireTypes([]*types.T{types.Int, types.EncodedKey, types.Int, types.EncodedKey},
+		spec.AppendFetchedColumnTypes(reused))
+
+	spec.FetchedColumns = nil
+	require.Empty(t, spec.FetchedColumnTypes())
+}
+
+func BenchmarkIndexFetchSpecFetchedColumnTypes(b *testing.B) {
+	colTypes := make([]*types.T, 10)
+	for i := range colTypes {
+		colTypes[i] = types.Int
+	}
+	spec := fetchpb.IndexFetchSpec{FetchedColumns: fetchedColumns(colTypes...)}
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = spec.FetchedColumnTypes()
+		}
+	})
+	b.Run("reuse", func(b *testing.B) {
+		var typs []*types.T
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			typs = spec.AppendFetchedColumnTypes(typs[:0])
+		}
+	})
+}
+
+func TestIndexFetchSpecNumFetchedKeyColumns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	// The index has the key columns c1 and c2 (which is composite), and the key
+	// suffix column c3. The column c4 is stored.
+	asc := catenumpb.IndexColumn_ASC
+	keyCols := keyColumns(asc, asc, asc)
+	keyCols[1].Type, keyCols[1].IsComposite = types.Decimal, true
+	for _, tc := range []struct {
+		fetched  []int
+		unique   bool
+		expected int
+	}{
+		// The value of the composite key column is decoded from the KV value.
+		{fetched: []int{1, 2, 3, 4}, expected: 2},
+		{fetched: []int{4, 3}, expected: 1},
+		// The key suffix column of a unique index is encoded in the value (unless
+		// one of the key columns is NULL).
+		{fetched: []int{1, 2, 3, 4}, unique: true, expected: 1},
+		{fetched: []int{2, 4}, expected: 0},
+		{fetched: nil, expected: 0},
+	} {
+		allCols := fetchedColumns(types.Int, types.Decimal, types.Int, types.Int)
+		var fetchedCols []fetchpb.IndexFetchSpec_Column
+		for _, id := range tc.fetched {
+			fetchedCols = append(fetchedCols, allCols[id-1])
+		}
+		spec := fetchpb.IndexFetchSpec{
+			KeyAndSuffixColumns: keyCols,
+			NumKeySuffixColumns: 1,
+			IsUniqueIndex:       tc.unique,
+			FetchedColumns:      fetchedCols,
+		}
+		require.Equal(t, tc.expected, spec.NumFetchedKeyColumns(), "%v unique=%t", tc.fetched, tc.unique)
+	}
+}
+
+func TestIndexFetchSpecStripKeyPrefix(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	const tableID, indexID = 104, 2
+	tenantCodec := keys.MakeSQLCodec(roachpb.MustMakeTenantID(10))
+	for _, codec := range []keys.SQLCodec{keys.SystemSQLCodec, tenantCodec} {
+		prefix := codec.IndexPrefix(tableID, indexID)
+		spec := fetchpb.IndexFetchSpec{
+			TableID:         tableID,
+			IndexID:         indexID,
+			KeyPrefixLength: uint32(len(prefix)),
+		}
+
+		suffix := encoding.EncodeVarintAscending(encoding.EncodeVarintAscending(nil, 2), 1)
+		key := append(prefix.Clone(), suffix...)
+		stripped, err := spec.StripKeyPrefix(key)
+		require.NoError(t, err)
+		require.Equal(t, roachpb.Key(suffix), stripped)
+
+		// A key with only the prefix strips to an empty key.
+		stripped, err = spec.StripKeyPrefix(prefix)
+		require.NoError(t, err)
+		require.Empty(t, stripped)
+
+		// A truncated key results in an error.
+		_, err = spec.StripKeyPrefix(key[:len(prefix)-1])
+		require.ErrorContains(t, err, "is too short")
+
+		// A key of another index or table (with a prefix of the same length)
+		// results in an error.
+		otherPrefixes := []roachpb.Key{codec.IndexPrefix(tableID, 1), codec.IndexPrefix(tableID+1, indexID)}
+		for _, other := range otherPrefixes {
+			require.Len(t, other, len(prefix))
+			_, err = spec.StripKeyPrefix(append(other, suffix...))
+			require.ErrorContains(t, err, "does not have the prefix")
+		}
+	}
+}
+
+func TestIndexFetchSpecFingerprint(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	// makeSpec returns a spec for a secondary index of the table t with columns
+	// c1 INT (the primary key), c2 INT and c3 STRING. The index has the key
+	// column c2 (descending) and the key suffix column c1, and it stores c3.
+	makeSpec := func(fetched ...int) *fetchpb.IndexFetchSpec {
+		allCols := fetchedColumns(types.Int, types.Int, types.String)
+		spec := &fetchpb.IndexFetchSpec{
+			Version:          fetchpb.IndexFetchSpecVersionCurrent,
+			TableID:          104,
+			TableName:        "t",
+			IndexID:          2,
+			IndexName:        "c2_idx",
+			IsSecondaryIndex: true,
+			KeyAndSuffixColumns: []fetchpb.IndexFetchSpec_KeyColumn{
+				{IndexFetchSpec_Column: allCols[1], Direction: catenumpb.IndexColumn_DESC},
+				{IndexFetchSpec_Column: allCols[0], Direction: catenumpb.IndexColumn_ASC},
+			},
+			NumKeySuffixColumns: 1,
+			MaxKeysPerRow:       1,
+		}
+		for _, id := range fetched {
+			spec.FetchedColumns = append(spec.FetchedColumns, allCols[id-1])
+		}
+		return spec
+	}
+	orig := makeSpec(1, 2, 3).Fingerprint()
+	require.Equal(t, orig, makeSpec(1, 2, 3).Fingerprint())
+	require.NotEqual(t, orig, makeSpec(1, 2).Fingerprint())
+	require.NotEqual(t, orig, makeSpec(2, 1, 3).Fingerprint())
+
+	for _, tc := range []struct {
+		name    string
+		modify  func(s *fetchpb.IndexFetchSpec)
+		changed bool
+	}{
+		{name: "index", modify: func(s *fetchpb.IndexFetchSpec) { s.IndexID = 1 }, changed: true},
+		{
+			name:    "column type",
+			modify:  func(s *fetchpb.IndexFetchSpec) { s.FetchedColumns[1].Type = types.Int4 },
+			changed: true,
+		},
+		{
+			name:    "key column type",
+			modify:  func(s *fetchpb.IndexFetchSpec) { s.KeyAndSuffixColumns[0].Type = types.Int4 },
+			changed: true,
+		},
+		{
+			name: "collation",
+			modify: func(s *fetchpb.IndexFetchSpec) {
+				s.FetchedColumns[2].Type = types.MakeCollatedString(types.String, "en")
+			},
+			changed: true,
+		},
+		{
+			name: "key column direction",
+			modify: func(s *fetchpb.IndexFetchSpec) {
+				s.KeyAndSuffixColumns[0].Direction = catenumpb.IndexColumn_ASC
+			},
+			changed: true,
+		},
+		{
+			name:    "max keys per row",
+			modify:  func(s *fetchpb.IndexFetchSpec) { s.MaxKeysPerRow = 2 },
+			changed: true,
+		},
+		// Renames don't change the fingerprint.
+		{name: "table name", modify: func(s *fetchpb.IndexFetchSpec) { s.TableName = "t2" }},
+		{name: "index name", modify: func(s *fetchpb.IndexFetchSpec) { s.IndexName = "c2_idx2" }},
+		{
+			name: "column name",
+			modify: func(s *fetchpb.IndexFetchSpec) {
+				s.KeyAndSuffixColumns[0].Name = "c4"
+				s.FetchedColumns[1].Name = "c4"
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := makeSpec(1, 2, 3)
+			tc.modify(spec)
+			require.Equal(t, tc.changed, orig != spec.Fingerprint())
+		})
+	}
+}
+
+func TestIndexFetchSpecClone(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	// The spec is for the index g_idx (g) STORING (ga) of the table t with
+	// columns k INT (the primary key), g greeting and ga greeting[], where
+	// greeting is an enum.
+	greeting := types.MakeEnum(catid.TypeIDToOID(105), catid.TypeIDToOID(106))
+	greeting.TypeMeta = types.UserDefinedTypeMetadata{
+		Name:    &types.UserDefinedTypeName{Catalog: "defaultdb", Schema: "public", Name: "greeting"},
+		Version: 1,
+	}
+	cols := fetchedColumns(types.Int, greeting, types.MakeArray(greeting))
+	// These slices are shared with the (hypothetical) table descriptor, like the
+	// slices set up by rowenc.InitIndexFetchSpec.
+	descKeySuffixIDs := []catid.ColumnID{1}
+	descStoredIDs := []catid.ColumnID{3}
+	spec := fetchpb.IndexFetchSpec{
+		Version:          fetchpb.IndexFetchSpecVersionCurrent,
+		TableID:          104,
+		TableName:        "t",
+		IndexID:          2,
+		IndexName:        "g_idx",
+		IsSecondaryIndex: true,
+		KeyAndSuffixColumns: []fetchpb.IndexFetchSpec_KeyColumn{
+			{IndexFetchSpec_Column: cols[1], Direction: catenumpb.IndexColumn_ASC},
+			{IndexFetchSpec_Column: cols[0], Direction: catenumpb.IndexColumn_ASC},
+		},
+		NumKeySuffixColumns: 1,
+		MaxKeysPerRow:       1,
+		KeySuffixColumnIDs:  descKeySuffixIDs,
+		StoredColumnsByFamily: []fetchpb.IndexFetchSpec_FamilyStoredColumns{
+			{FamilyID: 0, StoredColumnIDs: descStoredIDs},
+		},
+		FetchedColumns: cols,
+	}
+	orig, err := protoutil.Marshal(&spec)
+	require.NoError(t, err)
+	gMeta := spec.FetchedColumns[1].Type.TypeMeta
+	gaMeta := spec.FetchedColumns[2].Type.ArrayContents().TypeMeta
+
+	clone := spec.Clone()
+	require.Equal(t, spec, *clone)
+	require.True(t, spec.Equal(clone))
+	// Built-in types are shared, user-defined types are not. A type shared by a
+	// key column and a fetched column is still shared in the clone.
+	require.Same(t, spec.FetchedColumns[0].Type, clone.FetchedColumns[0].Type)
+	require.NotSame(t, spec.FetchedColumns[1].Type, clone.FetchedColumns[1].Type)
+	require.NotSame(t, spec.FetchedColumns[2].Type, clone.FetchedColumns[2].Type)
+	require.NotSame(t, spec.FetchedColumns[2].Type.ArrayContents(), clone.FetchedColumns[2].Type.ArrayContents())
+	require.Same(t, clone.KeyAndSuffixColumns[0].Type, clone.FetchedColumns[1].Type)
+
+	// Modify the clone while the original is being read; the race detector
+	// flags any memory that is still shared.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		clone.TableName = "u"
+		for i := range clone.KeyAndSuffixColumns {
+			clone.KeyAndSuffixColumns[i].Name = "x"
+			clone.KeyAndSuffixColumns[i].ColumnID += 100
+		}
+		for i := range clone.FetchedColumns {
+			clone.FetchedColumns[i].Name = "x"
+			clone.FetchedColumns[i].ColumnID += 100
+		}
+		for i := range clone.KeySuffixColumnIDs {
+			clone.KeySuffixColumnIDs[i] += 100
+		}
+		for i := range clone.StoredColumnsByFamily {
+			ids := clone.StoredColumnsByFamily[i].StoredColumnIDs
+			for j := range ids {
+				ids[j] += 100
+			}
+		}
+		// Simulate the hydration of the types with a newer type descriptor.
+		clone.FetchedColumns[1].Type.TypeMeta.Version++
+		clone.FetchedColumns[2].Type.ArrayContents().TypeMeta.Version++
+	}()
+	for i := 0; i < 10; i++ {
+		buf, err := protoutil.Marshal(&spec)
+		require.NoError(t, err)
+		require.Equal(t, orig, buf)
+		require.Equal(t, gMeta, spec.FetchedColumns[1].Type.TypeMeta)
+		require.Equal(t, gaMeta, spec.FetchedColumns[2].Type.ArrayContents().TypeMeta)
+	}
+	<-done
+
+	require.NotEqual(t, spec, *clone)
+	buf, err := protoutil.Marshal(&spec)
+	require.NoError(t, err)
+	require.Equal(t, orig, buf)
+	require.Equal(t, gMeta, spec.FetchedColumns[1].Type.TypeMeta)
+	require.Equal(t, gaMeta, spec.FetchedColumns[2].Type.ArrayContents().TypeMeta)
+	// Modifying the clone doesn't affect the descriptor either.
+	require.Equal(t, []catid.ColumnID{1}, descKeySuffixIDs)
+	require.Equal(t, []catid.ColumnID{3}, descStoredIDs)
+
+	// A spec without any slices or user-defined types.
+	var empty fetchpb.IndexFetchSpec
+	require.Equal(t, empty, *empty.Clone())
+}
+
+func TestIndexFetchSpecSingleKVPerRow(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	for _, tc := range []struct {
+		maxKeysPerRow uint32
+		expected      bool
+	}{
+		{maxKeysPerRow: 1, expected: true},
+		{maxKeysPerRow: 2, expected: false},
+		{maxKeysPerRow: 5, expected: false},
+	} {
+		spec := fetchpb.IndexFetchSpec{
+			FetchedColumns: fetchedColumns(types.Int, types.String),
+			MaxKeysPerRow:  tc.maxKeysPerRow,
+		}
+		require.Equal(t, tc.expected, spec.SingleKVPerRow(), "max keys per row %d", tc.maxKeysPerRow)
+	}
+}
+
+func TestIndexFetchSpecAllReferencedColumnIDs(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	// The table has the columns c1 to c5 and the primary key (c1, c2). The
+	// secondary index has the key columns c3 and c4.
+	allCols := fetchedColumns(types.Int, types.Int, types.Int, types.Int, types.Int)
+	// mvccCol is a system column, which has a very large ID (like the MVCC
+	// timestamp column).
+	mvccCol := fetchpb.IndexFetchSpec_Column{
+		ColumnID:       math.MaxUint32 - 1,
+		Name:           "crdb_internal_mvcc_timestamp",
+		Type:           types.Decimal,
+		IsSystemColumn: true,
+	}
+	withIDs := func(ids ...catid.ColumnID) []fetchpb.IndexFetchSpec_KeyColumn {
+		cols := make([]fetchpb.IndexFetchSpec_KeyColumn, len(ids))
+		for i, id := range ids {
+			cols[i].IndexFetchSpec_Column = allCols[id-1]
+		}
+		return cols
+	}
+	for _, tc := range []struct {
+		name      string
+		keyCols   []fetchpb.IndexFetchSpec_KeyColumn
+		suffixIDs []catid.ColumnID
+		fetched   []fetchpb.IndexFetchSpec_Column
+		expected  []int
+	}{
+		{
+			name:      "secondary index, no fetched columns",
+			keyCols:   withIDs(3, 4, 1, 2),
+			suffixIDs: []catid.ColumnID{1, 2},
+			expected:  []int{1, 2, 3, 4},
+		},
+		// The fetched columns overlap with the key and suffix columns.
+		{
+			name:      "secondary index",
+			keyCols:   withIDs(3, 4, 1, 2),
+			suffixIDs: []catid.ColumnID{1, 2},
+			fetched:   []fetchpb.IndexFetchSpec_Column{allCols[2], allCols[0]},
+			expected:  []int{1, 2, 3, 4},
+		},
+		{
+			name:     "primary index",
+			keyCols:  withIDs(1, 2),
+			fetched:  []fetchpb.IndexFetchSpec_Column{allCols[3], allCols[4]},
+			expected: []int{1, 2, 4, 5},
+		},
+		{
+			name:      "system column",
+			keyCols:   withIDs(3, 4, 1, 2),
+			suffixIDs: []catid.ColumnID{1, 2},
+			fetched:   []fetchpb.IndexFetchSpec_Column{allCols[3], mvccCol},
+			expected:  []int{1, 2, 3, 4, math.MaxUint32 - 1},
+		},
+		{name: "empty", expected: nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := fetchpb.IndexFetchSpec{
+				KeyAndSuffixColumns: tc.keyCols,
+				NumKeySuffixColumns: uint32(len(tc.suffixIDs)),
+				KeySuffixColumnIDs:  tc.suffixIDs,
+				FetchedColumns:      tc.fetched,
+			}
+			require.Equal(t, tc.expected, spec.AllReferencedColumnIDs().Ordered())
+		})
+	}
+}
+
+func TestIndexFetchSpecEstimatedRowSize(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	estimate := func(typs ...*types.T) int64 {
+		spec := fetchpb.IndexFetchSpec{FetchedColumns: fetchedColumns(typs...)}
+		return spec.EstimatedRowSize()
+	}
+
+	keyOnly := estimate(types.Int)
+	require.Equal(t, int64(8), keyOnly)
+	withBool := estimate(types.Int, types.Bool)
+	withString := estimate(types.Int, types.String)
+	require.Greater(t, withBool, keyOnly)
+	require.Greater(t, withString-keyOnly, withBool-keyOnly)
+	// The width bounds the estimate of a string.
+	require.Less(t, estimate(types.Int, types.MakeVarChar(4)), withString)
+	require.Greater(t, estimate(types.Int, types.Jsonb), withString)
+	require.Greater(t, estimate(types.Int, types.IntArray), estimate(types.Int, types.Float))
+	// Adding columns never decreases the estimate.
+	allTypes := []*types.T{
+		types.Int, types.Bool, types.String, types.MakeVarChar(4), types.Jsonb, types.Float, types.IntArray,
+	}
+	require.Greater(t, estimate(allTypes...), estimate(allTypes[:len(allTypes)-1]...))
+	require.Zero(t, estimate())
+}
+
+func TestIndexFetchSpecPrefixKeyColumns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	// The spec is for the index abc_idx (a, b DESC, c) STORING (d) of the table
+	// t with columns k (the primary key), a, b, c and d, where d is in another
+	// column family. All the columns are fetched, and the output columns are d,
+	// b and a.
+	allCols := fetchedColumns(types.Int, types.Int, types.Int, types.Int, types.Int)
+	keyCol := func(
+		col fetchpb.IndexFetchSpec_Column, dir catenumpb.IndexColumn_Direction,
+	) fetchpb.IndexFetchSpec_KeyColumn {
+		return fetchpb.IndexFetchSpec_KeyColumn{IndexFetchSpec_Column: col, Direction: dir}
+	}
+	asc, desc := catenumpb.IndexColumn_ASC, catenumpb.IndexColumn_DESC
+	spec := fetchpb.IndexFetchSpec{
+		TableName:        "t",
+		IndexName:        "abc_idx",
+		IsSecondaryIndex: true,
+		KeyAndSuffixColumns: []fetchpb.IndexFetchSpec_KeyColumn{
+			keyCol(allCols[1], asc), keyCol(allCols[2], desc), keyCol(allCols[3], asc), keyCol(allCols[0], asc),
+		},
+		NumKeySuffixColumns: 1,
+		KeySuffixColumnIDs:  []catid.ColumnID{1},
+		MaxKeysPerRow:       2,
+		StoredColumnsByFamily: []fetchpb.IndexFetchSpec_FamilyStoredColumns{
+			{FamilyID: 1, StoredColumnIDs: []catid.ColumnID{5}},
+		},
+		FetchedColumns:    allCols,
+		ColumnToOutputIdx: []int32{-1, 2, 1, -1, 0},
+	}
+
+	for _, k := range []int{0, 4} {
+		_, err := spec.PrefixKeyColumns(k)
+		require.Regexp(t, "invalid number of prefix key columns", err)
+	}
+
+	prefix, err := spec.PrefixKeyColumns(2)
+	require.NoError(t, err)
+	require.Len(t, prefix.KeyAndSuffixColumns, 2)
+	require.Equal(t, spec.KeyAndSuffixColumns[:2], prefix.KeyAndSuffixColumns)
+	require.Equal(t, []catenumpb.IndexColumn_Direction{asc, desc}, prefix.KeyColumnDirections())
+	require.Zero(t, prefix.NumKeySuffixColumns)
+	require.Empty(t, prefix.KeySuffixColumnIDs)
+	require.Empty(t, prefix.KeySuffixColumns())
+	require.Empty(t, prefix.StoredColumnsByFamily)
+	require.True(t, prefix.SingleKVPerRow())
+	require.Equal(t, []fetchpb.IndexFetchSpec_Column{allCols[1], allCols[2]}, prefix.FetchedColumns)
+	require.Equal(t, []int32{2, 1}, prefix.ColumnToOutputIdx)
+	// The original spec is unchanged.
+	require.Len(t, spec.KeyAndSuffixColumns, 4)
+	require.Len(t, spec.FetchedColumns, 5)
+	require.Equal(t, uint32(2), spec.MaxKeysPerRow)
+
+	// A prefix of a unique index is not unique.
+	spec.IsUniqueIndex = true
+	prefix, err = spec.PrefixKeyColumns(3)
+	require.NoError(t, err)
+	require.False(t, prefix.IsUniqueIndex)
+	require.Len(t, prefix.FetchedColumns, 3)
+	require.Equal(t, []int32{2, 1, -1}, prefix.ColumnToOutputIdx)
+}
+
+func TestIndexFetchSpecColumnInKeyInValue(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	for _, tc := range []struct {
+		name           string
+		col            fetchpb.IndexFetchSpec_Column
+		inKey, inValue bool
+	}{
+		{name: "key", col: fetchpb.IndexFetchSpec_Column{Role: fetchpb.IndexFetchSpec_KEY}, inKey: true},
+		{
+			name:  "key suffix",
+			col:   fetchpb.IndexFetchSpec_Column{Role: fetchpb.IndexFetchSpec_KEY_SUFFIX},
+			inKey: true,
+		},
+		// A composite key column is encoded in the value as well.
+		{
+			name:    "composite key",
+			col:     fetchpb.IndexFetchSpec_Column{Role: fetchpb.IndexFetchSpec_KEY, IsCompositeKeyColumn: true},
+			inKey:   true,
+			inValue: true,
+		},
+		{
+			name:    "stored",
+			col:     fetchpb.IndexFetchSpec_Column{Role: fetchpb.IndexFetchSpec_STORED},
+			inValue: true,
+		},
+		// Virtual and system columns are not encoded in the index.
+		{name: "virtual", col: fetchpb.IndexFetchSpec_Column{Role: fetchpb.IndexFetchSpec_NO_ROLE}},
+		{
+			name: "system",
+			col:  fetchpb.IndexFetchSpec_Column{Role: fetchpb.IndexFetchSpec_NO_ROLE, IsSystemColumn: true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.inKey, tc.col.InKey())
+			require.Equal(t, tc.inValue, tc.col.InValue())
+		})
+	}
+}
+
+func TestIndexFetchSpecKeyColumnNullsLast(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	for _, dir := range []catenumpb.IndexColumn_Direction{catenumpb.IndexColumn_ASC, catenumpb.IndexColumn_DESC} {
+		keyCol := keyColumns(dir)[0]
+		require.Equal(t, dir == catenumpb.IndexColumn_DESC, keyCol.NullsLast(), dir)
+
+		// The encoded NULL sorts on the side of the other values indicated by the
+		// null ordering.
+		var nullKey []byte
+		if keyCol.EncodingDirection() == encoding.Ascending {
+			nullKey = encoding.EncodeNullAscending(nil)
+		} else {
+			nullKey = encoding.EncodeNullDescending(nil)
+		}
+		for _, v := range []int64{math.MinInt64, -1, 0, 1, math.MaxInt64} {
+			var key []byte
+			if keyCol.EncodingDirection() == encoding.Ascending {
+				key = encoding.EncodeVarintAscending(nil, v)
+			} else {
+				key = encoding.EncodeVarintDescending(nil, v)
+			}
+			require.Equal(t, keyCol.NullsLast(), bytes.Compare(nullKey, key) > 0, "%s %d", dir, v)
+		}
+	}
+}
+
+func TestIndexFetchSpecProjectionTo(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	// The table has the columns c1 to c4, and c1 to c3 are fetched, in that
+	// order.
+	spec := fetchpb.IndexFetchSpec{
+		TableName:      "t",
+		IndexName:      "t_pkey",
+		FetchedColumns: fetchedColumns(types.Int, types.Int, types.String),
+	}
+	for _, tc := range []struct {
+		colIDs   []catid.ColumnID
+		expected []int
+	}{
+		{colIDs: []catid.ColumnID{1, 2, 3}, expected: []int{0, 1, 2}},
+		{colIDs: []catid.ColumnID{1, 3}, expected: []int{0, 2}},
+		{colIDs: []catid.ColumnID{3, 1, 2}, expected: []int{2, 0, 1}},
+		{colIDs: []catid.ColumnID{2, 2}, expected: []int{1, 1}},
+		{colIDs: nil, expected: []int{}},
+	} {
+		projection, err := spec.ProjectionTo(tc.colIDs)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, projection, "%v", tc.colIDs)
+		for i, idx := range projection {
+			require.Equal(t, tc.colIDs[i], spec.FetchedColumns[idx].ColumnID)
+		}
+	}
+
+	// The column c4 is not fetched.
+	_, err := spec.ProjectionTo([]catid.ColumnID{2, 4})
+	require.ErrorContains(t, err, "column 4 is not fetched from index t_pkey of table t")
+}
+
+func TestIndexFetchSpecSerializedSize(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	greeting := types.MakeEnum(catid.TypeIDToOID(105), catid.TypeIDToOID(106))
+	cols := fetchedColumns(types.Int, greeting, types.MakeCollatedString(types.String, "en"), types.Jsonb)
+	cols[0].Role, cols[1].Role = fetchpb.IndexFetchSpec_KEY_SUFFIX, fetchpb.IndexFetchSpec_KEY
+	for i := 2; i < len(cols); i++ {
+		cols[i].Role, cols[i].FamilyID = fetchpb.IndexFetchSpec_STORED, 1
+	}
+	spec := fetchpb.IndexFetchSpec{
+		Version:          fetchpb.IndexFetchSpecVersionCurrent,
+		TableID:          104,
+		TableName:        "t",
+		IndexID:          2,
+		IndexName:        "g_idx",
+		IsSecondaryIndex: true,
+		IsPartial:        true,
+		// The IDs are large enough to need more than one byte in the varint
+		// encoding.
+		PredicateColumnIDs:    []catid.ColumnID{1, 300},
+		PredicateTypeIDs:      []catid.DescID{105},
+		GeoConfig:             *geoindex.DefaultGeographyIndexConfig(),
+		PartitioningColumnIDs: []catid.ColumnID{1},
+		Invisibility:          0.5,
+		KeyAndSuffixColumns: []fetchpb.IndexFetchSpec_KeyColumn{
+			{IndexFetchSpec_Column: cols[1], Direction: catenumpb.IndexColumn_DESC},
+			{IndexFetchSpec_Column: cols[0], Direction: catenumpb.IndexColumn_ASC},
+		},
+		NumKeySuffixColumns: 1,
+		KeySuffixColumnIDs:  []catid.ColumnID{1},
+		MaxKeysPerRow:       2,
+		KeyPrefixLength:     2,
+		MaxFamilyID:         1,
+		FamilyDefaultColumns: []fetchpb.IndexFetchSpec_FamilyDefaultColumn{
+			{FamilyID: 1, DefaultColumnID: 3},
+		},
+		FetchedColumns:             cols,
+		VirtualColumnDependencyIDs: []catid.ColumnID{4},
+		StoredColumnsByFamily: []fetchpb.IndexFetchSpec_FamilyStoredColumns{
+			{FamilyID: 1, StoredColumnIDs: []catid.ColumnID{3, 4}},
+		},
+		ExpressionColumns: []fetchpb.IndexFetchSpec_ExpressionColumn{
+			{ColumnID: 5, Expr: "k + 1", ReferencedColumnIDs: []catid.ColumnID{1}},
+		},
+		ColumnToOutputIdx: []int32{0, -1, 1, 2},
+	}
+
+	for _, tc := range []struct {
+		name   string
+		modify func(s *fetchpb.IndexFetchSpec)
+	}{
+		{name: "all fields", modify: func(s *fetchpb.IndexFetchSpec) {}},
+		{name: "no fetched columns", modify: func(s *fetchpb.IndexFetchSpec) { s.FetchedColumns = nil }},
+		{
+			name: "initial version",
+			modify: func(s *fetchpb.IndexFetchSpec) {
+				s.Version = fetchpb.IndexFetchSpecVersionInitial
+				for i := range s.FetchedColumns {
+					s.FetchedColumns[i].Role = fetchpb.IndexFetchSpec_NO_ROLE
+				}
+			},
+		},
+		{name: "empty", modify: func(s *fetchpb.IndexFetchSpec) { *s = fetchpb.IndexFetchSpec{} }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := spec.Clone()
+			tc.modify(s)
+			buf, err := protoutil.Marshal(s)
+			require.NoError(t, err)
+			require.Equal(t, len(buf), s.SerializedSize())
+		})
+	}
+}
+
+func TestIndexFetchSpecDefaultColumnForFamily(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	sorted := []fetchpb.IndexFetchSpec_FamilyDefaultColumn{
+		{FamilyID: 1, DefaultColumnID: 3},
+		{FamilyID: 3, DefaultColumnID: 5},
+		{FamilyID: 4, DefaultColumnID: 2},
+	}
+	// Specs of the initial version can list the families in the order of the
+	// table descriptor.
+	unsorted := []fetchpb.IndexFetchSpec_FamilyDefaultColumn{sorted[1], sorted[2], sorted[0]}
+	for _, tc := range []struct {
+		name    string
+		version uint32
+		cols    []fetchpb.IndexFetchSpec_FamilyDefaultColumn
+	}{
+		{name: "current", version: fetchpb.IndexFetchSpecVersionCurrent, cols: sorted},
+		{name: "initial", version: fetchpb.IndexFetchSpecVersionInitial, cols: sorted},
+		{name: "initial unsorted", version: fetchpb.IndexFetchSpecVersionInitial, cols: unsorted},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := fetchpb.IndexFetchSpec{Version: tc.version, FamilyDefaultColumns: tc.cols}
+			expected := map[catid.FamilyID]catid.ColumnID{1: 3, 3: 5, 4: 2}
+			for id := catid.FamilyID(0); id <= 5; id++ {
+				colID, ok := spec.DefaultColumnForFamily(id)
+				expectedColID, expectedOK := expected[id]
+				require.Equal(t, expectedOK, ok, "family %d", id)
+				require.Equal(t, expectedColID, colID, "family %d", id)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@
 package tabledesc
 
 import (
+	"sort"
 	"strings"
 
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
@@ -398,6 +399,15 @@ func newColumnCache(desc *descpb.TableDescriptor, mutations *mutationCache) *col
 			})
 		}
 	}
+	// The families are usually stored in ID order, but this isn't guaranteed;
+	// IndexFetchSpec.FamilyDefaultColumns must be sorted by family ID.
+	if !sort.SliceIsSorted(c.familyDefaultColumns, func(i, j int) bool {
+		return c.familyDefaultColumns[i].FamilyID < c.familyDefaultColumns[j].FamilyID
+	}) {
+		sort.Slice(c.familyDefaultColumns, func(i, j int) bool {
+			return c.familyDefaultColumns[i].FamilyID < c.familyDefaultColumns[j].FamilyID
+		})
+	}
 
 	// Populate the per-index column cache
 	c.index = make([]indexColumnCache, 0, 1+len(desc.Indexes)+len(mutations.indexes))
@@ -457,15 +467,24 @@ func makeIndexColumnCache(idx *descpb.IndexDescriptor, all []catalog.Column) (ic
 		}
 		colID := col.GetID()
 		typ := col.GetType()
+		isNonNullable := !col.IsNullable()
+		role := fetchpb.IndexFetchSpec_KEY
+		if i >= nKey {
+			role = fetchpb.IndexFetchSpec_KEY_SUFFIX
+		}
 		if colID != 0 && colID == invertedColumnID {
 			typ = idx.InvertedColumnKeyType()
+			// NULL array elements are encoded as NULL inverted keys, so the inverted
+			// key can be NULL even if the column is not nullable.
+			isNonNullable = false
 		}
 		ic.keyAndSuffix[i] = fetchpb.IndexFetchSpec_KeyColumn{
 			IndexFetchSpec_Column: fetchpb.IndexFetchSpec_Column{
 				Name:          col.GetName(),
 				ColumnID:      colID,
 				Type:          typ,
-				IsNonNullable: !col.IsNullable(),
+				IsNonNullable: isNonNullable,
+				Role:          role,
 			},
 			Direction:   ic.allDirs[i],
 			IsComposite: compositeIDs.Contains(colID),
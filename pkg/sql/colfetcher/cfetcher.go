@@ -35,6 +35,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/colmem"
 	"github.com/cockroachdb/cockroach/pkg/sql/execinfra/execreleasable"
 	"github.com/cockroachdb/cockroach/pkg/sql/row"
+	"github.com/cockroachdb/cockroach/pkg/sql/rowenc"
 	"github.com/cockroachdb/cockroach/pkg/sql/rowenc/keyside"
 	"github.com/cockroachdb/cockroach/pkg/sql/rowinfra"
 	"github.com/cockroachdb/cockroach/pkg/sql/scrub"
@@ -357,9 +358,14 @@ func (cf *cFetcher) resetBatch() {
 func (cf *cFetcher) Init(
 	allocator *colmem.Allocator, nextKVer storage.NextKVer, tableArgs *cFetcherTableArgs,
 ) error {
-	if tableArgs.spec.Version != fetchpb.IndexFetchSpecVersionInitial {
+	if !fetchpb.IsSupportedIndexFetchSpecVersion(tableArgs.spec.Version) {
 		return errors.Newf("unsupported IndexFetchSpec version %d", tableArgs.spec.Version)
 	}
+	if tableArgs.spec.IsTemporaryIndex {
+		return errors.AssertionFailedf(
+			"temporary index %s is not supported by the cFetcher", tableArgs.spec.IndexName,
+		)
+	}
 	table := newCTableInfo()
 	nCols := tableArgs.ColIdxMap.Len()
 	if cap(table.orderedColIdxMap.vals) < nCols {
@@ -553,6 +559,7 @@ func (cf *cFetcher) StartScan(
 		return errors.AssertionFailedf("batchBytesLimit set without limitBatches")
 	}
 
+	rowenc.IncIndexFetchTelemetry(&cf.table.spec)
 	firstBatchLimit := cFetcherFirstBatchLimit(limitHint, cf.table.spec.MaxKeysPerRow)
 	cf.machine.lastRowPrefix = nil
 	cf.machine.limitHint = int(limitHint)
@@ -652,7 +659,7 @@ func (cf *cFetcher) setNextKV(kv roachpb.KeyValue) {
 	// family, then we will have finalized the row (meaning we'll have deep
 	// copied necessary part of the kv into the batch) by the time NextKV is
 	// called again, so we avoid the copy in those cases.
-	if cf.stableKVs || cf.table.spec.MaxKeysPerRow == 1 {
+	if cf.stableKVs || cf.table.spec.SingleKVPerRow() {
 		cf.machine.nextKV = kv
 		return
 	}
@@ -748,7 +755,7 @@ func (cf *cFetcher) NextBatch(ctx context.Context) (coldata.Batch, error) {
 				// families, we must check all columns for NULL values in order
 				// to determine whether a KV belongs to the same row as the
 				// previous KV or a different row.
-				checkAllColsForNull := cf.table.spec.IsSecondaryIndex && cf.table.spec.IsUniqueIndex && cf.table.spec.MaxKeysPerRow != 1
+				checkAllColsForNull := cf.table.spec.IsSecondaryIndex && cf.table.spec.IsUniqueIndex && !cf.table.spec.SingleKVPerRow()
 				key, foundNull, cf.scratch.decoding, err = colencoding.DecodeKeyValsToCols(
 					&cf.table.da,
 					&cf.machine.colvecs,
@@ -798,7 +805,7 @@ func (cf *cFetcher) NextBatch(ctx context.Context) (coldata.Batch, error) {
 			// family because it is guaranteed that there is only one KV per
 			// row. We entirely skip the check that determines if the row is
 			// unfinished.
-			if foundNull && cf.table.spec.IsSecondaryIndex && cf.table.spec.IsUniqueIndex && cf.table.spec.MaxKeysPerRow != 1 {
+			if foundNull && cf.table.spec.IsSecondaryIndex && cf.table.spec.IsUniqueIndex && !cf.table.spec.SingleKVPerRow() {
 				// We get the remaining bytes after the computed prefix, and then
 				// slice off the extra encoded columns from those bytes. We calculate
 				// how many bytes were sliced away, and then extend lastRowPrefix
@@ -1068,14 +1075,8 @@ func (cf *cFetcher) processValue(ctx context.Context, familyID descpb.FamilyID)
 				break
 			}
 			// Find the default column ID for the family.
-			var defaultColumnID descpb.ColumnID
-			for _, f := range table.spec.FamilyDefaultColumns {
-				if f.FamilyID == familyID {
-					defaultColumnID = f.DefaultColumnID
-					break
-				}
-			}
-			if defaultColumnID == 0 {
+			defaultColumnID, ok := table.spec.DefaultColumnForFamily(familyID)
+			if !ok {
 				return scrub.WrapError(
 					scrub.IndexKeyDecodingError,
 					errors.Errorf("single entry value with no default column id"),
@@ -19,6 +19,7 @@ import (
 
 	"github.com/cockroachdb/cockroach/pkg/base"
 	"github.com/cockroachdb/cockroach/pkg/cloud"
+	"github.com/cockroachdb/cockroach/pkg/clusterversion"
 	"github.com/cockroachdb/cockroach/pkg/gossip"
 	"github.com/cockroachdb/cockroach/pkg/jobs"
 	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
@@ -34,6 +35,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/catenumpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/colinfo"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/fetchpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/colflow"
 	"github.com/cockroachdb/cockroach/pkg/sql/distsql"
 	"github.com/cockroachdb/cockroach/pkg/sql/execinfra/execagg"
@@ -1590,6 +1592,27 @@ func (dsp *DistSQLPlanner) convertOrdering(
 	return result
 }
 
+// initIndexFetchSpecForProcessor initializes the IndexFetchSpec of a processor
+// spec, which might be sent to other nodes for execution. Until
+// V23_2_IndexFetchSpecIndexMetadata is active, some nodes might be running a
+// binary which only accepts fetchpb.IndexFetchSpecVersionInitial, so the spec is
+// downgraded to that version.
+func initIndexFetchSpecForProcessor(
+	ctx context.Context,
+	st *cluster.Settings,
+	s *fetchpb.IndexFetchSpec,
+	codec keys.SQLCodec,
+	table catalog.TableDescriptor,
+	index catalog.Index,
+	fetchColumnIDs []descpb.ColumnID,
+) error {
+	var opts rowenc.IndexFetchSpecOptions
+	if !st.Version.IsActive(ctx, clusterversion.V23_2_IndexFetchSpecIndexMetadata) {
+		opts.TargetVersion = fetchpb.IndexFetchSpecVersionInitial
+	}
+	return rowenc.InitIndexFetchSpecWithOptions(s, codec, table, index, fetchColumnIDs, opts)
+}
+
 // initTableReaderSpecTemplate initializes a TableReaderSpec/PostProcessSpec
 // that corresponds to a scanNode, except for the following fields:
 //   - Spans
@@ -1599,7 +1622,7 @@ func (dsp *DistSQLPlanner) convertOrdering(
 // The generated specs will be used as templates for planning potentially
 // multiple TableReaders.
 func initTableReaderSpecTemplate(
-	n *scanNode, codec keys.SQLCodec,
+	ctx context.Context, n *scanNode, st *cluster.Settings, codec keys.SQLCodec,
 ) (*execinfrapb.TableReaderSpec, execinfrapb.PostProcessSpec, error) {
 	if n.isCheck {
 		return nil, execinfrapb.PostProcessSpec{}, errors.AssertionFailedf("isCheck no longer supported")
@@ -1615,7 +1638,7 @@ func initTableReaderSpecTemplate(
 		LockingStrength:                 n.lockingStrength,
 		LockingWaitPolicy:               n.lockingWaitPolicy,
 	}
-	if err := rowenc.InitIndexFetchSpec(&s.FetchSpec, codec, n.desc, n.index, colIDs); err != nil {
+	if err := initIndexFetchSpecForProcessor(ctx, st, &s.FetchSpec, codec, n.desc, n.index, colIDs); err != nil {
 		return nil, execinfrapb.PostProcessSpec{}, err
 	}
 
@@ -1633,7 +1656,9 @@ func initTableReaderSpecTemplate(
 func (dsp *DistSQLPlanner) createTableReaders(
 	ctx context.Context, planCtx *PlanningCtx, n *scanNode,
 ) (*PhysicalPlan, error) {
-	spec, post, err := initTableReaderSpecTemplate(n, planCtx.ExtendedEvalCtx.Codec)
+	spec, post, err := initTableReaderSpecTemplate(
+		ctx, n, planCtx.ExtendedEvalCtx.Settings, planCtx.ExtendedEvalCtx.Codec,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -2700,7 +2725,9 @@ func (dsp *DistSQLPlanner) createPlanForIndexJoin(
 		fetchOrdinals.Add(n.cols[i].Ordinal())
 	}
 	index := n.table.desc.GetPrimaryIndex()
-	if err := rowenc.InitIndexFetchSpec(
+	if err := initIndexFetchSpecForProcessor(
+		ctx,
+		planCtx.ExtendedEvalCtx.Settings,
 		&joinReaderSpec.FetchSpec,
 		planCtx.ExtendedEvalCtx.Codec,
 		n.table.desc,
@@ -2784,7 +2811,9 @@ func (dsp *DistSQLPlanner) createPlanForLookupJoin(
 		fetchColIDs[i] = n.table.cols[i].GetID()
 		fetchOrdinals.Add(n.table.cols[i].Ordinal())
 	}
-	if err := rowenc.InitIndexFetchSpec(
+	if err := initIndexFetchSpecForProcessor(
+		ctx,
+		planCtx.ExtendedEvalCtx.Settings,
 		&joinReaderSpec.FetchSpec,
 		planCtx.ExtendedEvalCtx.Codec,
 		n.table.desc,
@@ -2904,7 +2933,9 @@ func (dsp *DistSQLPlanner) createPlanForInvertedJoin(
 	for i := range n.table.cols {
 		fetchColIDs[i] = n.table.cols[i].GetID()
 	}
-	if err := rowenc.InitIndexFetchSpec(
+	if err := initIndexFetchSpecForProcessor(
+		ctx,
+		planCtx.ExtendedEvalCtx.Settings,
 		&invertedJoinerSpec.FetchSpec,
 		planCtx.ExtendedEvalCtx.Codec,
 		n.table.desc,
@@ -3035,7 +3066,9 @@ func (dsp *DistSQLPlanner) planZigzagJoin(
 		for i := range side.cols {
 			fetchColIDs[i] = side.cols[i].GetID()
 		}
-		if err := rowenc.InitIndexFetchSpec(
+		if err := initIndexFetchSpecForProcessor(
+			ctx,
+			planCtx.ExtendedEvalCtx.Settings,
 			&s.FetchSpec,
 			planCtx.ExtendedEvalCtx.Codec,
 			side.desc,
@@ -22,6 +22,7 @@ import (
 	"testing"
 
 	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/clusterversion"
 	"github.com/cockroachdb/cockroach/pkg/config/zonepb"
 	"github.com/cockroachdb/cockroach/pkg/gossip"
 	"github.com/cockroachdb/cockroach/pkg/keys"
@@ -35,6 +36,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/desctestutils"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/fetchpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/tabledesc"
 	"github.com/cockroachdb/cockroach/pkg/sql/distsql"
 	"github.com/cockroachdb/cockroach/pkg/sql/execinfra"
@@ -1515,3 +1517,49 @@ func TestClosestInstances(t *testing.T) {
 		})
 	}
 }
+
+// TestInitIndexFetchSpecForProcessorMixedVersion verifies that the fetch specs
+// of the processors planned in a mixed-version cluster can be decoded by nodes
+// running a binary which only accepts the initial spec version.
+func TestInitIndexFetchSpecForProcessorMixedVersion(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+	ctx := context.Background()
+
+	s, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer s.Stopper().Stop(ctx)
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (k INT PRIMARY KEY, a INT, b INT, UNIQUE INDEX a_idx (a) STORING (b))`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	secondary, err := catalog.MustFindIndexByName(table, "a_idx")
+	require.NoError(t, err)
+
+	mixedVersion := cluster.MakeTestingClusterSettingsWithVersions(
+		clusterversion.TestingBinaryVersion,
+		clusterversion.ByKey(clusterversion.V23_2_IndexFetchSpecIndexMetadata-1),
+		true, /* initializeVersion */
+	)
+	upgraded := cluster.MakeTestingClusterSettings()
+
+	for _, index := range []catalog.Index{table.GetPrimaryIndex(), secondary} {
+		t.Run(index.GetName(), func(t *testing.T) {
+			var spec fetchpb.IndexFetchSpec
+			require.NoError(t, initIndexFetchSpecForProcessor(
+				ctx, mixedVersion, &spec, keys.SystemSQLCodec, table, index, table.PublicColumnIDs(),
+			))
+			// Older binaries reject any other version.
+			require.Equal(t, uint32(fetchpb.IndexFetchSpecVersionInitial), spec.Version)
+			require.Zero(t, spec.IndexVersion)
+			require.Nil(t, spec.KeySuffixColumnIDs)
+			for i := range spec.FetchedColumns {
+				require.Equal(t, fetchpb.IndexFetchSpec_NO_ROLE, spec.FetchedColumns[i].Role)
+			}
+
+			require.NoError(t, initIndexFetchSpecForProcessor(
+				ctx, upgraded, &spec, keys.SystemSQLCodec, table, index, table.PublicColumnIDs(),
+			))
+			require.Equal(t, uint32(fetchpb.IndexFetchSpecVersionCurrent), spec.Version)
+			require.Equal(t, uint32(index.GetVersion()), spec.IndexVersion)
+		})
+	}
+}
@@ -141,10 +141,11 @@ func decodeKeyValsUsingSpec(
 	// We want the key columns without the suffix columns.
 	keyCols := spec.KeyColumns()
 	keyVals := make([]rowenc.EncDatum, len(keyCols))
-	if len(key) < int(spec.KeyPrefixLength) {
-		return nil, nil, errors.AssertionFailedf("invalid table key")
+	key, err = spec.StripKeyPrefix(key)
+	if err != nil {
+		return nil, nil, err
 	}
-	if _, _, err := rowenc.DecodeKeyValsUsingSpec(keyCols, key[spec.KeyPrefixLength:], keyVals); err != nil {
+	if _, _, err := rowenc.DecodeKeyValsUsingSpec(keyCols, key, keyVals); err != nil {
 		return nil, nil, err
 	}
 	colNames = make([]string, len(keyCols))
@@ -195,7 +195,8 @@ type tableInfo struct {
 	// meaningful when kv deletion tombstones are returned by the KVBatchFetcher,
 	// which the one used by `StartScan` (the common case) doesnt. Notably,
 	// changefeeds use this by providing raw kvs with tombstones unfiltered via
-	// `ConsumeKVProvider`.
+	// `ConsumeKVProvider`. It is also meaningful for temporary indexes, whose
+	// deleted entries are preserved (see fetchpb.IndexFetchSpec.IsTemporaryIndex).
 	rowIsDeleted bool
 }
 
@@ -320,7 +321,7 @@ type FetcherInitArgs struct {
 
 // Init sets up a Fetcher for a given table and index.
 func (rf *Fetcher) Init(ctx context.Context, args FetcherInitArgs) error {
-	if args.Spec.Version != fetchpb.IndexFetchSpecVersionInitial {
+	if !fetchpb.IsSupportedIndexFetchSpecVersion(args.Spec.Version) {
 		return errors.Newf("unsupported IndexFetchSpec version %d", args.Spec.Version)
 	}
 
@@ -545,6 +546,7 @@ func (rf *Fetcher) StartScan(
 		return err
 	}
 
+	rowenc.IncIndexFetchTelemetry(&rf.table.spec)
 	return rf.startScan(ctx)
 }
 
@@ -646,6 +648,7 @@ func (rf *Fetcher) StartInconsistentScan(
 		return err
 	}
 
+	rowenc.IncIndexFetchTelemetry(&rf.table.spec)
 	return rf.startScan(ctx)
 }
 
@@ -712,7 +715,7 @@ func (rf *Fetcher) nextKey(ctx context.Context) (newRow bool, spanID int, _ erro
 	// possible for multiple span IDs to be associated with a given row when the
 	// spans cannot overlap.
 	unchangedPrefix := (!rf.args.SpansCanOverlap || rf.spanID == spanID) &&
-		rf.table.spec.MaxKeysPerRow > 1 && rf.indexKey != nil && bytes.HasPrefix(rf.kv.Key, rf.indexKey)
+		!rf.table.spec.SingleKVPerRow() && rf.indexKey != nil && bytes.HasPrefix(rf.kv.Key, rf.indexKey)
 	if unchangedPrefix {
 		// Skip decoding!
 		rf.keyRemainingBytes = rf.kv.Key[len(rf.indexKey):]
@@ -743,7 +746,7 @@ func (rf *Fetcher) nextKey(ctx context.Context) (newRow bool, spanID int, _ erro
 		// them when processing the index. The difference with unique secondary indexes
 		// is that the extra columns are not always there, and are used to unique-ify
 		// the index key, rather than provide the primary key column values.
-		if foundNull && rf.table.spec.IsSecondaryIndex && rf.table.spec.IsUniqueIndex && rf.table.spec.MaxKeysPerRow > 1 {
+		if foundNull && rf.table.spec.IsSecondaryIndex && rf.table.spec.IsUniqueIndex && !rf.table.spec.SingleKVPerRow() {
 			for i := 0; i < int(rf.table.spec.NumKeySuffixColumns); i++ {
 				var err error
 				// Slice off an extra encoded column from rf.keyRemainingBytes.
@@ -799,6 +802,12 @@ func (rf *Fetcher) processKV(
 ) (prettyKey string, prettyValue string, err error) {
 	table := &rf.table
 
+	if table.spec.IsTemporaryIndex {
+		if kv, err = unwrapTemporaryIndexValue(kv); err != nil {
+			return "", "", scrub.WrapError(scrub.IndexValueDecodingError, err)
+		}
+	}
+
 	if rf.args.TraceKV {
 		prettyKey = fmt.Sprintf(
 			"/%s/%s%s",
@@ -892,14 +901,8 @@ func (rf *Fetcher) processKV(
 			// and a value is not expected, so we're done.
 			if familyID != 0 {
 				// Find the default column ID for the family.
-				var defaultColumnID descpb.ColumnID
-				for _, f := range table.spec.FamilyDefaultColumns {
-					if f.FamilyID == descpb.FamilyID(familyID) {
-						defaultColumnID = f.DefaultColumnID
-						break
-					}
-				}
-				if defaultColumnID == 0 {
+				defaultColumnID, ok := table.spec.DefaultColumnForFamily(descpb.FamilyID(familyID))
+				if !ok {
 					if kv.Value.GetTag() == roachpb.ValueType_UNKNOWN {
 						// Tombstone for a secondary column family, nothing needs to be done.
 					} else {
@@ -971,6 +974,24 @@ func (rf *Fetcher) processKV(
 	return prettyKey, prettyValue, nil
 }
 
+// unwrapTemporaryIndexValue returns the given KV of a temporary index (see
+// fetchpb.IndexFetchSpec.IsTemporaryIndex) with the value unwrapped. The value
+// of a deleted entry is empty, so the entry is decoded like a tombstone.
+func unwrapTemporaryIndexValue(kv roachpb.KeyValue) (roachpb.KeyValue, error) {
+	if len(kv.Value.RawBytes) == 0 {
+		return kv, nil
+	}
+	wrapper, err := rowenc.DecodeWrapper(&kv.Value)
+	if err != nil {
+		return roachpb.KeyValue{}, err
+	}
+	value := roachpb.Value{Timestamp: kv.Value.Timestamp}
+	if !wrapper.Deleted && len(wrapper.Value) > 0 {
+		value.SetTagAndData(wrapper.Value)
+	}
+	return roachpb.KeyValue{Key: kv.Key, Value: value}, nil
+}
+
 // processValueSingle processes the given value (of column colID), setting
 // values in table.row accordingly. The key is only used for logging.
 func (rf *Fetcher) processValueSingle(
@@ -1228,7 +1249,8 @@ func (rf *Fetcher) RowLastModified() hlc.Timestamp {
 // RowIsDeleted may only be called after NextRow has returned a non-nil row and
 // returns true if that row was most recently deleted. This method is only
 // meaningful when the configured KVBatchFetcher returns deletion tombstones, which
-// the normal one (via `StartScan`) does not.
+// the normal one (via `StartScan`) does not, or when fetching from a temporary
+// index (which preserves deleted entries).
 func (rf *Fetcher) RowIsDeleted() bool {
 	return rf.table.rowIsDeleted
 }
@@ -19,9 +19,12 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/base"
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/kv"
+	"github.com/cockroachdb/cockroach/pkg/kv/kvpb"
+	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/concurrency/lock"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/desctestutils"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/fetchpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
@@ -35,6 +38,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/mon"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type initFetcherArgs struct {
@@ -721,6 +725,77 @@ func TestRowFetcherReset(t *testing.T) {
 
 }
 
+// TestRowFetcherLockStrength verifies that the row-level locking mode is
+// propagated from the FetcherInitArgs to the KV requests issued by the
+// Fetcher. Locking is a property of the scan rather than of the IndexFetchSpec,
+// which stays the same regardless of the locking mode.
+func TestRowFetcherLockStrength(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ctx := context.Background()
+
+	s, sqlDB, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer s.Stopper().Stop(ctx)
+	sqlutils.CreateTable(
+		t, sqlDB, "foo",
+		"k INT PRIMARY KEY, v INT",
+		0,
+		sqlutils.ToRowFn(sqlutils.RowIdxFn, sqlutils.RowModuloFn(1)),
+	)
+
+	tableDesc := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, sqlutils.TestDB, "foo")
+	args := initFetcherArgs{tableDesc: tableDesc}
+	expectedSpec := makeIndexFetchSpec(t, args)
+
+	for _, tc := range []struct {
+		strength descpb.ScanLockingStrength
+		expected lock.Strength
+	}{
+		{strength: descpb.ScanLockingStrength_FOR_NONE, expected: lock.None},
+		{strength: descpb.ScanLockingStrength_FOR_SHARE, expected: lock.None},
+		{strength: descpb.ScanLockingStrength_FOR_NO_KEY_UPDATE, expected: lock.Exclusive},
+		{strength: descpb.ScanLockingStrength_FOR_UPDATE, expected: lock.Exclusive},
+	} {
+		t.Run(tc.strength.String(), func(t *testing.T) {
+			spec := makeIndexFetchSpec(t, args)
+			var fetcher Fetcher
+			require.NoError(t, fetcher.Init(
+				ctx,
+				FetcherInitArgs{
+					LockStrength: tc.strength,
+					Alloc:        &tree.DatumAlloc{},
+					Spec:         &spec,
+				},
+			))
+			require.True(t, expectedSpec.Equal(&spec))
+
+			kvFetcher, ok := fetcher.kvFetcher.KVBatchFetcher.(*txnKVFetcher)
+			require.True(t, ok)
+			require.Equal(t, tc.expected, kvFetcher.lockStrength)
+
+			spans := roachpb.Spans{
+				{Key: roachpb.Key("a"), EndKey: roachpb.Key("b")},
+				{Key: roachpb.Key("c")},
+			}
+			for _, reverse := range []bool{false, true} {
+				reqs := spansToRequests(spans, kvpb.BATCH_RESPONSE, reverse, kvFetcher.lockStrength, nil /* reqsScratch */)
+				require.Len(t, reqs, len(spans))
+				for _, req := range reqs {
+					switch r := req.GetInner().(type) {
+					case *kvpb.ScanRequest:
+						require.Equal(t, tc.expected, r.KeyLocking)
+					case *kvpb.ReverseScanRequest:
+						require.Equal(t, tc.expected, r.KeyLocking)
+					case *kvpb.GetRequest:
+						require.Equal(t, tc.expected, r.KeyLocking)
+					default:
+						t.Fatalf("unexpected request %s", r.Method())
+					}
+				}
+			}
+		})
+	}
+}
+
 func TestFetcherUninitialized(t *testing.T) {
 	// Regression test for #39013: make sure it's okay to call GetBytesReader even
 	// before the fetcher was fully initialized.
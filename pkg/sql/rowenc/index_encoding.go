@@ -11,6 +11,7 @@
 package rowenc
 
 import (
+	"bytes"
 	"context"
 	"sort"
 	"unsafe"
@@ -53,6 +54,15 @@ func MakeIndexKeyPrefix(codec keys.SQLCodec, tableID descpb.ID, indexID descpb.I
 	return codec.IndexPrefix(uint32(tableID), uint32(indexID))
 }
 
+// IndexKeyPrefixLength returns the length of the key prefix used for the
+// index's data; it is equal to len(MakeIndexKeyPrefix(codec, tableID, indexID))
+// but it doesn't allocate.
+func IndexKeyPrefixLength(codec keys.SQLCodec, tableID descpb.ID, indexID descpb.IndexID) int {
+	return len(codec.TenantPrefix()) +
+		encoding.EncodedLengthUvarintAscending(uint64(tableID)) +
+		encoding.EncodedLengthUvarintAscending(uint64(indexID))
+}
+
 // EncodeIndexKey creates a key by concatenating keyPrefix with the encodings of
 // the index key columns, and returns the key and whether any of the encoded
 // values were NULLs.
@@ -131,6 +141,95 @@ func EncodePartialIndexKey(
 	return key, containsNull, nil
 }
 
+// EncodeIndexKeyFromFetchSpec creates the key of an index entry by
+// concatenating keyPrefix with the encodings of the given values, using the
+// column order and directions described by spec.KeyAndSuffixColumns. vals must
+// contain a value for each of the key and suffix columns, in that order.
+//
+// As in EncodeSecondaryIndex, the suffix columns are only encoded if the index
+// is not unique or if one of the key columns is NULL. For primary indexes, the
+// result doesn't include the column family suffix (see keys.MakeFamilyKey).
+// Inverted indexes are not supported.
+func EncodeIndexKeyFromFetchSpec(
+	spec *fetchpb.IndexFetchSpec, vals []tree.Datum, keyPrefix []byte,
+) ([]byte, error) {
+	if len(vals) != len(spec.KeyAndSuffixColumns) {
+		return nil, errors.AssertionFailedf(
+			"expected %d values for index %s, got %d",
+			len(spec.KeyAndSuffixColumns), spec.IndexName, len(vals),
+		)
+	}
+	key := growKey(keyPrefix, len(keyPrefix)+2*len(vals))
+	numKeyCols := len(spec.KeyAndSuffixColumns) - int(spec.NumKeySuffixColumns)
+	containsNull := false
+	for i := range spec.KeyAndSuffixColumns {
+		c := &spec.KeyAndSuffixColumns[i]
+		if c.IsInverted {
+			return nil, errors.AssertionFailedf(
+				"cannot encode key of inverted index %s", spec.IndexName,
+			)
+		}
+		if i == numKeyCols && spec.IsUniqueIndex && !containsNull {
+			// The suffix columns are not part of the key of a unique index.
+			break
+		}
+		if vals[i] == tree.DNull {
+			containsNull = true
+		}
+		var err error
+		if key, err = keyside.Encode(key, vals[i], c.EncodingDirection()); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// MakeSpanForPrefix returns the span of the index described by spec which
+// contains all the index entries whose first key columns have the given
+// values. The values are encoded using the directions of the key columns; an
+// empty prefix results in a span for the entire index, and a prefix which
+// contains all the key columns (see IndexFetchSpec.KeyFullColumns) results in
+// a span for a single row (including all its column families).
+//
+// The key suffix columns of a unique index can only be part of the prefix if
+// one of the key columns is NULL, since they are otherwise not encoded in the
+// key. Inverted indexes are not supported.
+func MakeSpanForPrefix(
+	spec *fetchpb.IndexFetchSpec, codec keys.SQLCodec, prefix tree.Datums,
+) (roachpb.Span, error) {
+	if len(prefix) > len(spec.KeyAndSuffixColumns) {
+		return roachpb.Span{}, errors.AssertionFailedf(
+			"prefix of %d values is longer than the %d key columns of index %s",
+			len(prefix), len(spec.KeyAndSuffixColumns), spec.IndexName,
+		)
+	}
+	key := roachpb.Key(MakeIndexKeyPrefix(codec, spec.TableID, spec.IndexID))
+	numKeyCols := len(spec.KeyAndSuffixColumns) - int(spec.NumKeySuffixColumns)
+	containsNull := false
+	for i, val := range prefix {
+		c := &spec.KeyAndSuffixColumns[i]
+		if c.IsInverted {
+			return roachpb.Span{}, errors.AssertionFailedf(
+				"cannot encode key of inverted index %s", spec.IndexName,
+			)
+		}
+		if i == numKeyCols && spec.IsUniqueIndex && !containsNull {
+			return roachpb.Span{}, errors.AssertionFailedf(
+				"prefix includes key suffix column %s of unique index %s without a NULL key column",
+				c.Name, spec.IndexName,
+			)
+		}
+		if val == tree.DNull {
+			containsNull = true
+		}
+		var err error
+		if key, err = keyside.Encode(key, val, c.EncodingDirection()); err != nil {
+			return roachpb.Span{}, err
+		}
+	}
+	return roachpb.Span{Key: key, EndKey: key.PrefixEnd()}, nil
+}
+
 type Directions []catenumpb.IndexColumn_Direction
 
 func (d Directions) Get(i int) (encoding.Direction, error) {
@@ -509,6 +608,324 @@ func DecodeKeyValsUsingSpec(
 	return key, foundNull, nil
 }
 
+// DecodeKeyToDatumsUsingSpec decodes the values of the first len(dst) key
+// columns (see IndexFetchSpec.KeyAndSuffixColumns) from the given key of the
+// index described by spec, using the types and directions of the columns, and
+// stores them in dst. It returns the rest of the key (e.g. the column family
+// suffix).
+//
+// The key suffix columns of a unique index can only be decoded if one of the
+// key columns is NULL, since they are otherwise not encoded in the key. Note
+// that the value of a composite column decoded from the key might differ from
+// the value in the row (e.g. the key encoding of a decimal doesn't preserve its
+// scale), and that the value of the inverted column of an inverted index is the
+// encoded inverted key (a DEncodedKey).
+func DecodeKeyToDatumsUsingSpec(
+	spec *fetchpb.IndexFetchSpec,
+	codec keys.SQLCodec,
+	key roachpb.Key,
+	dst tree.Datums,
+	a *tree.DatumAlloc,
+) (remaining []byte, _ error) {
+	if len(dst) > len(spec.KeyAndSuffixColumns) {
+		return nil, errors.AssertionFailedf(
+			"cannot decode %d values from the %d key columns of index %s",
+			len(dst), len(spec.KeyAndSuffixColumns), spec.IndexName,
+		)
+	}
+	prefix := MakeIndexKeyPrefix(codec, spec.TableID, spec.IndexID)
+	if !bytes.HasPrefix(key, prefix) {
+		return nil, errors.AssertionFailedf(
+			"key %s is not a key of index %s of table %s", key, spec.IndexName, spec.TableName,
+		)
+	}
+	remaining = key[len(prefix):]
+	numKeyCols := len(spec.KeyAndSuffixColumns) - int(spec.NumKeySuffixColumns)
+	containsNull := false
+	for i := range dst {
+		c := &spec.KeyAndSuffixColumns[i]
+		if i == numKeyCols && spec.IsUniqueIndex && !containsNull {
+			return nil, errors.AssertionFailedf(
+				"key suffix column %s of unique index %s is not encoded in key %s",
+				c.Name, spec.IndexName, key,
+			)
+		}
+		var err error
+		if dst[i], remaining, err = keyside.Decode(a, c.Type, remaining, c.EncodingDirection()); err != nil {
+			return nil, err
+		}
+		containsNull = containsNull || dst[i] == tree.DNull
+	}
+	return remaining, nil
+}
+
+// DecodeRawKey decodes a raw key of the given table (e.g. a range boundary shown
+// by SHOW RANGES) using the index whose ID is encoded in the key. It returns the
+// index and the values of the key columns that are encoded in the key, in the
+// order of IndexFetchSpec.KeyAndSuffixColumns. The key can be a prefix of an
+// index key, in which case only the columns that it contains are decoded. The
+// key suffix columns of a unique secondary index are only decoded if they are
+// encoded in the key (i.e. if one of the key columns is NULL). Any column family
+// suffix is ignored.
+//
+// Don't use this function in the scan "hot path".
+func DecodeRawKey(
+	codec keys.SQLCodec, table catalog.TableDescriptor, key roachpb.Key,
+) (index catalog.Index, datums tree.Datums, err error) {
+	indexID, remaining, err := DecodeIndexKeyPrefix(codec, table.GetID(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	index, err = catalog.MustFindIndexByID(table, indexID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var spec fetchpb.IndexFetchSpec
+	if err := InitIndexFetchSpecKeyOnly(&spec, codec, table, index, nil /* fetchColumnIDs */); err != nil {
+		return nil, nil, err
+	}
+	keyCols := spec.KeyColumns()
+	suffixInKey := !spec.IsUniqueIndex
+	var a tree.DatumAlloc
+	for _, c := range spec.KeyFullColumns() {
+		if len(datums) == len(keyCols) && !suffixInKey {
+			break
+		}
+		if len(remaining) == 0 {
+			break
+		}
+		var d tree.Datum
+		if d, remaining, err = keyside.Decode(&a, c.Type, remaining, c.EncodingDirection()); err != nil {
+			return nil, nil, errors.Wrapf(err, "decoding column %s of index %s", c.Name, index.GetName())
+		}
+		suffixInKey = suffixInKey || d == tree.DNull
+		datums = append(datums, d)
+	}
+	return index, datums, nil
+}
+
+// KVDecoder decodes the columns of a KV of the index described by an
+// IndexFetchSpec one at a time (see Next), so that a caller which only needs the
+// first few columns of a wide row can stop early without decoding the rest. It
+// decodes the columns in the order in which they are encoded: first the key
+// columns (see DecodeKeyToDatumsUsingSpec), then the key suffix columns of a
+// unique secondary index which are encoded in the value, and finally the
+// fetched columns that are encoded in the value. Value columns which are not
+// fetched are skipped, since their types are not known. A composite key column
+// which is fetched is returned twice, and the value decoded from the KV value is
+// the authoritative one.
+//
+// KVs of temporary indexes (see IndexFetchSpec.IsTemporaryIndex) are not
+// supported.
+type KVDecoder struct {
+	spec  *fetchpb.IndexFetchSpec
+	alloc *tree.DatumAlloc
+	value roachpb.Value
+	state kvDecoderState
+
+	// key is the rest of the key after the columns that were decoded.
+	key []byte
+	// keyColIdx is the index in KeyAndSuffixColumns of the next column to
+	// decode.
+	keyColIdx int
+	// suffixInKey is set if the key suffix columns of a unique index are encoded
+	// in the key (because one of the key columns is NULL).
+	suffixInKey bool
+	// valueSuffixIdx is the index in KeySuffixColumns of the next key suffix
+	// column to decode from the value of a unique secondary index.
+	valueSuffixIdx int
+	// valueBytes is the rest of the value after the columns that were decoded.
+	valueBytes []byte
+	lastColID  descpb.ColumnID
+}
+
+type kvDecoderState int
+
+const (
+	kvDecoderKey kvDecoderState = iota
+	kvDecoderValueStart
+	kvDecoderValueSuffix
+	kvDecoderValueTuple
+	kvDecoderDone
+)
+
+// NewKVDecoder returns a KVDecoder for the given KV of the index described by
+// spec. The datums are allocated with the given DatumAlloc.
+func NewKVDecoder(
+	spec *fetchpb.IndexFetchSpec, codec keys.SQLCodec, kv roachpb.KeyValue, a *tree.DatumAlloc,
+) (*KVDecoder, error) {
+	if spec.IsTemporaryIndex {
+		return nil, errors.AssertionFailedf(
+			"cannot decode KVs of temporary index %s of table %s", spec.IndexName, spec.TableName,
+		)
+	}
+	prefix := MakeIndexKeyPrefix(codec, spec.TableID, spec.IndexID)
+	if !bytes.HasPrefix(kv.Key, prefix) {
+		return nil, errors.AssertionFailedf(
+			"key %s is not a key of index %s of table %s", kv.Key, spec.IndexName, spec.TableName,
+		)
+	}
+	return &KVDecoder{spec: spec, alloc: a, value: kv.Value, key: kv.Key[len(prefix):]}, nil
+}
+
+// Next decodes the next column of the KV and returns its ID and value. done is
+// true (and the other results are unset) once all the columns have been
+// decoded.
+func (d *KVDecoder) Next() (colID descpb.ColumnID, datum tree.Datum, done bool, err error) {
+	for {
+		switch d.state {
+		case kvDecoderKey:
+			numKeyCols := len(d.spec.KeyAndSuffixColumns) - int(d.spec.NumKeySuffixColumns)
+			if d.keyColIdx == len(d.spec.KeyAndSuffixColumns) ||
+				(d.keyColIdx == numKeyCols && d.spec.IsUniqueIndex && !d.suffixInKey) {
+				d.state = kvDecoderValueStart
+				continue
+			}
+			c := &d.spec.KeyAndSuffixColumns[d.keyColIdx]
+			if datum, d.key, err = keyside.Decode(d.alloc, c.Type, d.key, c.EncodingDirection()); err != nil {
+				return 0, nil, false, err
+			}
+			d.keyColIdx++
+			if d.keyColIdx <= numKeyCols && datum == tree.DNull {
+				d.suffixInKey = true
+			}
+			return c.ColumnID, datum, false, nil
+
+		case kvDecoderValueStart:
+			if err := d.startValue(); err != nil {
+				return 0, nil, false, err
+			}
+			if d.state == kvDecoderValueStart {
+				// The value is a single column value.
+				colID, datum, err = d.decodeSingleValue()
+				d.state = kvDecoderDone
+				if err != nil || datum != nil {
+					return colID, datum, false, err
+				}
+			}
+
+		case kvDecoderValueSuffix:
+			suffixCols := d.spec.KeySuffixColumns()
+			if d.valueSuffixIdx == len(suffixCols) {
+				d.state = kvDecoderValueTuple
+				continue
+			}
+			// The key suffix columns are always encoded at the start of the value
+			// of a unique index, even if they are also encoded in the key (in which
+			// case they were already returned).
+			c := &suffixCols[d.valueSuffixIdx]
+			if datum, d.valueBytes, err = keyside.Decode(
+				d.alloc, c.Type, d.valueBytes, c.EncodingDirection(),
+			); err != nil {
+				return 0, nil, false, err
+			}
+			d.valueSuffixIdx++
+			if !d.suffixInKey {
+				return c.ColumnID, datum, false, nil
+			}
+
+		case kvDecoderValueTuple:
+			for len(d.valueBytes) > 0 {
+				var dataOffset int
+				var colIDDelta uint32
+				var typ encoding.Type
+				if _, dataOffset, colIDDelta, typ, err = encoding.DecodeValueTag(d.valueBytes); err != nil {
+					return 0, nil, false, err
+				}
+				colID = d.lastColID + descpb.ColumnID(colIDDelta)
+				d.lastColID = colID
+				colType := d.fetchedColumnType(colID)
+				if colType == nil {
+					// The column is not fetched, so read its length and skip it.
+					var n int
+					if n, err = encoding.PeekValueLengthWithOffsetsAndType(d.valueBytes, dataOffset, typ); err != nil {
+						return 0, nil, false, err
+					}
+					d.valueBytes = d.valueBytes[n:]
+					continue
+				}
+				if datum, d.valueBytes, err = valueside.Decode(d.alloc, colType, d.valueBytes); err != nil {
+					return 0, nil, false, err
+				}
+				return colID, datum, false, nil
+			}
+			d.state = kvDecoderDone
+
+		default:
+			return 0, nil, true, nil
+		}
+	}
+}
+
+// startValue prepares the decoding of the value once the key has been decoded.
+// It leaves the state unchanged if the value is a single column value.
+func (d *KVDecoder) startValue() (err error) {
+	switch d.value.GetTag() {
+	case roachpb.ValueType_UNKNOWN:
+		// The value is empty (e.g. the sentinel of a row with no non-NULL column
+		// in a family).
+		d.state = kvDecoderDone
+		return nil
+	case roachpb.ValueType_TUPLE:
+		d.valueBytes, err = d.value.GetTuple()
+		d.state = kvDecoderValueTuple
+		return err
+	case roachpb.ValueType_BYTES:
+		if d.spec.EncodingType == catenumpb.SecondaryIndexEncoding {
+			d.valueBytes, err = d.value.GetBytes()
+			d.state = kvDecoderValueTuple
+			if d.spec.IsUniqueIndex {
+				d.state = kvDecoderValueSuffix
+			}
+			return err
+		}
+	}
+	if d.spec.EncodingType == catenumpb.SecondaryIndexEncoding {
+		return errors.AssertionFailedf(
+			"unexpected value type %s for index %s of table %s",
+			d.value.GetTag(), d.spec.IndexName, d.spec.TableName,
+		)
+	}
+	return nil
+}
+
+// decodeSingleValue decodes the value of a primary index KV which only encodes
+// the default column of its family. It returns a nil datum if the column is not
+// fetched.
+func (d *KVDecoder) decodeSingleValue() (descpb.ColumnID, tree.Datum, error) {
+	_, familyID, err := encoding.DecodeUvarintAscending(d.key)
+	if err != nil {
+		return 0, nil, err
+	}
+	colID, ok := d.spec.DefaultColumnForFamily(descpb.FamilyID(familyID))
+	if !ok {
+		return 0, nil, errors.AssertionFailedf(
+			"single entry value with no default column id for family %d of table %s",
+			familyID, d.spec.TableName,
+		)
+	}
+	colType := d.fetchedColumnType(colID)
+	if colType == nil {
+		return 0, nil, nil
+	}
+	datum, err := valueside.UnmarshalLegacy(d.alloc, colType, d.value)
+	if err != nil {
+		return 0, nil, err
+	}
+	return colID, datum, nil
+}
+
+// fetchedColumnType returns the type of the given fetched column, or nil if the
+// column is not fetched.
+func (d *KVDecoder) fetchedColumnType(colID descpb.ColumnID) *types.T {
+	for i := range d.spec.FetchedColumns {
+		if c := &d.spec.FetchedColumns[i]; c.ColumnID == colID {
+			return c.Type
+		}
+	}
+	return nil
+}
+
 // IndexEntry represents an encoded key/value for an index entry.
 type IndexEntry struct {
 	Key   roachpb.Key
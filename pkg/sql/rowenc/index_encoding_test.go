@@ -17,6 +17,7 @@ import (
 	"sort"
 	"testing"
 
+	"github.com/cockroachdb/cockroach/pkg/base"
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/kv"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
@@ -25,15 +26,22 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/catenumpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/colinfo"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/desctestutils"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/fetchpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/tabledesc"
 	"github.com/cockroachdb/cockroach/pkg/sql/inverted"
 	"github.com/cockroachdb/cockroach/pkg/sql/parser"
 	"github.com/cockroachdb/cockroach/pkg/sql/randgen"
 	. "github.com/cockroachdb/cockroach/pkg/sql/rowenc"
+	"github.com/cockroachdb/cockroach/pkg/sql/rowenc/keyside"
+	"github.com/cockroachdb/cockroach/pkg/sql/rowenc/valueside"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/eval"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
 	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/testutils/serverutils"
+	"github.com/cockroachdb/cockroach/pkg/testutils/sqlutils"
 	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/encoding"
 	"github.com/cockroachdb/cockroach/pkg/util/json"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/randutil"
@@ -1258,3 +1266,606 @@ func TestDecodeKeyVals(t *testing.T) {
 		})
 	}
 }
+
+func TestIndexKeyPrefixLength(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	codecs := []keys.SQLCodec{
+		keys.SystemSQLCodec,
+		keys.MakeSQLCodec(roachpb.MustMakeTenantID(5)),
+		keys.MakeSQLCodec(roachpb.MustMakeTenantID(1 << 20)),
+	}
+	ids := []uint64{1, 2, 100, 108, 109, 255, 256, 1 << 16, 1<<24 - 1, 1 << 31}
+	for _, codec := range codecs {
+		for _, tableID := range ids {
+			for _, indexID := range ids {
+				expected := len(MakeIndexKeyPrefix(codec, descpb.ID(tableID), descpb.IndexID(indexID)))
+				actual := IndexKeyPrefixLength(codec, descpb.ID(tableID), descpb.IndexID(indexID))
+				require.Equalf(t, expected, actual, "codec: %s, table: %d, index: %d",
+					codec.TenantPrefix(), tableID, indexID)
+			}
+		}
+	}
+}
+
+func TestEncodeIndexKeyFromFetchSpec(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	// CREATE TABLE t (
+	//   a INT, b STRING, c INT,
+	//   PRIMARY KEY (a DESC, b),
+	//   INDEX c_desc (c DESC, b),
+	//   UNIQUE INDEX uc (c)
+	// )
+	asc, desc := catenumpb.IndexColumn_ASC, catenumpb.IndexColumn_DESC
+	tableDesc := descpb.TableDescriptor{
+		ID:   100,
+		Name: "t",
+		Columns: []descpb.ColumnDescriptor{
+			{ID: 1, Name: "a", Type: types.Int},
+			{ID: 2, Name: "b", Type: types.String},
+			{ID: 3, Name: "c", Type: types.Int, Nullable: true},
+		},
+		Families: []descpb.ColumnFamilyDescriptor{{
+			ID:          0,
+			Name:        "primary",
+			ColumnIDs:   []descpb.ColumnID{1, 2, 3},
+			ColumnNames: []string{"a", "b", "c"},
+		}},
+		PrimaryIndex: descpb.IndexDescriptor{
+			ID:                  1,
+			Name:                "t_pkey",
+			Unique:              true,
+			KeyColumnIDs:        []descpb.ColumnID{1, 2},
+			KeyColumnNames:      []string{"a", "b"},
+			KeyColumnDirections: []catenumpb.IndexColumn_Direction{desc, asc},
+			StoreColumnIDs:      []descpb.ColumnID{3},
+			StoreColumnNames:    []string{"c"},
+			EncodingType:        catenumpb.PrimaryIndexEncoding,
+		},
+		Indexes: []descpb.IndexDescriptor{{
+			ID:                  2,
+			Name:                "c_desc",
+			KeyColumnIDs:        []descpb.ColumnID{3, 2},
+			KeyColumnNames:      []string{"c", "b"},
+			KeyColumnDirections: []catenumpb.IndexColumn_Direction{desc, asc},
+			KeySuffixColumnIDs:  []descpb.ColumnID{1},
+		}, {
+			ID:                  3,
+			Name:                "uc",
+			Unique:              true,
+			KeyColumnIDs:        []descpb.ColumnID{3},
+			KeyColumnNames:      []string{"c"},
+			KeyColumnDirections: []catenumpb.IndexColumn_Direction{asc},
+			KeySuffixColumnIDs:  []descpb.ColumnID{1, 2},
+		}},
+	}
+	table := tabledesc.NewBuilder(&tableDesc).BuildImmutableTable()
+	var colMap catalog.TableColMap
+	for i, col := range table.PublicColumns() {
+		colMap.Set(col.GetID(), i)
+	}
+
+	codec := keys.SystemSQLCodec
+	for _, c := range []struct{ a, c tree.Datum }{
+		{a: tree.NewDInt(1), c: tree.NewDInt(10)},
+		{a: tree.NewDInt(-5), c: tree.NewDInt(-7)},
+		{a: tree.NewDInt(3), c: tree.DNull},
+	} {
+		row := tree.Datums{c.a, tree.NewDString("foo"), c.c}
+		for _, index := range table.ActiveIndexes() {
+			t.Run(fmt.Sprintf("%s/%s", index.GetName(), tree.AsString(&row)), func(t *testing.T) {
+				var spec fetchpb.IndexFetchSpec
+				require.NoError(t, InitIndexFetchSpec(&spec, codec, table, index, nil /* fetchColumnIDs */))
+
+				vals := make([]tree.Datum, len(spec.KeyAndSuffixColumns))
+				for i := range spec.KeyAndSuffixColumns {
+					vals[i] = row[colMap.GetDefault(spec.KeyAndSuffixColumns[i].ColumnID)]
+				}
+				keyPrefix := MakeIndexKeyPrefix(codec, table.GetID(), index.GetID())
+				key, err := EncodeIndexKeyFromFetchSpec(&spec, vals, keyPrefix)
+				require.NoError(t, err)
+
+				// The key must match the one produced by the write path.
+				var entries []IndexEntry
+				expectedKey := key
+				if index.Primary() {
+					entries, err = EncodePrimaryIndex(codec, table, index, colMap, row, true /* includeEmpty */)
+					expectedKey = keys.MakeFamilyKey(append([]byte(nil), key...), 0)
+				} else {
+					entries, err = EncodeSecondaryIndex(codec, table, index, colMap, row, true /* includeEmpty */)
+				}
+				require.NoError(t, err)
+				require.Len(t, entries, 1)
+				require.Equal(t, roachpb.Key(expectedKey), entries[0].Key)
+
+				// Decode the key the same way the fetchers do.
+				numVals := len(spec.KeyFullColumns())
+				if spec.IsUniqueIndex && c.c == tree.DNull {
+					numVals = len(spec.KeyAndSuffixColumns)
+				}
+				decoded := make([]EncDatum, numVals)
+				rem, _, err := DecodeKeyValsUsingSpec(
+					spec.KeyAndSuffixColumns, key[spec.KeyPrefixLength:], decoded,
+				)
+				require.NoError(t, err)
+				require.Empty(t, rem)
+				var da tree.DatumAlloc
+				for i := range decoded {
+					require.NoError(t, decoded[i].EnsureDecoded(spec.KeyAndSuffixColumns[i].Type, &da))
+					require.Equal(t, vals[i].String(), decoded[i].Datum.String())
+				}
+			})
+		}
+	}
+
+	// Inverted indexes are not supported, and a value must be provided for each
+	// key and suffix column.
+	spec := fetchpb.IndexFetchSpec{
+		IndexName: "inv",
+		KeyAndSuffixColumns: []fetchpb.IndexFetchSpec_KeyColumn{
+			{IndexFetchSpec_Column: fetchpb.IndexFetchSpec_Column{Type: types.EncodedKey}, IsInverted: true},
+		},
+	}
+	_, err := EncodeIndexKeyFromFetchSpec(&spec, []tree.Datum{tree.NewDBytes("x")}, nil /* keyPrefix */)
+	require.ErrorContains(t, err, "cannot encode key of inverted index inv")
+	_, err = EncodeIndexKeyFromFetchSpec(&spec, nil /* vals */, nil /* keyPrefix */)
+	require.ErrorContains(t, err, "expected 1 values for index inv, got 0")
+}
+
+func TestDecodeKeyToDatumsUsingSpec(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	// CREATE TABLE t (
+	//   k INT PRIMARY KEY, a INT, b DECIMAL, c STRING,
+	//   INDEX mixed (a DESC, b, c DESC),
+	//   UNIQUE INDEX ua (a)
+	// )
+	asc, desc := catenumpb.IndexColumn_ASC, catenumpb.IndexColumn_DESC
+	tableDesc := descpb.TableDescriptor{
+		ID:   100,
+		Name: "t",
+		Columns: []descpb.ColumnDescriptor{
+			{ID: 1, Name: "k", Type: types.Int},
+			{ID: 2, Name: "a", Type: types.Int, Nullable: true},
+			{ID: 3, Name: "b", Type: types.Decimal, Nullable: true},
+			{ID: 4, Name: "c", Type: types.String, Nullable: true},
+		},
+		Families: []descpb.ColumnFamilyDescriptor{{
+			ID:          0,
+			Name:        "primary",
+			ColumnIDs:   []descpb.ColumnID{1, 2, 3, 4},
+			ColumnNames: []string{"k", "a", "b", "c"},
+		}},
+		PrimaryIndex: descpb.IndexDescriptor{
+			ID:                  1,
+			Name:                "t_pkey",
+			Unique:              true,
+			KeyColumnIDs:        []descpb.ColumnID{1},
+			KeyColumnNames:      []string{"k"},
+			KeyColumnDirections: []catenumpb.IndexColumn_Direction{asc},
+			StoreColumnIDs:      []descpb.ColumnID{2, 3, 4},
+			StoreColumnNames:    []string{"a", "b", "c"},
+			EncodingType:        catenumpb.PrimaryIndexEncoding,
+		},
+		Indexes: []descpb.IndexDescriptor{{
+			ID:                  2,
+			Name:                "mixed",
+			KeyColumnIDs:        []descpb.ColumnID{2, 3, 4},
+			KeyColumnNames:      []string{"a", "b", "c"},
+			KeyColumnDirections: []catenumpb.IndexColumn_Direction{desc, asc, desc},
+			KeySuffixColumnIDs:  []descpb.ColumnID{1},
+			CompositeColumnIDs:  []descpb.ColumnID{3},
+		}, {
+			ID:                  3,
+			Name:                "ua",
+			Unique:              true,
+			KeyColumnIDs:        []descpb.ColumnID{2},
+			KeyColumnNames:      []string{"a"},
+			KeyColumnDirections: []catenumpb.IndexColumn_Direction{asc},
+			KeySuffixColumnIDs:  []descpb.ColumnID{1},
+		}},
+	}
+	table := tabledesc.NewBuilder(&tableDesc).BuildImmutableTable()
+	var colMap catalog.TableColMap
+	for i, col := range table.PublicColumns() {
+		colMap.Set(col.GetID(), i)
+	}
+	codec := keys.SystemSQLCodec
+	// indexKey returns the spec and the key of the given row in the given index.
+	indexKey := func(name string, row tree.Datums) (*fetchpb.IndexFetchSpec, roachpb.Key) {
+		index, err := catalog.MustFindIndexByName(table, name)
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, InitIndexFetchSpec(&spec, codec, table, index, nil /* fetchColumnIDs */))
+		entries, err := EncodeSecondaryIndex(codec, table, index, colMap, row, true /* includeEmpty */)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		return &spec, entries[0].Key
+	}
+	dec, err := tree.ParseDDecimal("1.50")
+	require.NoError(t, err)
+	row := tree.Datums{tree.NewDInt(1), tree.NewDInt(5), dec, tree.NewDString("foo")}
+
+	var da tree.DatumAlloc
+	spec, key := indexKey("mixed", row)
+	full := make(tree.Datums, len(spec.KeyFullColumns()))
+	rem, err := DecodeKeyToDatumsUsingSpec(spec, codec, key, full, &da)
+	require.NoError(t, err)
+	// The key encoding of the (composite) decimal doesn't preserve its scale.
+	require.Equal(t, "(5, 1.5, 'foo', 1)", tree.AsString(&full))
+	keyOnly, err := EncodeIndexKeyFromFetchSpec(
+		spec, tree.Datums{row[1], row[2], row[3], row[0]}, MakeIndexKeyPrefix(codec, 100, 2),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []byte(key[len(keyOnly):]), rem)
+
+	// Decode a prefix of the key columns.
+	prefix := make(tree.Datums, 2)
+	prefixRem, err := DecodeKeyToDatumsUsingSpec(spec, codec, key, prefix, &da)
+	require.NoError(t, err)
+	require.Equal(t, "(5, 1.5)", tree.AsString(&prefix))
+	require.True(t, bytes.HasSuffix(prefixRem, rem))
+	c, _, err := keyside.Decode(&da, types.String, prefixRem, encoding.Descending)
+	require.NoError(t, err)
+	require.Equal(t, "'foo'", c.String())
+
+	// Too many values.
+	_, err = DecodeKeyToDatumsUsingSpec(spec, codec, key, make(tree.Datums, 5), &da)
+	require.ErrorContains(t, err, "cannot decode 5 values from the 4 key columns of index mixed")
+
+	// The key suffix of a unique index is only in the key if a key column is
+	// NULL.
+	uaSpec, uaKey := indexKey("ua", row)
+	_, err = DecodeKeyToDatumsUsingSpec(uaSpec, codec, uaKey, make(tree.Datums, 2), &da)
+	require.ErrorContains(t, err, "key suffix column k of unique index ua is not encoded in key")
+	nullRow := tree.Datums{tree.NewDInt(2), tree.DNull, tree.DNull, tree.DNull}
+	uaSpec, uaKey = indexKey("ua", nullRow)
+	withSuffix := make(tree.Datums, 2)
+	_, err = DecodeKeyToDatumsUsingSpec(uaSpec, codec, uaKey, withSuffix, &da)
+	require.NoError(t, err)
+	require.Equal(t, "(NULL, 2)", tree.AsString(&withSuffix))
+
+	// The key must belong to the index.
+	_, err = DecodeKeyToDatumsUsingSpec(uaSpec, codec, key, make(tree.Datums, 1), &da)
+	require.ErrorContains(t, err, "is not a key of index ua of table t")
+}
+
+func TestKVDecoder(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	// CREATE TABLE t (
+	//   k INT PRIMARY KEY, c1 INT, ..., c10 INT,
+	//   UNIQUE INDEX ua (c1) STORING (c2)
+	// )
+	const numValueCols = 10
+	tableDesc := descpb.TableDescriptor{
+		ID:      100,
+		Name:    "t",
+		Columns: []descpb.ColumnDescriptor{{ID: 1, Name: "k", Type: types.Int}},
+		Families: []descpb.ColumnFamilyDescriptor{{
+			ID: 0, Name: "primary", ColumnIDs: []descpb.ColumnID{1}, ColumnNames: []string{"k"},
+		}},
+		PrimaryIndex: descpb.IndexDescriptor{
+			ID:                  1,
+			Name:                "t_pkey",
+			Unique:              true,
+			KeyColumnIDs:        []descpb.ColumnID{1},
+			KeyColumnNames:      []string{"k"},
+			KeyColumnDirections: []catenumpb.IndexColumn_Direction{catenumpb.IndexColumn_ASC},
+			EncodingType:        catenumpb.PrimaryIndexEncoding,
+		},
+		Indexes: []descpb.IndexDescriptor{{
+			ID:                  2,
+			Name:                "ua",
+			Unique:              true,
+			KeyColumnIDs:        []descpb.ColumnID{2},
+			KeyColumnNames:      []string{"c1"},
+			KeyColumnDirections: []catenumpb.IndexColumn_Direction{catenumpb.IndexColumn_ASC},
+			KeySuffixColumnIDs:  []descpb.ColumnID{1},
+			StoreColumnIDs:      []descpb.ColumnID{3},
+			StoreColumnNames:    []string{"c2"},
+		}},
+	}
+	row := tree.Datums{tree.NewDInt(1)}
+	for i := 1; i <= numValueCols; i++ {
+		id, name := descpb.ColumnID(i+1), fmt.Sprintf("c%d", i)
+		tableDesc.Columns = append(tableDesc.Columns, descpb.ColumnDescriptor{
+			ID: id, Name: name, Type: types.Int, Nullable: true,
+		})
+		tableDesc.Families[0].ColumnIDs = append(tableDesc.Families[0].ColumnIDs, id)
+		tableDesc.Families[0].ColumnNames = append(tableDesc.Families[0].ColumnNames, name)
+		tableDesc.PrimaryIndex.StoreColumnIDs = append(tableDesc.PrimaryIndex.StoreColumnIDs, id)
+		tableDesc.PrimaryIndex.StoreColumnNames = append(tableDesc.PrimaryIndex.StoreColumnNames, name)
+		row = append(row, tree.NewDInt(tree.DInt(i*10)))
+	}
+	table := tabledesc.NewBuilder(&tableDesc).BuildImmutableTable()
+	var colMap catalog.TableColMap
+	var allColIDs []descpb.ColumnID
+	for i, col := range table.PublicColumns() {
+		colMap.Set(col.GetID(), i)
+		allColIDs = append(allColIDs, col.GetID())
+	}
+	codec := keys.SystemSQLCodec
+	var da tree.DatumAlloc
+
+	// next returns the next column of the decoder as "id:datum".
+	next := func(d *KVDecoder) (string, bool) {
+		colID, datum, done, err := d.Next()
+		require.NoError(t, err)
+		if done {
+			return "", false
+		}
+		return fmt.Sprintf("%d:%s", colID, datum), true
+	}
+	decodeAll := func(d *KVDecoder) []string {
+		var res []string
+		for {
+			col, ok := next(d)
+			if !ok {
+				return res
+			}
+			res = append(res, col)
+		}
+	}
+	primaryKV := func() roachpb.KeyValue {
+		entries, err := EncodePrimaryIndex(codec, table, table.GetPrimaryIndex(), colMap, row, true /* includeEmpty */)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		return roachpb.KeyValue{Key: entries[0].Key, Value: entries[0].Value}
+	}
+
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, InitIndexFetchSpec(&spec, codec, table, table.GetPrimaryIndex(), allColIDs))
+	d, err := NewKVDecoder(&spec, codec, primaryKV(), &da)
+	require.NoError(t, err)
+	expected := []string{"1:1"}
+	for i := 1; i <= numValueCols; i++ {
+		expected = append(expected, fmt.Sprintf("%d:%d", i+1, i*10))
+	}
+	require.Equal(t, expected, decodeAll(d))
+
+	// The columns which are not fetched are skipped.
+	require.NoError(t, InitIndexFetchSpec(
+		&spec, codec, table, table.GetPrimaryIndex(), []descpb.ColumnID{1, numValueCols + 1},
+	))
+	d, err = NewKVDecoder(&spec, codec, primaryKV(), &da)
+	require.NoError(t, err)
+	require.Equal(t, []string{"1:1", "11:100"}, decodeAll(d))
+
+	// Nothing after the columns returned so far is decoded: the value is corrupt
+	// after the first two value columns, which can still be decoded.
+	require.NoError(t, InitIndexFetchSpec(&spec, codec, table, table.GetPrimaryIndex(), allColIDs))
+	kv := primaryKV()
+	tuple, err := valueside.Encode(nil /* appendTo */, valueside.MakeColumnIDDelta(0, 2), row[1], nil /* scratch */)
+	require.NoError(t, err)
+	tuple, err = valueside.Encode(tuple, valueside.MakeColumnIDDelta(2, 3), row[2], nil /* scratch */)
+	require.NoError(t, err)
+	kv.Value.SetTuple(append(tuple, 0xff, 0xff))
+	d, err = NewKVDecoder(&spec, codec, kv, &da)
+	require.NoError(t, err)
+	for _, exp := range []string{"1:1", "2:10", "3:20"} {
+		col, ok := next(d)
+		require.True(t, ok)
+		require.Equal(t, exp, col)
+	}
+	_, _, _, err = d.Next()
+	require.Error(t, err)
+
+	// The key suffix of a unique index is decoded from the value, unless a key
+	// column is NULL (in which case it is in the key as well).
+	ua, err := catalog.MustFindIndexByName(table, "ua")
+	require.NoError(t, err)
+	require.NoError(t, InitIndexFetchSpec(&spec, codec, table, ua, []descpb.ColumnID{1, 2, 3}))
+	for _, tc := range []struct {
+		c1       tree.Datum
+		expected []string
+	}{
+		{c1: row[1], expected: []string{"2:10", "1:1", "3:20"}},
+		{c1: tree.DNull, expected: []string{"2:NULL", "1:1", "3:20"}},
+	} {
+		uaRow := append(tree.Datums(nil), row...)
+		uaRow[1] = tc.c1
+		entries, err := EncodeSecondaryIndex(codec, table, ua, colMap, uaRow, true /* includeEmpty */)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		d, err := NewKVDecoder(&spec, codec, roachpb.KeyValue{Key: entries[0].Key, Value: entries[0].Value}, &da)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, decodeAll(d))
+	}
+
+	// The key must belong to the index.
+	_, err = NewKVDecoder(&spec, codec, primaryKV(), &da)
+	require.ErrorContains(t, err, "is not a key of index ua of table t")
+}
+
+func TestMakeSpanForPrefix(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  a INT, b INT, c INT,
+  PRIMARY KEY (a, b),
+  INDEX desc_idx (b DESC, c DESC),
+  INDEX mixed_idx (c, b DESC),
+  UNIQUE INDEX unique_idx (c)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 1, NULL), (1, 2, 3), (2, 2, NULL), (2, 3, 4)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	one, two, three := tree.NewDInt(1), tree.NewDInt(2), tree.NewDInt(3)
+	for _, tc := range []struct {
+		index    string
+		prefix   tree.Datums
+		expected []string
+	}{
+		{index: "t_pkey", expected: []string{"(1, 1, NULL)", "(1, 2, 3)", "(2, 2, NULL)", "(2, 3, 4)"}},
+		{index: "t_pkey", prefix: tree.Datums{one}, expected: []string{"(1, 1, NULL)", "(1, 2, 3)"}},
+		{index: "t_pkey", prefix: tree.Datums{two, two}, expected: []string{"(2, 2, NULL)"}},
+		{index: "t_pkey", prefix: tree.Datums{two, one}},
+		{index: "desc_idx", expected: []string{"(2, 3, 4)", "(1, 2, 3)", "(2, 2, NULL)", "(1, 1, NULL)"}},
+		{index: "desc_idx", prefix: tree.Datums{two}, expected: []string{"(1, 2, 3)", "(2, 2, NULL)"}},
+		{index: "desc_idx", prefix: tree.Datums{two, tree.DNull}, expected: []string{"(2, 2, NULL)"}},
+		{index: "mixed_idx", prefix: tree.Datums{tree.DNull}, expected: []string{"(2, 2, NULL)", "(1, 1, NULL)"}},
+		{index: "mixed_idx", prefix: tree.Datums{tree.DNull, one}, expected: []string{"(1, 1, NULL)"}},
+		{index: "mixed_idx", prefix: tree.Datums{three, two, one}, expected: []string{"(1, 2, 3)"}},
+		{index: "unique_idx", prefix: tree.Datums{three}, expected: []string{"(1, 2, 3)"}},
+		{index: "unique_idx", prefix: tree.Datums{tree.DNull, two}, expected: []string{"(2, 2, NULL)"}},
+	} {
+		index, err := catalog.MustFindIndexByName(table, tc.index)
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "a", "b", "c"),
+		))
+		span, err := MakeSpanForPrefix(&spec, keys.SystemSQLCodec, tc.prefix)
+		require.NoError(t, err)
+		var rows []string
+		for _, row := range fetchRows(t, kvDB, &spec, roachpb.Spans{span}) {
+			rows = append(rows, tree.AsString(&row))
+		}
+		require.Equal(t, tc.expected, rows, "%s %s", tc.index, tree.AsString(&tc.prefix))
+	}
+
+	index, err := catalog.MustFindIndexByName(table, "unique_idx")
+	require.NoError(t, err)
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, InitIndexFetchSpec(&spec, keys.SystemSQLCodec, table, index, nil /* fetchColumnIDs */))
+	_, err = MakeSpanForPrefix(&spec, keys.SystemSQLCodec, tree.Datums{three, one})
+	require.ErrorContains(t, err, "prefix includes key suffix column a of unique index unique_idx")
+	_, err = MakeSpanForPrefix(&spec, keys.SystemSQLCodec, tree.Datums{tree.DNull, one, two, three})
+	require.ErrorContains(t, err, "prefix of 4 values is longer than the 3 key columns of index unique_idx")
+}
+
+func TestMakeSpanForPrefixTrailingColumnDirection(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY, a INT, b INT,
+  INDEX asc_idx (a, b),
+  INDEX desc_idx (a, b DESC)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 1, 1), (2, 1, 2), (3, 1, 3), (4, 2, 1), (5, 2, 2)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	one, two := tree.NewDInt(1), tree.NewDInt(2)
+	// scan returns the rows of the index in the given span.
+	scan := func(spec *fetchpb.IndexFetchSpec, span roachpb.Span) []string {
+		var rows []string
+		for _, row := range fetchRows(t, kvDB, spec, roachpb.Spans{span}) {
+			rows = append(rows, tree.AsString(&row))
+		}
+		return rows
+	}
+	for _, tc := range []struct {
+		index string
+		// expectedPrefix are the rows with the prefix (1, 2) and expectedUntilEnd
+		// are the rows from the start of the index until the end key of the span
+		// for that prefix.
+		expectedPrefix   []string
+		expectedUntilEnd []string
+	}{
+		{
+			index:            "asc_idx",
+			expectedPrefix:   []string{"(2, 1, 2)"},
+			expectedUntilEnd: []string{"(1, 1, 1)", "(2, 1, 2)"},
+		},
+		{
+			index:            "desc_idx",
+			expectedPrefix:   []string{"(2, 1, 2)"},
+			expectedUntilEnd: []string{"(3, 1, 3)", "(2, 1, 2)"},
+		},
+	} {
+		index, err := catalog.MustFindIndexByName(table, tc.index)
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k", "a", "b"),
+		))
+		span, err := MakeSpanForPrefix(&spec, keys.SystemSQLCodec, tree.Datums{one, two})
+		require.NoError(t, err)
+		// The key encoding of a value is not a prefix of the encoding of any other
+		// value in either direction, so the end key is the PrefixEnd of the
+		// encoded prefix, as long as the values are encoded with the directions of
+		// the key columns.
+		require.Equal(t, span.Key.PrefixEnd(), span.EndKey)
+		require.Equal(t, tc.expectedPrefix, scan(&spec, span), tc.index)
+
+		indexSpan, err := MakeSpanForPrefix(&spec, keys.SystemSQLCodec, nil /* prefix */)
+		require.NoError(t, err)
+		untilEnd := roachpb.Span{Key: indexSpan.Key, EndKey: span.EndKey}
+		require.Equal(t, tc.expectedUntilEnd, scan(&spec, untilEnd), tc.index)
+
+		// The first key column has the same rows in both indexes.
+		span, err = MakeSpanForPrefix(&spec, keys.SystemSQLCodec, tree.Datums{one})
+		require.NoError(t, err)
+		require.Len(t, scan(&spec, span), 3, tc.index)
+	}
+}
+
+func TestDecodeRawKey(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(ctx)
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  a INT, b STRING, c INT,
+  PRIMARY KEY (a, b),
+  INDEX c_idx (c DESC),
+  UNIQUE INDEX u_idx (c)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 'x', 3), (2, 'y', NULL)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	// Decode the keys of all the KVs of the table.
+	tablePrefix := keys.SystemSQLCodec.TablePrefix(uint32(table.GetID()))
+	kvs, err := kvDB.Scan(ctx, tablePrefix, tablePrefix.PrefixEnd(), 0 /* maxRows */)
+	require.NoError(t, err)
+	var decoded []string
+	for _, kv := range kvs {
+		index, datums, err := DecodeRawKey(keys.SystemSQLCodec, table, kv.Key)
+		require.NoError(t, err)
+		decoded = append(decoded, fmt.Sprintf("%s: %s", index.GetName(), tree.AsString(&datums)))
+	}
+	require.Equal(t, []string{
+		"t_pkey: (1, 'x')",
+		"t_pkey: (2, 'y')",
+		"c_idx: (3, 1, 'x')",
+		"c_idx: (NULL, 2, 'y')",
+		// The primary key columns are only encoded in the key of the unique index
+		// if c is NULL.
+		"u_idx: (NULL, 2, 'y')",
+		"u_idx: (3)",
+	}, decoded)
+
+	// Prefixes of index keys (e.g. range boundaries) can be decoded as well.
+	pkPrefix := MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), table.GetPrimaryIndex().GetID())
+	for _, tc := range []struct {
+		key      roachpb.Key
+		expected string
+	}{
+		{key: pkPrefix, expected: "()"},
+		{key: encoding.EncodeVarintAscending(append([]byte(nil), pkPrefix...), 2), expected: "(2)"},
+	} {
+		index, datums, err := DecodeRawKey(keys.SystemSQLCodec, table, tc.key)
+		require.NoError(t, err)
+		require.Equal(t, table.GetPrimaryIndex().GetID(), index.GetID())
+		require.Equal(t, tc.expected, tree.AsString(&datums))
+	}
+
+	// The key must belong to an index of the table.
+	_, _, err = DecodeRawKey(keys.SystemSQLCodec, table, MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID()+1, 1))
+	require.ErrorContains(t, err, "unexpected table ID")
+	_, _, err = DecodeRawKey(keys.SystemSQLCodec, table, MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), 10))
+	require.ErrorContains(t, err, "does not exist")
+}
@@ -11,18 +11,46 @@
 package rowenc
 
 import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+
 	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/server/telemetry"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/catenumpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/catpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/colinfo"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/fetchpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/schemaexpr"
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/catid"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/eval"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/sqltelemetry"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
 	"github.com/cockroachdb/cockroach/pkg/util/buildutil"
-	"github.com/cockroachdb/cockroach/pkg/util/encoding"
+	"github.com/cockroachdb/cockroach/pkg/util/intsets"
 	"github.com/cockroachdb/errors"
+	"github.com/lib/pq/oid"
 )
 
 // InitIndexFetchSpec fills in an IndexFetchSpec for the given index and
-// provided fetch columns. All the fields are reinitialized; the slices are
-// reused if they have enough capacity.
+// provided fetch columns. All the fields are reinitialized; the FetchedColumns
+// slice is reused if it has enough capacity (see also
+// IndexFetchSpecOptions.FetchedColumnsCapacityHint), in which case the caller
+// must not retain references to its old contents. The KeyAndSuffixColumns,
+// KeySuffixColumnIDs and FamilyDefaultColumns slices are shared with the table
+// descriptor (which caches them), so re-initializing a spec for the same index
+// doesn't allocate; these slices must not be modified.
 //
 // The fetch columns are assumed to be available in the index. If the index is
 // inverted and we fetch the inverted key, the corresponding Column contains the
@@ -34,76 +62,2015 @@ func InitIndexFetchSpec(
 	index catalog.Index,
 	fetchColumnIDs []descpb.ColumnID,
 ) error {
+	if err := checkCodec(codec); err != nil {
+		return err
+	}
+	info := makeIndexFetchSpecTableInfo(codec, table)
+	return initIndexFetchSpec(s, info, table, index, fetchColumnIDs, false /* allowUnhydratedTypes */)
+}
+
+// InitIndexFetchSpecs is a variant of InitIndexFetchSpec which initializes
+// specs for multiple indexes of the same table, computing the table-level
+// information only once. specs[i] is initialized for indexes[i] and
+// fetchColumnIDs[i], reusing its FetchedColumns slice as in InitIndexFetchSpec.
+func InitIndexFetchSpecs(
+	specs []fetchpb.IndexFetchSpec,
+	codec keys.SQLCodec,
+	table catalog.TableDescriptor,
+	indexes []catalog.Index,
+	fetchColumnIDs [][]descpb.ColumnID,
+) error {
+	if len(specs) != len(indexes) || len(specs) != len(fetchColumnIDs) {
+		return errors.AssertionFailedf(
+			"mismatched lengths: %d specs, %d indexes, %d fetch column lists",
+			len(specs), len(indexes), len(fetchColumnIDs),
+		)
+	}
+	if err := checkCodec(codec); err != nil {
+		return err
+	}
+	info := makeIndexFetchSpecTableInfo(codec, table)
+	for i := range specs {
+		if err := initIndexFetchSpec(
+			&specs[i], info, table, indexes[i], fetchColumnIDs[i], false, /* allowUnhydratedTypes */
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnFetchSpecAlloc, if set, is called whenever the Init functions allocate a new
+// backing array for one of the slices of an IndexFetchSpec instead of reusing
+// the existing one, with the name of the field and the length of the new array.
+// It is intended for tracking down the sources of these allocations when
+// profiling; it must be set before any specs are initialized and not changed
+// while they are.
+var OnFetchSpecAlloc func(kind string, n int)
+
+// notifyFetchSpecAlloc calls OnFetchSpecAlloc if it is set.
+func notifyFetchSpecAlloc(kind string, n int) {
+	if OnFetchSpecAlloc != nil {
+		OnFetchSpecAlloc(kind, n)
+	}
+}
+
+var indexFetchSpecPool = sync.Pool{
+	New: func() interface{} {
+		return &fetchpb.IndexFetchSpec{}
+	},
+}
+
+// AcquireIndexFetchSpec returns an empty IndexFetchSpec from a pool, which can
+// be initialized with one of the Init functions. Specs which were used before
+// retain their FetchedColumns backing array, so initializing them usually
+// doesn't allocate (the other slices that are filled in by default are shared
+// with the table descriptor). This is useful for the workloads which set up a
+// spec for every lookup.
+//
+// The spec must be released with ReleaseIndexFetchSpec once it is no longer
+// used.
+func AcquireIndexFetchSpec() *fetchpb.IndexFetchSpec {
+	return indexFetchSpecPool.Get().(*fetchpb.IndexFetchSpec)
+}
+
+// ReleaseIndexFetchSpec resets the spec and returns it to the pool (see
+// AcquireIndexFetchSpec). The spec (including its FetchedColumns) must not be
+// used after it is released, so it must not be released while a fetcher that
+// was initialized with it is still in use (the fetchers copy the spec, but not
+// its slices). Specs which were not acquired from the pool can be released as
+// well.
+func ReleaseIndexFetchSpec(s *fetchpb.IndexFetchSpec) {
+	// Clear the columns so that the pool doesn't keep their names and types
+	// alive.
+	fetchedCols := s.FetchedColumns[:cap(s.FetchedColumns)]
+	for i := range fetchedCols {
+		fetchedCols[i] = fetchpb.IndexFetchSpec_Column{}
+	}
+	*s = fetchpb.IndexFetchSpec{FetchedColumns: fetchedCols[:0]}
+	indexFetchSpecPool.Put(s)
+}
+
+// checkCodec returns an error if the codec is the zero value, whose methods
+// panic.
+func checkCodec(codec keys.SQLCodec) error {
+	if !codec.IsInitialized() {
+		return errors.AssertionFailedf("invalid SQL codec: the codec must be created with keys.MakeSQLCodec")
+	}
+	return nil
+}
+
+// indexFetchSpecTableInfo contains the information used to initialize an
+// IndexFetchSpec that is the same for all indexes of the table.
+type indexFetchSpecTableInfo struct {
+	codec                keys.SQLCodec
+	maxFamilyID          descpb.FamilyID
+	familyDefaultColumns []fetchpb.IndexFetchSpec_FamilyDefaultColumn
+}
+
+func makeIndexFetchSpecTableInfo(
+	codec keys.SQLCodec, table catalog.TableDescriptor,
+) indexFetchSpecTableInfo {
+	info := indexFetchSpecTableInfo{
+		codec:                codec,
+		familyDefaultColumns: table.FamilyDefaultColumns(),
+	}
+	families := table.GetFamilies()
+	for i := range families {
+		if id := families[i].ID; id > info.maxFamilyID {
+			info.maxFamilyID = id
+		}
+	}
+	return info
+}
+
+func initIndexFetchSpec(
+	s *fetchpb.IndexFetchSpec,
+	info indexFetchSpecTableInfo,
+	table catalog.TableDescriptor,
+	index catalog.Index,
+	fetchColumnIDs []descpb.ColumnID,
+	allowUnhydratedTypes bool,
+) error {
+	// Interleaved tables are no longer supported: the Interleave and
+	// InterleavedBy fields of the index descriptor are deprecated, and
+	// validateTableIndexes (in tabledesc) rejects any index which sets them.
+	// So we can only get here with a corrupt descriptor. The keys of these
+	// indexes would be misinterpreted, so we don't build a spec for them.
+	if desc := index.IndexDesc(); len(desc.Interleave.Ancestors) > 0 || len(desc.InterleavedBy) > 0 {
+		return errors.AssertionFailedf(
+			"index %s (%d) of table %s is interleaved", index.GetName(), index.GetID(), table.GetName(),
+		)
+	}
 	oldFetchedCols := s.FetchedColumns
 	*s = fetchpb.IndexFetchSpec{
-		Version:             fetchpb.IndexFetchSpecVersionInitial,
+		Version:             fetchpb.IndexFetchSpecVersionCurrent,
 		TableID:             table.GetID(),
 		TableName:           table.GetName(),
 		IndexID:             index.GetID(),
 		IndexName:           index.GetName(),
 		IsSecondaryIndex:    !index.Primary(),
 		IsUniqueIndex:       index.IsUnique(),
+		IsPartial:           index.IsPartial(),
 		EncodingType:        index.GetEncodingType(),
+		IndexVersion:        uint32(index.GetVersion()),
 		NumKeySuffixColumns: uint32(index.NumKeySuffixColumns()),
 		GeoConfig:           index.GetGeoConfig(),
 	}
+	// Note that the temporary index only uses the delete preserving encoding for
+	// writes once it is writable (see catalog.Index.UseDeletePreservingEncoding),
+	// but the entries written until then are preserved.
+	s.IsTemporaryIndex = index.IsTemporaryIndexForBackfill()
+	s.Invisibility = index.GetInvisibility()
 
-	maxKeysPerRow := table.IndexKeysPerRow(index)
+	maxKeysPerRow := indexKeysPerRow(table, index)
 	s.MaxKeysPerRow = uint32(maxKeysPerRow)
-	s.KeyPrefixLength = uint32(len(codec.TenantPrefix()) +
-		encoding.EncodedLengthUvarintAscending(uint64(s.TableID)) +
-		encoding.EncodedLengthUvarintAscending(uint64(index.GetID())))
+	s.KeyPrefixLength = uint32(IndexKeyPrefixLength(info.codec, table.GetID(), index.GetID()))
 
-	s.FamilyDefaultColumns = table.FamilyDefaultColumns()
+	if index.IsSharded() {
+		sharded := index.GetSharded()
+		shardCol, err := catalog.MustFindColumnByName(table, sharded.Name)
+		if err != nil {
+			return err
+		}
+		s.ShardColumnID = shardCol.GetID()
+		s.ShardBucketCount = uint32(sharded.ShardBuckets)
+	}
 
-	families := table.GetFamilies()
-	for i := range families {
-		if id := families[i].ID; id > s.MaxFamilyID {
-			s.MaxFamilyID = id
+	if table.IsLocalityRegionalByRow() && index.NumKeyColumns() > 0 {
+		regionColName, err := table.GetRegionalByRowTableRegionColumnName()
+		if err != nil {
+			return err
+		}
+		if index.GetKeyColumnName(0) == string(regionColName) {
+			s.RegionColumnID = index.GetKeyColumnID(0)
 		}
 	}
 
-	s.KeyAndSuffixColumns = table.IndexFetchSpecKeyAndSuffixColumns(index)
+	s.FamilyDefaultColumns = info.familyDefaultColumns
+	s.MaxFamilyID = info.maxFamilyID
+
+	if s.IsSecondaryIndex {
+		// The slice is shared with the index descriptor.
+		s.KeySuffixColumnIDs = index.IndexDesc().KeySuffixColumnIDs
+	}
 
-	var invertedColumnID descpb.ColumnID
-	if index.GetType() == descpb.IndexDescriptor_INVERTED {
-		invertedColumnID = index.InvertedColumnID()
+	s.KeyAndSuffixColumns = table.IndexFetchSpecKeyAndSuffixColumns(index)
+	for i := range s.KeyAndSuffixColumns {
+		// The type is nil if the column doesn't exist in a corrupt descriptor; we
+		// check for it here because the decoders would crash otherwise.
+		if s.KeyAndSuffixColumns[i].Type == nil {
+			return errors.AssertionFailedf(
+				"cannot resolve the type of key column %d of index %s (%d) of table %s",
+				i, index.GetName(), index.GetID(), table.GetName(),
+			)
+		}
 	}
 
 	if cap(oldFetchedCols) >= len(fetchColumnIDs) {
 		s.FetchedColumns = oldFetchedCols[:len(fetchColumnIDs)]
 	} else {
 		s.FetchedColumns = make([]fetchpb.IndexFetchSpec_Column, len(fetchColumnIDs))
+		notifyFetchSpecAlloc("FetchedColumns", len(fetchColumnIDs))
 	}
 	for i, colID := range fetchColumnIDs {
-		col, err := catalog.MustFindColumnByID(table, colID)
+		if err := initFetchedColumn(
+			&s.FetchedColumns[i], s, table, index, colID, allowUnhydratedTypes,
+		); err != nil {
+			return err
+		}
+	}
+
+	// In test builds, verify that the key columns agree with the index, that the
+	// family default columns are sorted, that we aren't fetching the same column
+	// more than once and that we aren't trying to fetch columns that are not
+	// available in the index. Like the original check for unavailable columns,
+	// this is only done for secondary indexes: the primary index contains all
+	// the columns, and some of its callers fetch mutation and virtual columns.
+	if buildutil.CrdbTestBuild && s.IsSecondaryIndex {
+		if err := checkKeySuffixColumns(s, table, index); err != nil {
+			return err
+		}
+		if err := checkFamilyDefaultColumnsSorted(s, table); err != nil {
+			return err
+		}
+		if err := checkNoDuplicateFetchColumns(s, table); err != nil {
+			return err
+		}
+		if err := checkFetchColumnsInIndex(s, table, index); err != nil {
+			return err
+		}
+		if err := checkFetchedColumnTypes(s, table, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IncIndexFetchTelemetry increments the telemetry counters of the features of
+// the index which are used by the given spec (see sqltelemetry.IndexFetch*).
+// It is called by the fetchers when they start a KV scan (StartScan and
+// StartInconsistentScan), so that the specs which are initialized but never
+// used to scan (e.g. by the planner, or internally to build other specs) aren't
+// counted. Decoding KVs from a row.KVProvider isn't counted either, since that
+// is done for every event by changefeeds. Specs of the initial version don't
+// record whether the index is partial, so they are never counted as partial.
+//
+// Each increment is a single atomic operation and nothing is allocated, so
+// this is cheap enough for the fetchers which start a scan for every batch of
+// lookups.
+func IncIndexFetchTelemetry(s *fetchpb.IndexFetchSpec) {
+	var inverted, composite bool
+	for i := range s.KeyAndSuffixColumns {
+		inverted = inverted || s.KeyAndSuffixColumns[i].IsInverted
+		composite = composite || s.KeyAndSuffixColumns[i].IsComposite
+	}
+	if inverted {
+		telemetry.Inc(sqltelemetry.IndexFetchInvertedCounter)
+	}
+	if s.IsPartial {
+		telemetry.Inc(sqltelemetry.IndexFetchPartialCounter)
+	}
+	if composite {
+		telemetry.Inc(sqltelemetry.IndexFetchCompositeCounter)
+	}
+	if !s.SingleKVPerRow() {
+		telemetry.Inc(sqltelemetry.IndexFetchMultiFamilyCounter)
+	}
+}
+
+// initFetchedColumn fills in the description of a fetched column, given a spec
+// with initialized KeyAndSuffixColumns. Unless allowUnhydratedTypes is set, it
+// is an error if the column has an enum type which is not hydrated.
+func initFetchedColumn(
+	c *fetchpb.IndexFetchSpec_Column,
+	s *fetchpb.IndexFetchSpec,
+	table catalog.TableDescriptor,
+	index catalog.Index,
+	colID descpb.ColumnID,
+	allowUnhydratedTypes bool,
+) error {
+	col, err := catalog.MustFindColumnByID(table, colID)
+	if err != nil {
+		return err
+	}
+	*c = fetchpb.IndexFetchSpec_Column{
+		Name:     col.GetName(),
+		ColumnID: colID,
+		Type:     FetchColumnType(index, col, colID),
+		// NULL array elements are encoded as NULL inverted keys, so the inverted
+		// key can be NULL even if the column is not nullable. Similarly,
+		// non-public columns are not written by all rows (e.g. rows inserted
+		// while a dropped column is DELETE_ONLY). This only disables the check
+		// for unexpected NULLs; the values are decoded the same way.
+		IsNonNullable:        !col.IsNullable() && col.Public() && !isInvertedKeyColumn(index, colID),
+		Role:                 fetchColumnRole(s, col),
+		IsSystemColumn:       col.IsSystemColumn(),
+		IsCompositeKeyColumn: isCompositeKeyColumn(s, colID),
+		IsIdentity:           col.IsGeneratedAsIdentity(),
+		HasOnUpdate:          col.HasOnUpdate(),
+	}
+	if c.InValue() {
+		c.FamilyID = valueFamilyID(table, index, col, c.IsCompositeKeyColumn)
+	}
+	c.IsExtraKeyColumn = c.Role == fetchpb.IndexFetchSpec_KEY_SUFFIX && index.IsUnique() && !index.Primary()
+	if err := checkArrayElementType(c.Type); err != nil {
+		return errors.Wrapf(err, "column %s of table %s", col.GetName(), table.GetName())
+	}
+	if allowUnhydratedTypes {
+		return nil
+	}
+	if err := checkEnumTypeHydrated(c.Type); err != nil {
+		return errors.Wrapf(err, "column %s of table %s", col.GetName(), table.GetName())
+	}
+	return nil
+}
+
+// ErrIndexNotReadable is returned by InitIndexFetchSpecWithOptions (when
+// RequireReadableIndex is set) if the index is not public, in which case it
+// might not contain all the rows of the table (e.g. because it is still being
+// backfilled). Callers can check for it with errors.Is and fall back to
+// another index.
+var ErrIndexNotReadable = errors.New("index is not readable")
+
+// ErrVirtualColumnNotCovered is returned by InitIndexFetchSpecWithOptions (when
+// RequireVirtualColumnsCovered is set) and by InitIndexFetchSpecChecked if a
+// fetched virtual column is not a key column of the index and references a
+// column which is not available in the index, in which case the virtual column
+// can't be computed from the fetched rows. The error message contains the
+// names of both columns. Callers can check for it with errors.Is and add an
+// index join to the primary index.
+var ErrVirtualColumnNotCovered = errors.New("virtual column is not covered by the index")
+
+// IndexFetchSpecOptions contains optional settings for
+// InitIndexFetchSpecWithOptions. The zero value produces the same spec as
+// InitIndexFetchSpec.
+type IndexFetchSpecOptions struct {
+	// IncludeVirtualColumnDependencies, if set, populates
+	// VirtualColumnDependencyIDs with the columns that are referenced by the
+	// expressions of the fetched virtual computed columns.
+	IncludeVirtualColumnDependencies bool
+
+	// IncludeStoredColumnsByFamily, if set, populates StoredColumnsByFamily.
+	IncludeStoredColumnsByFamily bool
+
+	// IncludePredicateColumns, if set, populates PredicateColumnIDs and
+	// PredicateTypeIDs with the columns and the user-defined types that the
+	// predicate of a partial index depends on.
+	IncludePredicateColumns bool
+
+	// IncludeExpressionColumns, if set, populates ExpressionColumns with the
+	// expressions of the key columns of an expression index, along with the
+	// columns they reference.
+	IncludeExpressionColumns bool
+
+	// IncludePartitioningColumns, if set, populates PartitioningColumnIDs with
+	// the key columns used by the partitioning of the index.
+	IncludePartitioningColumns bool
+
+	// IncludeTTLExpirationColumn, if set, populates TTLExpirationColumnID for
+	// tables with row-level TTL. Note that this requires parsing the TTL
+	// expiration expression, if there is one.
+	IncludeTTLExpirationColumn bool
+
+	// RequireReadableIndex, if set, causes an ErrIndexNotReadable error if the
+	// index is not public. It should not be set by schema change code that
+	// intentionally reads non-public indexes.
+	RequireReadableIndex bool
+
+	// RequireVirtualColumnsCovered, if set, causes an ErrVirtualColumnNotCovered
+	// error if a fetched virtual column (which is not a key column) references a
+	// column which is not available in the index. Note that this requires
+	// parsing the expressions of the fetched virtual columns.
+	RequireVirtualColumnsCovered bool
+
+	// TargetVersion, if set, is the version of the spec to produce. It can be
+	// older than fetchpb.IndexFetchSpecVersionCurrent in order to produce specs
+	// that can be decoded by nodes running an older binary, in which case the
+	// fields introduced after that version are left empty. It is an error to
+	// request optional fields that the target version doesn't support.
+	TargetVersion uint32
+
+	// OutputColumnIDs, if set, populates ColumnToOutputIdx with the ordinal of
+	// each fetched column among these columns. It is an error if one of them is
+	// not a fetched column or if it appears more than once; fetched columns
+	// which are not output columns are mapped to -1.
+	OutputColumnIDs []descpb.ColumnID
+
+	// WithMVCCTimestamp, if set, adds the MVCC timestamp system column after the
+	// fetch columns, in which case the fetcher emits the timestamp of each row
+	// (the maximum timestamp of its KVs) as a DECIMAL. Note that the timestamp
+	// depends on all the KVs of the row, so the spec shouldn't be restricted to
+	// a subset of the column families.
+	WithMVCCTimestamp bool
+
+	// AllowUnhydratedTypes, if set, allows fetching columns of user-defined
+	// types which are not hydrated (e.g. when the table descriptor was not read
+	// through a descs.Collection). The types must be hydrated with
+	// IndexFetchSpec.HydrateTypes before any values are decoded.
+	AllowUnhydratedTypes bool
+
+	// FetchedColumnsCapacityHint, if larger than the capacity of the existing
+	// FetchedColumns slice, causes that slice to be allocated with (at least)
+	// this capacity. Callers which re-initialize the same spec with a growing
+	// set of fetch columns can set it to the eventual number of columns so that
+	// the slice is allocated only once. Note that the KeyAndSuffixColumns slice
+	// is shared with the table descriptor and is never allocated.
+	FetchedColumnsCapacityHint int
+}
+
+// InitIndexFetchSpecWithOptions is a variant of InitIndexFetchSpec which also
+// fills in the optional parts of the spec requested in opts.
+func InitIndexFetchSpecWithOptions(
+	s *fetchpb.IndexFetchSpec,
+	codec keys.SQLCodec,
+	table catalog.TableDescriptor,
+	index catalog.Index,
+	fetchColumnIDs []descpb.ColumnID,
+	opts IndexFetchSpecOptions,
+) error {
+	if opts.TargetVersion != 0 {
+		if !fetchpb.IsSupportedIndexFetchSpecVersion(opts.TargetVersion) {
+			return errors.AssertionFailedf("unsupported IndexFetchSpec version %d", opts.TargetVersion)
+		}
+		if opts.TargetVersion < fetchpb.IndexFetchSpecVersionIndexMetadata &&
+			(opts.IncludeVirtualColumnDependencies || opts.IncludeStoredColumnsByFamily ||
+				opts.IncludePredicateColumns || opts.IncludeExpressionColumns ||
+				opts.IncludePartitioningColumns || opts.IncludeTTLExpirationColumn ||
+				opts.OutputColumnIDs != nil) {
+			return errors.AssertionFailedf(
+				"IndexFetchSpec version %d doesn't support the requested optional fields", opts.TargetVersion,
+			)
+		}
+		if opts.TargetVersion < fetchpb.IndexFetchSpecVersionIndexMetadata &&
+			index.IsTemporaryIndexForBackfill() {
+			return errors.AssertionFailedf(
+				"IndexFetchSpec version %d doesn't support temporary index %s",
+				opts.TargetVersion, index.GetName(),
+			)
+		}
+	}
+	if opts.RequireReadableIndex && !index.Public() {
+		return errors.Wrapf(
+			ErrIndexNotReadable, "index %s of table %s is %s", index.GetName(), table.GetName(),
+			nonPublicIndexState(index),
+		)
+	}
+	if opts.WithMVCCTimestamp {
+		for _, id := range fetchColumnIDs {
+			if id == colinfo.MVCCTimestampColumnID {
+				return errors.AssertionFailedf(
+					"the MVCC timestamp column is already a fetch column of index %s", index.GetName(),
+				)
+			}
+		}
+		// Make sure we don't modify the caller's slice.
+		fetchColumnIDs = append(
+			fetchColumnIDs[:len(fetchColumnIDs):len(fetchColumnIDs)], colinfo.MVCCTimestampColumnID,
+		)
+	}
+	if err := checkCodec(codec); err != nil {
+		return err
+	}
+	// Only allocate once the arguments are validated, so that a failed call
+	// doesn't replace the slice of the spec.
+	if hint := opts.FetchedColumnsCapacityHint; hint > cap(s.FetchedColumns) && hint > len(fetchColumnIDs) {
+		s.FetchedColumns = make([]fetchpb.IndexFetchSpec_Column, 0, hint)
+		notifyFetchSpecAlloc("FetchedColumns", hint)
+	}
+	info := makeIndexFetchSpecTableInfo(codec, table)
+	if err := initIndexFetchSpec(
+		s, info, table, index, fetchColumnIDs, opts.AllowUnhydratedTypes,
+	); err != nil {
+		return err
+	}
+	if opts.RequireVirtualColumnsCovered {
+		if err := checkVirtualColumnsCovered(s, table, index); err != nil {
+			return err
+		}
+	}
+	if opts.IncludeVirtualColumnDependencies {
+		deps, err := virtualColumnDependencies(table, fetchColumnIDs)
+		if err != nil {
+			return err
+		}
+		s.VirtualColumnDependencyIDs = deps.Ordered()
+	}
+	if opts.IncludeStoredColumnsByFamily {
+		s.StoredColumnsByFamily = storedColumnsByFamily(table, index)
+	}
+	if opts.IncludePredicateColumns && index.IsPartial() {
+		colIDs, err := exprColumnIDs(table, index.GetPredicate())
+		if err != nil {
+			return errors.Wrapf(err, "predicate of index %s", index.GetName())
+		}
+		s.PredicateColumnIDs = colIDs.Ordered()
+		typeIDs, err := exprTypeIDs(table, index.GetPredicate(), colIDs)
+		if err != nil {
+			return errors.Wrapf(err, "predicate of index %s", index.GetName())
+		}
+		s.PredicateTypeIDs = typeIDs.Ordered()
+	}
+	if opts.IncludeExpressionColumns {
+		exprCols, err := expressionColumns(table, s.KeyAndSuffixColumns)
+		if err != nil {
+			return err
+		}
+		s.ExpressionColumns = exprCols
+	}
+	if opts.IncludePartitioningColumns {
+		colIDs, err := partitioningColumnIDs(table, index)
 		if err != nil {
 			return err
 		}
-		typ := col.GetType()
-		if colID == invertedColumnID {
-			typ = index.InvertedColumnKeyType()
+		s.PartitioningColumnIDs = colIDs
+	}
+	if opts.IncludeTTLExpirationColumn && table.HasRowLevelTTL() {
+		colID, err := ttlExpirationColumnID(table)
+		if err != nil {
+			return err
+		}
+		s.TTLExpirationColumnID = colID
+	}
+	if opts.OutputColumnIDs != nil {
+		columnToOutputIdx, err := makeColumnToOutputIdx(s, table, opts.OutputColumnIDs)
+		if err != nil {
+			return err
 		}
-		s.FetchedColumns[i] = fetchpb.IndexFetchSpec_Column{
-			Name:          col.GetName(),
-			ColumnID:      colID,
-			Type:          typ,
-			IsNonNullable: !col.IsNullable() && col.Public(),
+		s.ColumnToOutputIdx = columnToOutputIdx
+	}
+	if opts.TargetVersion != 0 && opts.TargetVersion < fetchpb.IndexFetchSpecVersionIndexMetadata {
+		downgradeToInitialVersion(s)
+	}
+	return nil
+}
+
+// partitioningColumnIDs returns the IDs of the key columns used by the
+// partitioning of the index (see IndexFetchSpec.PartitioningColumnIDs).
+func partitioningColumnIDs(
+	table catalog.TableDescriptor, index catalog.Index,
+) ([]descpb.ColumnID, error) {
+	numCols, err := partitioningNumColumns(index.GetPartitioning())
+	if err != nil {
+		return nil, err
+	}
+	if numCols == 0 {
+		return nil, nil
+	}
+	if numCols > index.NumKeyColumns() {
+		return nil, errors.AssertionFailedf(
+			"partitioning of index %s of table %s uses %d columns but the index has %d key columns",
+			index.GetName(), table.GetName(), numCols, index.NumKeyColumns(),
+		)
+	}
+	res := make([]descpb.ColumnID, numCols)
+	for i := range res {
+		res[i] = index.GetKeyColumnID(i)
+	}
+	return res, nil
+}
+
+// partitioningNumColumns returns the number of (leading) key columns used by
+// the given partitioning, including the columns of its subpartitionings (which
+// follow the columns of their parent).
+func partitioningNumColumns(p catalog.Partitioning) (int, error) {
+	if p.NumColumns() == 0 {
+		return 0, nil
+	}
+	maxSubCols := 0
+	if err := p.ForEachList(func(_ string, _ [][]byte, sub catalog.Partitioning) error {
+		n, err := partitioningNumColumns(sub)
+		if n > maxSubCols {
+			maxSubCols = n
 		}
+		return err
+	}); err != nil {
+		return 0, err
 	}
+	return p.NumColumns() + maxSubCols, nil
+}
 
-	// In test builds, verify that we aren't trying to fetch columns that are not
-	// available in the index.
-	if buildutil.CrdbTestBuild && s.IsSecondaryIndex {
-		colIDs := index.CollectKeyColumnIDs()
-		colIDs.UnionWith(index.CollectSecondaryStoredColumnIDs())
-		colIDs.UnionWith(index.CollectKeySuffixColumnIDs())
+// makeColumnToOutputIdx returns the ColumnToOutputIdx mapping for the given
+// output columns (see IndexFetchSpecOptions.OutputColumnIDs).
+func makeColumnToOutputIdx(
+	s *fetchpb.IndexFetchSpec, table catalog.TableDescriptor, outputColumnIDs []descpb.ColumnID,
+) ([]int32, error) {
+	res := make([]int32, len(s.FetchedColumns))
+	for i := range res {
+		res[i] = -1
+	}
+	for outIdx, colID := range outputColumnIDs {
+		found := false
 		for i := range s.FetchedColumns {
-			if !colIDs.Contains(s.FetchedColumns[i].ColumnID) {
-				return errors.AssertionFailedf("requested column %s not in index", s.FetchedColumns[i].Name)
+			if s.FetchedColumns[i].ColumnID != colID {
+				continue
+			}
+			if res[i] != -1 {
+				return nil, errors.AssertionFailedf(
+					"output column %s (%d) of table %s is specified more than once",
+					s.FetchedColumns[i].Name, colID, table.GetName(),
+				)
+			}
+			res[i] = int32(outIdx)
+			found = true
+			break
+		}
+		if !found {
+			return nil, errors.AssertionFailedf(
+				"output column %d of table %s is not a fetched column", colID, table.GetName(),
+			)
+		}
+	}
+	return res, nil
+}
+
+// downgradeToInitialVersion clears the fields of the spec which are not part of
+// IndexFetchSpecVersionInitial (see fetchpb.IndexFetchSpecVersionIndexMetadata).
+func downgradeToInitialVersion(s *fetchpb.IndexFetchSpec) {
+	s.Version = fetchpb.IndexFetchSpecVersionInitial
+	s.IsPartial = false
+	s.ShardColumnID = 0
+	s.ShardBucketCount = 0
+	s.RegionColumnID = 0
+	s.TTLExpirationColumnID = 0
+	s.ColumnToOutputIdx = nil
+	s.PartitioningColumnIDs = nil
+	s.IndexVersion = 0
+	s.Invisibility = 0
+	s.KeySuffixColumnIDs = nil
+	// KeyAndSuffixColumns is shared with the table descriptor, so we can't clear
+	// the roles in place.
+	keyAndSuffixColumns := make([]fetchpb.IndexFetchSpec_KeyColumn, len(s.KeyAndSuffixColumns))
+	copy(keyAndSuffixColumns, s.KeyAndSuffixColumns)
+	for i := range keyAndSuffixColumns {
+		keyAndSuffixColumns[i].Role = fetchpb.IndexFetchSpec_NO_ROLE
+	}
+	s.KeyAndSuffixColumns = keyAndSuffixColumns
+	for i := range s.FetchedColumns {
+		s.FetchedColumns[i].Role = fetchpb.IndexFetchSpec_NO_ROLE
+		s.FetchedColumns[i].IsSystemColumn = false
+		s.FetchedColumns[i].IsCompositeKeyColumn = false
+		s.FetchedColumns[i].IsIdentity = false
+		s.FetchedColumns[i].HasOnUpdate = false
+		s.FetchedColumns[i].FamilyID = 0
+		s.FetchedColumns[i].IsExtraKeyColumn = false
+	}
+}
+
+// storedColumnsByFamily groups the stored columns of a secondary index by the
+// column family in which they are encoded, mirroring EncodeSecondaryIndex.
+func storedColumnsByFamily(
+	table catalog.TableDescriptor, index catalog.Index,
+) []fetchpb.IndexFetchSpec_FamilyStoredColumns {
+	if index.GetEncodingType() == catenumpb.PrimaryIndexEncoding ||
+		index.NumSecondaryStoredColumns() == 0 {
+		return nil
+	}
+	storedColIDs := index.CollectSecondaryStoredColumnIDs()
+	if table.NumFamilies() == 1 ||
+		index.GetType() == descpb.IndexDescriptor_INVERTED ||
+		index.GetVersion() == descpb.BaseIndexFormatVersion {
+		// All stored columns are encoded in the value of family 0.
+		return []fetchpb.IndexFetchSpec_FamilyStoredColumns{{
+			FamilyID:        0,
+			StoredColumnIDs: storedColIDs.Ordered(),
+		}}
+	}
+	var res []fetchpb.IndexFetchSpec_FamilyStoredColumns
+	families := table.GetFamilies()
+	for i := range families {
+		var familyColIDs catalog.TableColSet
+		for _, id := range families[i].ColumnIDs {
+			if storedColIDs.Contains(id) {
+				familyColIDs.Add(id)
 			}
 		}
+		if !familyColIDs.Empty() {
+			res = append(res, fetchpb.IndexFetchSpec_FamilyStoredColumns{
+				FamilyID:        families[i].ID,
+				StoredColumnIDs: familyColIDs.Ordered(),
+			})
+		}
 	}
+	sort.Slice(res, func(i, j int) bool { return res[i].FamilyID < res[j].FamilyID })
+	return res
+}
 
-	return nil
+// nonPublicIndexState describes the state of a non-public index.
+func nonPublicIndexState(index catalog.Index) string {
+	switch {
+	case index.DeleteOnly():
+		return "delete-only"
+	case index.WriteAndDeleteOnly():
+		return "write-only"
+	case index.Backfilling():
+		return "backfilling"
+	case index.Merging():
+		return "merging"
+	default:
+		return "not public"
+	}
+}
+
+// virtualColumnDependencies returns the set of columns referenced by the
+// computed expressions of the virtual columns among the given columns.
+func virtualColumnDependencies(
+	table catalog.TableDescriptor, colIDs []descpb.ColumnID,
+) (catalog.TableColSet, error) {
+	var deps catalog.TableColSet
+	for _, colID := range colIDs {
+		col, err := catalog.MustFindColumnByID(table, colID)
+		if err != nil {
+			return catalog.TableColSet{}, err
+		}
+		if !col.IsVirtual() {
+			continue
+		}
+		referenced, err := exprColumnIDs(table, col.GetComputeExpr())
+		if err != nil {
+			return catalog.TableColSet{}, errors.Wrapf(err, "computed expression of column %s", col.GetName())
+		}
+		deps.UnionWith(referenced)
+	}
+	return deps, nil
+}
+
+// expressionColumns describes the expression index columns among the given key
+// columns.
+func expressionColumns(
+	table catalog.TableDescriptor, keyCols []fetchpb.IndexFetchSpec_KeyColumn,
+) ([]fetchpb.IndexFetchSpec_ExpressionColumn, error) {
+	var res []fetchpb.IndexFetchSpec_ExpressionColumn
+	for i := range keyCols {
+		col, err := catalog.MustFindColumnByID(table, keyCols[i].ColumnID)
+		if err != nil {
+			return nil, err
+		}
+		if !col.IsExpressionIndexColumn() {
+			continue
+		}
+		referenced, err := exprColumnIDs(table, col.GetComputeExpr())
+		if err != nil {
+			return nil, errors.Wrapf(err, "computed expression of column %s", col.GetName())
+		}
+		res = append(res, fetchpb.IndexFetchSpec_ExpressionColumn{
+			ColumnID:            col.GetID(),
+			Expr:                col.GetComputeExpr(),
+			ReferencedColumnIDs: referenced.Ordered(),
+		})
+	}
+	return res, nil
+}
+
+// exprColumnIDs returns the set of columns referenced by a serialized
+// expression stored in the table descriptor.
+func exprColumnIDs(table catalog.TableDescriptor, exprStr string) (catalog.TableColSet, error) {
+	expr, err := parser.ParseExpr(exprStr)
+	if err != nil {
+		return catalog.TableColSet{}, errors.NewAssertionErrorWithWrappedErrf(err, "parsing %q", exprStr)
+	}
+	return schemaexpr.ExtractColumnIDs(table, expr)
+}
+
+// ttlExpirationColumnID returns the ID of the column which stores the
+// expiration time of the rows of a table with row-level TTL, or zero if the
+// expiration is computed by an expression which isn't a column reference or if
+// the column isn't public (e.g. while it is being added or dropped along with
+// the TTL).
+func ttlExpirationColumnID(table catalog.TableDescriptor) (descpb.ColumnID, error) {
+	ttl := table.GetRowLevelTTL()
+	colName := catpb.TTLDefaultExpirationColumnName
+	if ttl.HasExpirationExpr() {
+		expr, err := parser.ParseExpr(string(ttl.ExpirationExpr))
+		if err != nil {
+			return 0, errors.NewAssertionErrorWithWrappedErrf(
+				err, "parsing TTL expiration expression %q", ttl.ExpirationExpr,
+			)
+		}
+		name, ok := tree.StripParens(expr).(*tree.UnresolvedName)
+		if !ok || name.NumParts != 1 {
+			return 0, nil
+		}
+		colName = name.Parts[0]
+	}
+	col := catalog.FindColumnByName(table, colName)
+	if col == nil || !col.Public() {
+		return 0, nil
+	}
+	return col.GetID(), nil
+}
+
+// exprTypeIDs returns the IDs of the user-defined types that the given
+// serialized expression depends on: the types that it references (serialized
+// expressions reference user-defined types by OID, e.g. 'a':::@100105), and
+// the types of the given columns referenced by the expression, including their
+// element types.
+func exprTypeIDs(
+	table catalog.TableDescriptor, exprStr string, colIDs catalog.TableColSet,
+) (catalog.DescriptorIDSet, error) {
+	expr, err := parser.ParseExpr(exprStr)
+	if err != nil {
+		return catalog.DescriptorIDSet{}, errors.NewAssertionErrorWithWrappedErrf(err, "parsing %q", exprStr)
+	}
+	visitor := tree.TypeCollectorVisitor{OIDs: make(map[oid.Oid]struct{})}
+	tree.WalkExpr(&visitor, expr)
+	var ids catalog.DescriptorIDSet
+	for typOID := range visitor.OIDs {
+		if id := catid.UserDefinedOIDToID(typOID); id != catid.InvalidDescID {
+			ids.Add(id)
+		}
+	}
+	for _, colID := range colIDs.Ordered() {
+		col, err := catalog.MustFindColumnByID(table, colID)
+		if err != nil {
+			return catalog.DescriptorIDSet{}, err
+		}
+		addUserDefinedTypeIDs(&ids, col.GetType())
+	}
+	return ids, nil
+}
+
+// addUserDefinedTypeIDs adds the IDs of the given type and of its element
+// types to ids, if they are user-defined.
+func addUserDefinedTypeIDs(ids *catalog.DescriptorIDSet, t *types.T) {
+	if t.UserDefined() {
+		ids.Add(catid.UserDefinedOIDToID(t.Oid()))
+	}
+	switch t.Family() {
+	case types.ArrayFamily:
+		addUserDefinedTypeIDs(ids, t.ArrayContents())
+	case types.TupleFamily:
+		for _, elem := range t.TupleContents() {
+			addUserDefinedTypeIDs(ids, elem)
+		}
+	}
+}
+
+// InitIndexFetchSpecForFamilies is a variant of InitIndexFetchSpec for fetches
+// that only need to read a subset of the column families of the table (as
+// returned by NeededColumnFamilyIDs). FamilyDefaultColumns is restricted to the
+// needed families and MaxFamilyID is set to the largest needed family.
+//
+// The caller must ensure that the fetcher only receives KVs from the needed
+// families (e.g. by using SplitRowKeyIntoFamilySpans); in particular, a KV from
+// a family larger than MaxFamilyID would not be attributed to the correct row.
+// An assertion error is returned if a fetched column is encoded in the value of
+// a family that is not needed.
+func InitIndexFetchSpecForFamilies(
+	s *fetchpb.IndexFetchSpec,
+	codec keys.SQLCodec,
+	table catalog.TableDescriptor,
+	index catalog.Index,
+	fetchColumnIDs []descpb.ColumnID,
+	neededFamilies []descpb.FamilyID,
+) error {
+	if err := InitIndexFetchSpec(s, codec, table, index, fetchColumnIDs); err != nil {
+		return err
+	}
+	if len(neededFamilies) == 0 {
+		return errors.AssertionFailedf("no needed families for index %s", index.GetName())
+	}
+
+	var neededSet intsets.Fast
+	s.MaxFamilyID = 0
+	for _, id := range neededFamilies {
+		neededSet.Add(int(id))
+		if id > s.MaxFamilyID {
+			s.MaxFamilyID = id
+		}
+	}
+	for i := range s.FetchedColumns {
+		// The extra key columns of unique secondary indexes are encoded in the
+		// value of family 0 (and their FamilyID is zero).
+		if col := &s.FetchedColumns[i]; (col.InValue() || col.IsExtraKeyColumn) &&
+			!neededSet.Contains(int(col.FamilyID)) {
+			return errors.AssertionFailedf(
+				"column %s (%d) of index %s (%d) of table %s is encoded in family %d, which is not needed",
+				col.Name, col.ColumnID, index.GetName(), index.GetID(), table.GetName(), col.FamilyID,
+			)
+		}
+	}
+	if len(neededFamilies) < int(s.MaxKeysPerRow) {
+		s.MaxKeysPerRow = uint32(len(neededFamilies))
+	}
+
+	// FamilyDefaultColumns is shared with the table descriptor, so we can't
+	// filter it in place.
+	numNeeded := 0
+	for i := range s.FamilyDefaultColumns {
+		if neededSet.Contains(int(s.FamilyDefaultColumns[i].FamilyID)) {
+			numNeeded++
+		}
+	}
+	if numNeeded == len(s.FamilyDefaultColumns) {
+		return nil
+	}
+	var familyDefaultColumns []fetchpb.IndexFetchSpec_FamilyDefaultColumn
+	if numNeeded > 0 {
+		familyDefaultColumns = make([]fetchpb.IndexFetchSpec_FamilyDefaultColumn, 0, numNeeded)
+		for _, f := range s.FamilyDefaultColumns {
+			if neededSet.Contains(int(f.FamilyID)) {
+				familyDefaultColumns = append(familyDefaultColumns, f)
+			}
+		}
+	}
+	s.FamilyDefaultColumns = familyDefaultColumns
+	return nil
+}
+
+// InitIndexFetchSpecKeyOnly is a variant of InitIndexFetchSpec for fetches
+// that only need the index key (e.g. existence checks), in which case only the
+// KV of column family 0 has to be read for each row. The fetch columns must be
+// key or key suffix columns of the index (or system columns, if the table has a
+// single column family), and composite key columns must have their values
+// encoded in family 0. MaxFamilyID is
+// zero, MaxKeysPerRow is one, and FamilyDefaultColumns is empty. In
+// particular, the primary key columns can be fetched from any secondary index,
+// even one that doesn't store any columns; for unique secondary indexes they
+// are encoded in the value of family 0.
+//
+// As with InitIndexFetchSpecForFamilies, the caller must ensure that the
+// fetcher only receives KVs from family 0, unless the table has a single
+// column family.
+func InitIndexFetchSpecKeyOnly(
+	s *fetchpb.IndexFetchSpec,
+	codec keys.SQLCodec,
+	table catalog.TableDescriptor,
+	index catalog.Index,
+	fetchColumnIDs []descpb.ColumnID,
+) error {
+	if err := InitIndexFetchSpec(s, codec, table, index, fetchColumnIDs); err != nil {
+		return err
+	}
+	for i := range s.FetchedColumns {
+		if col := &s.FetchedColumns[i]; col.Role == fetchpb.IndexFetchSpec_STORED {
+			return errors.AssertionFailedf(
+				"column %s (%d) is not a key column of index %s (%d) of table %s",
+				col.Name, col.ColumnID, index.GetName(), index.GetID(), table.GetName(),
+			)
+		} else if col.IsCompositeKeyColumn && col.FamilyID != 0 {
+			// The value of a composite column can't be decoded from the key alone,
+			// so it would be fetched from a KV that isn't read.
+			return errors.AssertionFailedf(
+				"composite key column %s (%d) of index %s (%d) of table %s is encoded in family %d",
+				col.Name, col.ColumnID, index.GetName(), index.GetID(), table.GetName(), col.FamilyID,
+			)
+		} else if col.IsSystemColumn && table.NumFamilies() > 1 {
+			// The values of system columns depend on all the KVs of the row (e.g.
+			// the MVCC timestamp of the latest write to any family), see
+			// fetchpb.IndexFetchSpec.NeededFamilyIDs.
+			return errors.AssertionFailedf(
+				"system column %s (%d) of index %s (%d) of table %s depends on all the column families",
+				col.Name, col.ColumnID, index.GetName(), index.GetID(), table.GetName(),
+			)
+		}
+	}
+	s.MaxFamilyID = 0
+	s.MaxKeysPerRow = 1
+	// Family 0 never uses the single column encoding with a default column.
+	s.FamilyDefaultColumns = nil
+	return nil
+}
+
+// InitIndexFetchSpecAllColumns is a variant of InitIndexFetchSpec which fetches
+// all the columns that are available in the index: the key columns (in index
+// order), followed by the key suffix columns and by the stored columns. For
+// primary indexes, the stored columns are all the non-key columns of the table
+// which are stored in the index (in particular, virtual columns are excluded).
+func InitIndexFetchSpecAllColumns(
+	s *fetchpb.IndexFetchSpec,
+	codec keys.SQLCodec,
+	table catalog.TableDescriptor,
+	index catalog.Index,
+) error {
+	numStored := index.NumPrimaryStoredColumns() + index.NumSecondaryStoredColumns()
+	fetchColumnIDs := make(
+		[]descpb.ColumnID, 0, index.NumKeyColumns()+index.NumKeySuffixColumns()+numStored,
+	)
+	for i := 0; i < index.NumKeyColumns(); i++ {
+		fetchColumnIDs = append(fetchColumnIDs, index.GetKeyColumnID(i))
+	}
+	for i := 0; i < index.NumKeySuffixColumns(); i++ {
+		fetchColumnIDs = append(fetchColumnIDs, index.GetKeySuffixColumnID(i))
+	}
+	for i := 0; i < numStored; i++ {
+		fetchColumnIDs = append(fetchColumnIDs, index.GetStoredColumnID(i))
+	}
+	return InitIndexFetchSpec(s, codec, table, index, fetchColumnIDs)
+}
+
+// IndexFetchSpecLayoutVersion returns a token describing the physical layout
+// of the index as seen by the fetchers: it combines the fingerprint (see
+// IndexFetchSpec.Fingerprint) of the spec that fetches all the columns of the
+// index (see InitIndexFetchSpecAllColumns) with the column families of the
+// table. The token changes on any schema change which alters the spec
+// produced for the index (e.g. adding a stored column, or changing the family
+// of a column of the index), but not on renames, so a cache of plans that scan the index
+// can compare tokens instead of rebuilding the specs.
+//
+// The token is a hash, so tokens can only be compared for equality. Zero is
+// returned if the spec can't be initialized (e.g. for a corrupt descriptor).
+func IndexFetchSpecLayoutVersion(table catalog.TableDescriptor, index catalog.Index) uint64 {
+	var spec fetchpb.IndexFetchSpec
+	if err := InitIndexFetchSpecAllColumns(&spec, keys.SystemSQLCodec, table, index); err != nil {
+		return 0
+	}
+	h := fnv.New64a()
+	var buf [8]byte
+	add := func(v uint64) {
+		binary.LittleEndian.PutUint64(buf[:], v)
+		_, _ = h.Write(buf[:])
+	}
+	add(spec.Fingerprint())
+	// Only the families of the columns in the index matter.
+	var indexColIDs catalog.TableColSet
+	for i := range spec.FetchedColumns {
+		indexColIDs.Add(spec.FetchedColumns[i].ColumnID)
+	}
+	families := table.GetFamilies()
+	var familyColIDs []descpb.ColumnID
+	for i := range families {
+		familyColIDs = familyColIDs[:0]
+		for _, id := range families[i].ColumnIDs {
+			if indexColIDs.Contains(id) {
+				familyColIDs = append(familyColIDs, id)
+			}
+		}
+		add(uint64(families[i].ID))
+		add(uint64(len(familyColIDs)))
+		for _, id := range familyColIDs {
+			add(uint64(id))
+		}
+	}
+	return h.Sum64()
+}
+
+// PrimaryIndexFetchSpecFrom returns the spec for fetching the given columns
+// from the primary index of the table, for use by an index join after fetching
+// rows with the given spec for a secondary index of the same table. The spec
+// has the same version as the secondary spec (see
+// IndexFetchSpecOptions.TargetVersion), and it is an error if the secondary
+// spec was built for another table, with another codec, or if it doesn't
+// contain all the primary key columns (which are needed to look up the rows in
+// the primary index).
+func PrimaryIndexFetchSpecFrom(
+	secondary *fetchpb.IndexFetchSpec,
+	codec keys.SQLCodec,
+	table catalog.TableDescriptor,
+	neededColumnIDs []descpb.ColumnID,
+) (fetchpb.IndexFetchSpec, error) {
+	var s fetchpb.IndexFetchSpec
+	if secondary.TableID != table.GetID() {
+		return s, errors.AssertionFailedf(
+			"spec for table %s (%d) used with table %s (%d)",
+			secondary.TableName, secondary.TableID, table.GetName(), table.GetID(),
+		)
+	}
+	if !secondary.IsSecondaryIndex {
+		return s, errors.AssertionFailedf(
+			"spec for index %s of table %s is not for a secondary index", secondary.IndexName, table.GetName(),
+		)
+	}
+	if err := checkCodec(codec); err != nil {
+		return s, err
+	}
+	if int(secondary.KeyPrefixLength) != IndexKeyPrefixLength(codec, table.GetID(), secondary.IndexID) {
+		return s, errors.AssertionFailedf(
+			"spec for index %s of table %s was built with a different codec", secondary.IndexName, table.GetName(),
+		)
+	}
+	primary := table.GetPrimaryIndex()
+	for i := 0; i < primary.NumKeyColumns(); i++ {
+		colID := primary.GetKeyColumnID(i)
+		found := false
+		for j := range secondary.KeyAndSuffixColumns {
+			if secondary.KeyAndSuffixColumns[j].ColumnID == colID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return s, errors.AssertionFailedf(
+				"spec for index %s of table %s doesn't contain primary key column %s",
+				secondary.IndexName, table.GetName(), primary.GetKeyColumnName(i),
+			)
+		}
+	}
+	var opts IndexFetchSpecOptions
+	if secondary.Version != fetchpb.IndexFetchSpecVersionCurrent {
+		opts.TargetVersion = secondary.Version
+	}
+	err := InitIndexFetchSpecWithOptions(&s, codec, table, primary, neededColumnIDs, opts)
+	return s, err
+}
+
+// AddFetchColumn appends a column to the fetched columns of a spec that was
+// initialized for the given index (e.g. by InitIndexFetchSpec), reusing the
+// capacity of FetchedColumns; the existing fetched columns are unchanged. The
+// column must be available in the index and must not be fetched already.
+//
+// If the spec only covers some of the column families (see
+// InitIndexFetchSpecForFamilies and InitIndexFetchSpecKeyOnly) and the column
+// is stored in another family, FamilyDefaultColumns, MaxFamilyID and
+// MaxKeysPerRow are extended to cover that family too; the caller must then
+// also scan the KVs of that family. The optional fields filled in by
+// InitIndexFetchSpecWithOptions are not updated.
+func AddFetchColumn(
+	s *fetchpb.IndexFetchSpec,
+	table catalog.TableDescriptor,
+	index catalog.Index,
+	colID descpb.ColumnID,
+) error {
+	if s.TableID != table.GetID() || s.IndexID != index.GetID() {
+		return errors.AssertionFailedf(
+			"spec for index %d of table %d used with index %s (%d) of table %s (%d)",
+			s.IndexID, s.TableID, index.GetName(), index.GetID(), table.GetName(), table.GetID(),
+		)
+	}
+	s.FetchedColumns = append(s.FetchedColumns, fetchpb.IndexFetchSpec_Column{})
+	newCol := &s.FetchedColumns[len(s.FetchedColumns)-1]
+	err := initFetchedColumn(newCol, s, table, index, colID, false /* allowUnhydratedTypes */)
+	if err == nil {
+		err = checkNoDuplicateFetchColumns(s, table)
+	}
+	if err == nil {
+		err = checkFetchColumnsInIndex(s, table, index)
+	}
+	if err != nil {
+		s.FetchedColumns = s.FetchedColumns[:len(s.FetchedColumns)-1]
+		return err
+	}
+	if newCol.Role != fetchpb.IndexFetchSpec_STORED ||
+		int(s.MaxKeysPerRow) >= indexKeysPerRow(table, index) {
+		// Only the stored columns are decoded from the value of their family, and
+		// there is nothing to extend if the spec already covers all the families
+		// used by the index.
+		return nil
+	}
+	familyID, ok := columnFamilyID(table, colID)
+	if !ok {
+		return errors.AssertionFailedf(
+			"column %s (%d) of table %s is not in any family", newCol.Name, colID, table.GetName(),
+		)
+	}
+	if _, ok := s.DefaultColumnForFamily(familyID); ok {
+		return nil
+	}
+	for i := range s.FetchedColumns[:len(s.FetchedColumns)-1] {
+		c := &s.FetchedColumns[i]
+		if c.Role != fetchpb.IndexFetchSpec_STORED {
+			continue
+		}
+		if id, ok := columnFamilyID(table, c.ColumnID); ok && id == familyID {
+			return nil
+		}
+	}
+	// The family might have been needed without any of its columns being
+	// fetched, but MaxKeysPerRow is an upper bound, so it's fine to overestimate
+	// it.
+	s.MaxKeysPerRow++
+	if familyID > s.MaxFamilyID {
+		s.MaxFamilyID = familyID
+	}
+	tableDefaults := table.FamilyDefaultColumns()
+	i := sort.Search(len(tableDefaults), func(i int) bool { return tableDefaults[i].FamilyID >= familyID })
+	if i < len(tableDefaults) && tableDefaults[i].FamilyID == familyID {
+		// FamilyDefaultColumns may be shared with the table descriptor, so we
+		// can't insert in place.
+		cur := s.FamilyDefaultColumns
+		j := sort.Search(len(cur), func(j int) bool { return cur[j].FamilyID > familyID })
+		defaults := make([]fetchpb.IndexFetchSpec_FamilyDefaultColumn, 0, len(cur)+1)
+		defaults = append(defaults, cur[:j]...)
+		defaults = append(defaults, tableDefaults[i])
+		s.FamilyDefaultColumns = append(defaults, cur[j:]...)
+	}
+	return nil
+}
+
+// indexKeysPerRow returns the maximum number of KVs of a row in the index.
+// Unlike TableDescriptor.IndexKeysPerRow, it accounts for secondary indexes
+// with the original format, which encode all their stored columns in a single
+// KV regardless of the column families (see EncodeSecondaryIndex).
+func indexKeysPerRow(table catalog.TableDescriptor, index catalog.Index) int {
+	if index.GetEncodingType() == catenumpb.SecondaryIndexEncoding &&
+		index.GetVersion() == descpb.BaseIndexFormatVersion {
+		return 1
+	}
+	return table.IndexKeysPerRow(index)
+}
+
+// columnFamilyID returns the ID of the column family which contains the given
+// column.
+func columnFamilyID(
+	table catalog.TableDescriptor, colID descpb.ColumnID,
+) (descpb.FamilyID, bool) {
+	families := table.GetFamilies()
+	for i := range families {
+		for _, id := range families[i].ColumnIDs {
+			if id == colID {
+				return families[i].ID, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// FetchColumnType returns the type with which the column with ID colID is
+// fetched from the index, given its descriptor col. This is the type of the
+// column, except for the inverted column of an inverted index, in which case it
+// is the type of the data element encoded in the index key (see
+// catalog.Index.InvertedColumnKeyType).
+func FetchColumnType(index catalog.Index, col catalog.Column, colID descpb.ColumnID) *types.T {
+	if isInvertedKeyColumn(index, colID) {
+		return index.InvertedColumnKeyType()
+	}
+	return col.GetType()
+}
+
+// fetchColumnRole returns the role of a fetched column, given a spec with
+// initialized KeyAndSuffixColumns.
+func fetchColumnRole(
+	s *fetchpb.IndexFetchSpec, col catalog.Column,
+) fetchpb.IndexFetchSpec_ColumnRole {
+	for i := range s.KeyAndSuffixColumns {
+		if s.KeyAndSuffixColumns[i].ColumnID == col.GetID() {
+			return s.KeyAndSuffixColumns[i].Role
+		}
+	}
+	if col.IsSystemColumn() || col.IsVirtual() {
+		return fetchpb.IndexFetchSpec_NO_ROLE
+	}
+	return fetchpb.IndexFetchSpec_STORED
+}
+
+// isCompositeKeyColumn returns whether the given column is a composite key
+// column, given a spec with initialized KeyAndSuffixColumns.
+func isCompositeKeyColumn(s *fetchpb.IndexFetchSpec, colID descpb.ColumnID) bool {
+	for i := range s.KeyAndSuffixColumns {
+		if s.KeyAndSuffixColumns[i].ColumnID == colID {
+			return s.KeyAndSuffixColumns[i].IsComposite
+		}
+	}
+	return false
+}
+
+// valueFamilyID returns the column family in whose KV the value of the given
+// column is encoded in the index (see IndexFetchSpec_Column.FamilyID),
+// mirroring EncodePrimaryIndex and EncodeSecondaryIndex: the secondary index
+// encoding stores composite columns in family 0, as well as all the values of
+// inverted indexes and of indexes which predate column families in secondary
+// indexes.
+func valueFamilyID(
+	table catalog.TableDescriptor, index catalog.Index, col catalog.Column, isComposite bool,
+) descpb.FamilyID {
+	if table.NumFamilies() == 1 {
+		return table.GetFamilies()[0].ID
+	}
+	if index.GetEncodingType() == catenumpb.SecondaryIndexEncoding &&
+		(isComposite || index.GetType() == descpb.IndexDescriptor_INVERTED ||
+			index.GetVersion() == descpb.BaseIndexFormatVersion) {
+		return 0
+	}
+	families := table.GetFamilies()
+	for i := range families {
+		for _, id := range families[i].ColumnIDs {
+			if id == col.GetID() {
+				return families[i].ID
+			}
+		}
+	}
+	return 0
+}
+
+// checkArrayElementType returns an error if the type is an array type without
+// its element type, in which case the values of the column couldn't be
+// decoded. This can only happen for a corrupt descriptor.
+func checkArrayElementType(typ *types.T) error {
+	if typ.Family() != types.ArrayFamily {
+		return nil
+	}
+	if typ.ArrayContents() == nil {
+		return errors.AssertionFailedf("array type with OID %d has no element type", typ.Oid())
+	}
+	return checkArrayElementType(typ.ArrayContents())
+}
+
+// checkEnumTypeHydrated returns an error if the type is (or is an array of) an
+// enum type without its metadata, in which case the values of the column
+// couldn't be decoded. This can happen if the table descriptor was not read
+// through a descs.Collection.
+func checkEnumTypeHydrated(typ *types.T) error {
+	switch typ.Family() {
+	case types.EnumFamily:
+		if typ.TypeMeta.EnumData == nil {
+			return errors.AssertionFailedf("enum type with OID %d is not hydrated", typ.Oid())
+		}
+	case types.ArrayFamily:
+		return checkEnumTypeHydrated(typ.ArrayContents())
+	}
+	return nil
+}
+
+// isInvertedKeyColumn returns whether the given column is the inverted column
+// of an inverted index.
+func isInvertedKeyColumn(index catalog.Index, colID descpb.ColumnID) bool {
+	return index.GetType() == descpb.IndexDescriptor_INVERTED && colID == index.InvertedColumnID()
+}
+
+// InitIndexFetchSpecChecked is a variant of InitIndexFetchSpec which always
+// verifies that all fetch columns are available in the index and that no
+// column is fetched more than once (InitIndexFetchSpec only does so in test
+// builds). It should be used when the fetch columns don't come from a trusted
+// source.
+func InitIndexFetchSpecChecked(
+	s *fetchpb.IndexFetchSpec,
+	codec keys.SQLCodec,
+	table catalog.TableDescriptor,
+	index catalog.Index,
+	fetchColumnIDs []descpb.ColumnID,
+) error {
+	if err := InitIndexFetchSpec(s, codec, table, index, fetchColumnIDs); err != nil {
+		return err
+	}
+	if err := checkNoDuplicateFetchColumns(s, table); err != nil {
+		return err
+	}
+	return checkFetchColumnsInIndex(s, table, index)
+}
+
+// RehydrateIndexFetchSpec prepares a spec that was received over the wire (and
+// unmarshaled) for decoding: it verifies that the spec is internally
+// consistent and hydrates its user-defined types using the resolver (see
+// IndexFetchSpec.HydrateTypes). The resolver is expected to use the local
+// descriptors, so the types are resolved with the versions of the type
+// descriptors that are visible to the node.
+func RehydrateIndexFetchSpec(
+	ctx context.Context, s *fetchpb.IndexFetchSpec, resolver fetchpb.TypeHydrator,
+) error {
+	if err := checkIndexFetchSpecConsistency(s); err != nil {
+		return errors.Wrapf(err, "index %s of table %s", s.IndexName, s.TableName)
+	}
+	if err := s.HydrateTypes(ctx, resolver); err != nil {
+		return err
+	}
+	for i := range s.FetchedColumns {
+		if err := checkEnumTypeHydrated(s.FetchedColumns[i].Type); err != nil {
+			return errors.Wrapf(
+				err, "column %s of table %s", s.FetchedColumns[i].Name, s.TableName,
+			)
+		}
+	}
+	return nil
+}
+
+// checkIndexFetchSpecConsistency returns an error if the spec is not one that
+// the Init functions could have produced, in which case decoding with it would
+// fail (or produce garbage).
+func checkIndexFetchSpecConsistency(s *fetchpb.IndexFetchSpec) error {
+	if !fetchpb.IsSupportedIndexFetchSpecVersion(s.Version) {
+		return errors.AssertionFailedf("unsupported IndexFetchSpec version %d", s.Version)
+	}
+	if s.MaxKeysPerRow < 1 {
+		return errors.AssertionFailedf("invalid max keys per row %d", s.MaxKeysPerRow)
+	}
+	if s.KeyPrefixLength == 0 {
+		return errors.AssertionFailedf("missing key prefix length")
+	}
+	if int(s.NumKeySuffixColumns) > len(s.KeyAndSuffixColumns) {
+		return errors.AssertionFailedf(
+			"%d key suffix columns but only %d key and suffix columns",
+			s.NumKeySuffixColumns, len(s.KeyAndSuffixColumns),
+		)
+	}
+	for i := range s.KeyAndSuffixColumns {
+		c := &s.KeyAndSuffixColumns[i]
+		if c.Type == nil {
+			return errors.AssertionFailedf("key column %s (%d) has no type", c.Name, c.ColumnID)
+		}
+		if c.IsInverted && c.Type.Family() != types.EncodedKeyFamily {
+			return errors.AssertionFailedf(
+				"inverted column %s (%d) has type %s instead of the encoded key type",
+				c.Name, c.ColumnID, c.Type.SQLString(),
+			)
+		}
+		if err := checkArrayElementType(c.Type); err != nil {
+			return err
+		}
+	}
+	for i := range s.FetchedColumns {
+		c := &s.FetchedColumns[i]
+		if c.Type == nil {
+			return errors.AssertionFailedf("fetched column %s (%d) has no type", c.Name, c.ColumnID)
+		}
+		if err := checkArrayElementType(c.Type); err != nil {
+			return err
+		}
+	}
+	if len(s.ColumnToOutputIdx) != 0 && len(s.ColumnToOutputIdx) != len(s.FetchedColumns) {
+		return errors.AssertionFailedf(
+			"column to output mapping has %d entries for %d fetched columns",
+			len(s.ColumnToOutputIdx), len(s.FetchedColumns),
+		)
+	}
+	return nil
+}
+
+// InitIndexFetchSpecByName is a variant of InitIndexFetchSpec which takes the
+// names of the fetch columns instead of their IDs.
+//
+// The names are matched exactly against the column names in the descriptor, so
+// they are treated like quoted SQL identifiers; unquoted identifiers must be
+// normalized by the caller (see tree.Name.Normalize). It is an error if a name
+// doesn't match exactly one column or if it appears more than once.
+func InitIndexFetchSpecByName(
+	s *fetchpb.IndexFetchSpec,
+	codec keys.SQLCodec,
+	table catalog.TableDescriptor,
+	index catalog.Index,
+	fetchColumnNames []string,
+) error {
+	fetchColumnIDs := make([]descpb.ColumnID, len(fetchColumnNames))
+	for i, name := range fetchColumnNames {
+		for _, prev := range fetchColumnNames[:i] {
+			if prev == name {
+				return pgerror.Newf(pgcode.DuplicateColumn, "column %q specified more than once", name)
+			}
+		}
+		var found catalog.Column
+		for _, col := range table.AllColumns() {
+			if col.GetName() != name {
+				continue
+			}
+			if found != nil {
+				return pgerror.Newf(pgcode.AmbiguousColumn, "column reference %q is ambiguous", name)
+			}
+			found = col
+		}
+		if found == nil {
+			return pgerror.Newf(pgcode.UndefinedColumn, "column %q does not exist", name)
+		}
+		fetchColumnIDs[i] = found.GetID()
+	}
+	return InitIndexFetchSpec(s, codec, table, index, fetchColumnIDs)
+}
+
+// checkKeySuffixColumns returns an error if the number of key suffix columns
+// in KeyAndSuffixColumns (which come from the table's column cache) doesn't
+// match NumKeySuffixColumns (which comes from the index), in which case the
+// decoders would silently misinterpret the keys.
+func checkKeySuffixColumns(
+	s *fetchpb.IndexFetchSpec, table catalog.TableDescriptor, index catalog.Index,
+) error {
+	numKeyCols := len(s.KeyAndSuffixColumns) - int(s.NumKeySuffixColumns)
+	if numKeyCols != index.NumKeyColumns() {
+		return errors.AssertionFailedf(
+			"index %s (%d) of table %s has %d key and %d key suffix columns but %d key and suffix columns in the spec",
+			index.GetName(), index.GetID(), table.GetName(),
+			index.NumKeyColumns(), s.NumKeySuffixColumns, len(s.KeyAndSuffixColumns),
+		)
+	}
+	for i := numKeyCols; i < len(s.KeyAndSuffixColumns); i++ {
+		if col := &s.KeyAndSuffixColumns[i]; col.Role != fetchpb.IndexFetchSpec_KEY_SUFFIX {
+			return errors.AssertionFailedf(
+				"key suffix column %s (%d) of index %s (%d) of table %s has role %s",
+				col.Name, col.ColumnID, index.GetName(), index.GetID(), table.GetName(), col.Role,
+			)
+		}
+	}
+	return nil
+}
+
+// checkFamilyDefaultColumnsSorted returns an error if FamilyDefaultColumns
+// (which comes from the table descriptor) is not sorted by family ID, in which
+// case DefaultColumnForFamily wouldn't find all the families.
+func checkFamilyDefaultColumnsSorted(
+	s *fetchpb.IndexFetchSpec, table catalog.TableDescriptor,
+) error {
+	for i := 1; i < len(s.FamilyDefaultColumns); i++ {
+		if prev, cur := s.FamilyDefaultColumns[i-1].FamilyID, s.FamilyDefaultColumns[i].FamilyID; prev >= cur {
+			return errors.AssertionFailedf(
+				"family default columns of table %s are not sorted by family ID: %d before %d",
+				table.GetName(), prev, cur,
+			)
+		}
+	}
+	return nil
+}
+
+// checkFetchedColumnTypes returns an error if the type of a fetched key column
+// (which comes from the column) doesn't match the type of the key column (which
+// comes from the table's column cache), or if a column which is not the
+// inverted column of an inverted index has the type of an inverted key. In
+// particular, a JSONB or ARRAY column which is indexed by an inverted index is
+// fetched with its own type from the other indexes, since its values are
+// encoded like those of any other column.
+func checkFetchedColumnTypes(
+	s *fetchpb.IndexFetchSpec, table catalog.TableDescriptor, index catalog.Index,
+) error {
+	for i := range s.FetchedColumns {
+		col := &s.FetchedColumns[i]
+		if col.InKey() {
+			for j := range s.KeyAndSuffixColumns {
+				keyCol := &s.KeyAndSuffixColumns[j]
+				if keyCol.ColumnID == col.ColumnID && !keyCol.Type.Identical(col.Type) {
+					return errors.AssertionFailedf(
+						"fetched column %s (%d) has type %s but key column of index %s (%d) of table %s has type %s",
+						col.Name, col.ColumnID, col.Type.SQLString(), index.GetName(), index.GetID(),
+						table.GetName(), keyCol.Type.SQLString(),
+					)
+				}
+			}
+		}
+		if col.Type.Family() == types.EncodedKeyFamily && !isInvertedKeyColumn(index, col.ColumnID) {
+			return errors.AssertionFailedf(
+				"fetched column %s (%d) of index %s (%d) of table %s has the type of an inverted key",
+				col.Name, col.ColumnID, index.GetName(), index.GetID(), table.GetName(),
+			)
+		}
+	}
+	return nil
+}
+
+// checkNoDuplicateFetchColumns returns an error if a column appears more than
+// once in the fetched columns of the spec. Note that a column can legitimately
+// be both a key column and a fetched column (and, for composite columns, be
+// decoded from both the key and the value); that is not a duplicate.
+func checkNoDuplicateFetchColumns(s *fetchpb.IndexFetchSpec, table catalog.TableDescriptor) error {
+	var seen catalog.TableColSet
+	for i := range s.FetchedColumns {
+		col := &s.FetchedColumns[i]
+		if seen.Contains(col.ColumnID) {
+			return errors.AssertionFailedf(
+				"column %s (%d) of table %s is fetched more than once", col.Name, col.ColumnID, table.GetName(),
+			)
+		}
+		seen.Add(col.ColumnID)
+	}
+	return nil
+}
+
+// checkFetchColumnsInIndex returns an error if any of the fetched columns in
+// the spec is not available in the index, that is if it's not one of the key,
+// key suffix, or value columns (see indexValueColumnIDs). System columns are
+// synthesized by the fetcher and are available in all indexes. Virtual
+// columns which are not key columns are not encoded in the index data (their
+// role is NO_ROLE) and are computed by the caller, so they are available if
+// the columns they reference are (see checkVirtualColumnCovered).
+func checkFetchColumnsInIndex(
+	s *fetchpb.IndexFetchSpec, table catalog.TableDescriptor, index catalog.Index,
+) error {
+	colIDs := indexColumnIDs(table, index)
+	for i := range s.FetchedColumns {
+		col := &s.FetchedColumns[i]
+		if col.IsSystemColumn || colIDs.Contains(col.ColumnID) {
+			continue
+		}
+		if col.Role == fetchpb.IndexFetchSpec_NO_ROLE {
+			if err := checkVirtualColumnCovered(table, index, col, colIDs); err != nil {
+				return err
+			}
+			continue
+		}
+		return errors.AssertionFailedf(
+			"requested column %s (%d) not in index %s (%d) of table %s",
+			col.Name, col.ColumnID, index.GetName(), index.GetID(), table.GetName(),
+		)
+	}
+	return nil
+}
+
+// checkVirtualColumnsCovered returns an ErrVirtualColumnNotCovered error if a
+// fetched virtual column isn't a key column of the index and references a
+// column which isn't available in the index.
+func checkVirtualColumnsCovered(
+	s *fetchpb.IndexFetchSpec, table catalog.TableDescriptor, index catalog.Index,
+) error {
+	var colIDs catalog.TableColSet
+	for i := range s.FetchedColumns {
+		col := &s.FetchedColumns[i]
+		if col.Role != fetchpb.IndexFetchSpec_NO_ROLE || col.IsSystemColumn {
+			continue
+		}
+		if colIDs.Empty() {
+			colIDs = indexColumnIDs(table, index)
+		}
+		if err := checkVirtualColumnCovered(table, index, col, colIDs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkVirtualColumnCovered returns an ErrVirtualColumnNotCovered error if the
+// given fetched column is virtual and its expression references a column which
+// is not in colIDs (the columns available in the index).
+func checkVirtualColumnCovered(
+	table catalog.TableDescriptor,
+	index catalog.Index,
+	c *fetchpb.IndexFetchSpec_Column,
+	colIDs catalog.TableColSet,
+) error {
+	col, err := catalog.MustFindColumnByID(table, c.ColumnID)
+	if err != nil {
+		return err
+	}
+	if !col.IsVirtual() {
+		return errors.AssertionFailedf(
+			"column %s (%d) of table %s has no role in index %s (%d)",
+			c.Name, c.ColumnID, table.GetName(), index.GetName(), index.GetID(),
+		)
+	}
+	referenced, err := exprColumnIDs(table, col.GetComputeExpr())
+	if err != nil {
+		return errors.Wrapf(err, "computed expression of column %s", col.GetName())
+	}
+	if missing, ok := referenced.Difference(colIDs).Next(0); ok {
+		missingCol, err := catalog.MustFindColumnByID(table, missing)
+		if err != nil {
+			return err
+		}
+		return errors.Wrapf(ErrVirtualColumnNotCovered,
+			"virtual column %s of table %s references column %s, which is not in index %s",
+			col.GetName(), table.GetName(), missingCol.GetName(), index.GetName(),
+		)
+	}
+	return nil
+}
+
+// indexColumnIDs returns the IDs of the columns which are encoded in the index:
+// the key, key suffix and value columns.
+func indexColumnIDs(table catalog.TableDescriptor, index catalog.Index) catalog.TableColSet {
+	colIDs := index.CollectKeyColumnIDs()
+	colIDs.UnionWith(index.CollectKeySuffixColumnIDs())
+	colIDs.UnionWith(indexValueColumnIDs(table, index))
+	return colIDs
+}
+
+// indexValueColumnIDs returns the IDs of the stored columns of the index, which
+// are encoded in the KV values, according to the encoding type of the index
+// (which is the primary encoding for a secondary index that will become the
+// primary index). Under the primary encoding, the values are encoded per column
+// family, so a stored column which doesn't belong to any family isn't written.
+func indexValueColumnIDs(table catalog.TableDescriptor, index catalog.Index) catalog.TableColSet {
+	stored := catalog.MakeTableColSet(index.IndexDesc().StoreColumnIDs...)
+	if index.GetEncodingType() != catenumpb.PrimaryIndexEncoding {
+		return stored
+	}
+	var inFamilies catalog.TableColSet
+	families := table.GetFamilies()
+	for i := range families {
+		inFamilies.UnionWith(catalog.MakeTableColSet(families[i].ColumnIDs...))
+	}
+	return stored.Intersection(inFamilies)
+}
+
+// FormatIndexFetchSpec returns a human-readable, multi-line description of the
+// spec, intended for debugging and for test failure messages.
+func FormatIndexFetchSpec(s *fetchpb.IndexFetchSpec) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "table: %s (%d)\n", s.TableName, s.TableID)
+	fmt.Fprintf(&b, "index: %s (%d)", s.IndexName, s.IndexID)
+	if s.IsSecondaryIndex {
+		b.WriteString(", secondary")
+	} else {
+		b.WriteString(", primary")
+	}
+	if s.IsUniqueIndex {
+		b.WriteString(", unique")
+	}
+	if s.IsPartial {
+		b.WriteString(", partial")
+	}
+	if s.ShardBucketCount != 0 {
+		fmt.Fprintf(&b, ", hash-sharded (%d buckets, shard column %d)", s.ShardBucketCount, s.ShardColumnID)
+	}
+	if s.RegionColumnID != 0 {
+		fmt.Fprintf(&b, ", regional by row (region column %d)", s.RegionColumnID)
+	}
+	if s.TTLExpirationColumnID != 0 {
+		fmt.Fprintf(&b, ", row-level TTL (expiration column %d)", s.TTLExpirationColumnID)
+	}
+	fmt.Fprintf(&b, "\nencoding: %s", encodingTypeString(s.EncodingType))
+	fmt.Fprintf(
+		&b, ", max keys per row: %d, key prefix length: %d, max family ID: %d\n",
+		s.MaxKeysPerRow, s.KeyPrefixLength, s.MaxFamilyID,
+	)
+
+	formatKeyColumns := func(title string, cols []fetchpb.IndexFetchSpec_KeyColumn) {
+		fmt.Fprintf(&b, "%s:", title)
+		if len(cols) == 0 {
+			b.WriteString(" none\n")
+			return
+		}
+		b.WriteString("\n")
+		for i := range cols {
+			c := &cols[i]
+			fmt.Fprintf(&b, "  %s (%d) %s %s", c.Name, c.ColumnID, c.Type.SQLString(), c.Direction)
+			if c.IsComposite {
+				b.WriteString(" composite")
+			}
+			if c.IsInverted {
+				b.WriteString(" inverted")
+			}
+			if c.IsNonNullable {
+				b.WriteString(" not null")
+			}
+			b.WriteString("\n")
+		}
+	}
+	formatKeyColumns("key columns", s.KeyColumns())
+	formatKeyColumns("key suffix columns", s.KeySuffixColumns())
+
+	b.WriteString("fetched columns:")
+	if len(s.FetchedColumns) == 0 {
+		b.WriteString(" none")
+	}
+	for i := range s.FetchedColumns {
+		c := &s.FetchedColumns[i]
+		fmt.Fprintf(&b, "\n  %s (%d) %s", c.Name, c.ColumnID, c.Type.SQLString())
+		if c.IsNonNullable {
+			b.WriteString(" not null")
+		}
+		if c.IsSystemColumn {
+			b.WriteString(" system")
+		}
+	}
+
+	b.WriteString("\nfamily default columns:")
+	if len(s.FamilyDefaultColumns) == 0 {
+		b.WriteString(" none")
+	}
+	for _, f := range s.FamilyDefaultColumns {
+		fmt.Fprintf(&b, "\n  family %d: column %d", f.FamilyID, f.DefaultColumnID)
+	}
+	return b.String()
+}
+
+// encodingTypeString returns a human-readable name for the encoding type.
+func encodingTypeString(t catenumpb.IndexDescriptorEncodingType) string {
+	switch t {
+	case catenumpb.PrimaryIndexEncoding:
+		return "primary"
+	case catenumpb.SecondaryIndexEncoding:
+		return "secondary"
+	default:
+		return fmt.Sprintf("unknown (%d)", t)
+	}
+}
+
+// IndexFetchSpecJSONVersion is the version of the JSON representation produced
+// by MarshalIndexFetchSpecJSON. It must be incremented whenever the
+// representation changes in a backward-incompatible way.
+const IndexFetchSpecJSONVersion = 1
+
+// indexFetchSpecJSON is the JSON representation of an IndexFetchSpec produced
+// by MarshalIndexFetchSpecJSON.
+type indexFetchSpecJSON struct {
+	FormatVersion        int                       `json:"format_version"`
+	SpecVersion          uint32                    `json:"spec_version"`
+	TableID              descpb.ID                 `json:"table_id"`
+	TableName            string                    `json:"table_name"`
+	IndexID              descpb.IndexID            `json:"index_id"`
+	IndexName            string                    `json:"index_name"`
+	IsSecondaryIndex     bool                      `json:"is_secondary_index"`
+	IsUniqueIndex        bool                      `json:"is_unique_index"`
+	IsPartial            bool                      `json:"is_partial"`
+	EncodingType         string                    `json:"encoding_type"`
+	NumKeySuffixColumns  uint32                    `json:"num_key_suffix_columns"`
+	MaxKeysPerRow        uint32                    `json:"max_keys_per_row"`
+	KeyPrefixLength      uint32                    `json:"key_prefix_length"`
+	MaxFamilyID          descpb.FamilyID           `json:"max_family_id"`
+	FamilyDefaultColumns []familyDefaultColumnJSON `json:"family_default_columns"`
+	KeyAndSuffixColumns  []keyColumnJSON           `json:"key_and_suffix_columns"`
+	FetchedColumns       []columnJSON              `json:"fetched_columns"`
+}
+
+type columnJSON struct {
+	ColumnID      descpb.ColumnID `json:"column_id"`
+	Name          string          `json:"name"`
+	Type          string          `json:"type"`
+	IsNonNullable bool            `json:"is_non_nullable"`
+	Role          string          `json:"role"`
+}
+
+type keyColumnJSON struct {
+	columnJSON
+	Direction   string `json:"direction"`
+	IsComposite bool   `json:"is_composite"`
+	IsInverted  bool   `json:"is_inverted"`
+}
+
+type familyDefaultColumnJSON struct {
+	FamilyID        descpb.FamilyID `json:"family_id"`
+	DefaultColumnID descpb.ColumnID `json:"default_column_id"`
+}
+
+func makeColumnJSON(c *fetchpb.IndexFetchSpec_Column) columnJSON {
+	return columnJSON{
+		ColumnID:      c.ColumnID,
+		Name:          c.Name,
+		Type:          c.Type.SQLString(),
+		IsNonNullable: c.IsNonNullable,
+		Role:          c.Role.String(),
+	}
+}
+
+// MarshalIndexFetchSpecJSON returns a stable JSON representation of the spec,
+// intended for consumers outside of the database (e.g. tooling). Unlike the
+// JSON encoding of the proto, column types are represented by their SQL names
+// and enums by their names. The object contains a format_version field (see
+// IndexFetchSpecJSONVersion).
+func MarshalIndexFetchSpecJSON(s *fetchpb.IndexFetchSpec) ([]byte, error) {
+	res := indexFetchSpecJSON{
+		FormatVersion:        IndexFetchSpecJSONVersion,
+		SpecVersion:          s.Version,
+		TableID:              s.TableID,
+		TableName:            s.TableName,
+		IndexID:              s.IndexID,
+		IndexName:            s.IndexName,
+		IsSecondaryIndex:     s.IsSecondaryIndex,
+		IsUniqueIndex:        s.IsUniqueIndex,
+		IsPartial:            s.IsPartial,
+		EncodingType:         encodingTypeString(s.EncodingType),
+		NumKeySuffixColumns:  s.NumKeySuffixColumns,
+		MaxKeysPerRow:        s.MaxKeysPerRow,
+		KeyPrefixLength:      s.KeyPrefixLength,
+		MaxFamilyID:          s.MaxFamilyID,
+		FamilyDefaultColumns: make([]familyDefaultColumnJSON, len(s.FamilyDefaultColumns)),
+		KeyAndSuffixColumns:  make([]keyColumnJSON, len(s.KeyAndSuffixColumns)),
+		FetchedColumns:       make([]columnJSON, len(s.FetchedColumns)),
+	}
+	for i, f := range s.FamilyDefaultColumns {
+		res.FamilyDefaultColumns[i] = familyDefaultColumnJSON{
+			FamilyID:        f.FamilyID,
+			DefaultColumnID: f.DefaultColumnID,
+		}
+	}
+	for i := range s.KeyAndSuffixColumns {
+		c := &s.KeyAndSuffixColumns[i]
+		res.KeyAndSuffixColumns[i] = keyColumnJSON{
+			columnJSON:  makeColumnJSON(&c.IndexFetchSpec_Column),
+			Direction:   c.Direction.String(),
+			IsComposite: c.IsComposite,
+			IsInverted:  c.IsInverted,
+		}
+	}
+	for i := range s.FetchedColumns {
+		res.FetchedColumns[i] = makeColumnJSON(&s.FetchedColumns[i])
+	}
+	return json.Marshal(&res)
+}
+
+// IndexFetchSpecsCompatible returns whether KVs can be decoded using spec a
+// in the same way as using spec b. Differences that don't affect decoding (like
+// table, index or column names) are ignored. See IndexFetchSpecsDiff.
+func IndexFetchSpecsCompatible(a, b *fetchpb.IndexFetchSpec) bool {
+	return IndexFetchSpecsDiff(a, b) == ""
+}
+
+// IndexFetchSpecsDiff returns a description of the differences between the two
+// specs that affect decoding, one per line, or the empty string if the specs
+// are compatible.
+func IndexFetchSpecsDiff(a, b *fetchpb.IndexFetchSpec) string {
+	var diffs []string
+	addDiff := func(format string, args ...interface{}) {
+		diffs = append(diffs, fmt.Sprintf(format, args...))
+	}
+	if a.Version != b.Version {
+		addDiff("version: %d vs %d", a.Version, b.Version)
+	}
+	if a.TableID != b.TableID {
+		addDiff("table ID: %d vs %d", a.TableID, b.TableID)
+	}
+	if a.IndexID != b.IndexID {
+		addDiff("index ID: %d vs %d", a.IndexID, b.IndexID)
+	}
+	if a.IsSecondaryIndex != b.IsSecondaryIndex {
+		addDiff("secondary index: %t vs %t", a.IsSecondaryIndex, b.IsSecondaryIndex)
+	}
+	if a.IsUniqueIndex != b.IsUniqueIndex {
+		addDiff("unique index: %t vs %t", a.IsUniqueIndex, b.IsUniqueIndex)
+	}
+	if a.EncodingType != b.EncodingType {
+		addDiff("encoding type: %d vs %d", a.EncodingType, b.EncodingType)
+	}
+	if a.IsTemporaryIndex != b.IsTemporaryIndex {
+		addDiff("temporary index: %t vs %t", a.IsTemporaryIndex, b.IsTemporaryIndex)
+	}
+	if a.NumKeySuffixColumns != b.NumKeySuffixColumns {
+		addDiff("key suffix columns: %d vs %d", a.NumKeySuffixColumns, b.NumKeySuffixColumns)
+	}
+	if a.MaxKeysPerRow != b.MaxKeysPerRow {
+		addDiff("max keys per row: %d vs %d", a.MaxKeysPerRow, b.MaxKeysPerRow)
+	}
+	if a.MaxFamilyID != b.MaxFamilyID {
+		addDiff("max family ID: %d vs %d", a.MaxFamilyID, b.MaxFamilyID)
+	}
+
+	if len(a.FamilyDefaultColumns) != len(b.FamilyDefaultColumns) {
+		addDiff("family default columns: %d vs %d", len(a.FamilyDefaultColumns), len(b.FamilyDefaultColumns))
+	} else {
+		for i := range a.FamilyDefaultColumns {
+			fa, fb := &a.FamilyDefaultColumns[i], &b.FamilyDefaultColumns[i]
+			if fa.FamilyID != fb.FamilyID || fa.DefaultColumnID != fb.DefaultColumnID {
+				addDiff(
+					"family default column %d: family %d column %d vs family %d column %d",
+					i, fa.FamilyID, fa.DefaultColumnID, fb.FamilyID, fb.DefaultColumnID,
+				)
+			}
+		}
+	}
+
+	if len(a.KeyAndSuffixColumns) != len(b.KeyAndSuffixColumns) {
+		addDiff("key and suffix columns: %d vs %d", len(a.KeyAndSuffixColumns), len(b.KeyAndSuffixColumns))
+	} else {
+		for i := range a.KeyAndSuffixColumns {
+			ca, cb := &a.KeyAndSuffixColumns[i], &b.KeyAndSuffixColumns[i]
+			if ca.ColumnID != cb.ColumnID {
+				addDiff("key column %d: column ID %d vs %d", i, ca.ColumnID, cb.ColumnID)
+			}
+			if !ca.Type.Identical(cb.Type) {
+				addDiff("key column %d (%s): type %s vs %s", i, cb.Name, ca.Type.SQLString(), cb.Type.SQLString())
+			}
+			if ca.Direction != cb.Direction {
+				addDiff("key column %d (%s): direction %s vs %s", i, cb.Name, ca.Direction, cb.Direction)
+			}
+			if ca.IsComposite != cb.IsComposite {
+				addDiff("key column %d (%s): composite %t vs %t", i, cb.Name, ca.IsComposite, cb.IsComposite)
+			}
+			if ca.IsInverted != cb.IsInverted {
+				addDiff("key column %d (%s): inverted %t vs %t", i, cb.Name, ca.IsInverted, cb.IsInverted)
+			}
+		}
+	}
+
+	if len(a.FetchedColumns) != len(b.FetchedColumns) {
+		addDiff("fetched columns: %d vs %d", len(a.FetchedColumns), len(b.FetchedColumns))
+	} else {
+		for i := range a.FetchedColumns {
+			ca, cb := &a.FetchedColumns[i], &b.FetchedColumns[i]
+			if ca.ColumnID != cb.ColumnID {
+				addDiff("fetched column %d: column ID %d vs %d", i, ca.ColumnID, cb.ColumnID)
+			}
+			if !ca.Type.Identical(cb.Type) {
+				addDiff("fetched column %d (%s): type %s vs %s", i, cb.Name, ca.Type.SQLString(), cb.Type.SQLString())
+			}
+		}
+	}
+	return strings.Join(diffs, "\n")
+}
+
+// IndexKeyOrdering returns the order of the index in terms of the fetched
+// columns of the spec: the ColIdx of each element is an ordinal in
+// FetchedColumns. It contains the longest prefix of the key and key suffix
+// columns (IndexFetchSpec.KeyAndSuffixColumns) which are all fetched, since the
+// rows are not ordered by the columns which follow a column that isn't fetched.
+// An inverted column ends the ordering as well, since its fetched values can't
+// be compared like the encoded keys.
+//
+// Unlike in IndexFetchSpec.KeyFullColumns, the key suffix columns of a unique
+// secondary index are included: the rows with a NULL key column are ordered by
+// the suffix columns, and the other rows have distinct values of the key
+// columns. This matters when merging the rows of two scans, since rows with
+// NULL keys would otherwise compare as equal.
+func IndexKeyOrdering(s *fetchpb.IndexFetchSpec) colinfo.ColumnOrdering {
+	keyCols := s.KeyAndSuffixColumns
+	ordering := make(colinfo.ColumnOrdering, 0, len(keyCols))
+	for i := range keyCols {
+		if keyCols[i].IsInverted {
+			break
+		}
+		idx := -1
+		for j := range s.FetchedColumns {
+			if s.FetchedColumns[j].ColumnID == keyCols[i].ColumnID {
+				idx = j
+				break
+			}
+		}
+		if idx == -1 {
+			break
+		}
+		ordering = append(ordering, colinfo.ColumnOrderInfo{
+			ColIdx:    idx,
+			Direction: keyCols[i].EncodingDirection(),
+		})
+	}
+	return ordering
+}
+
+// NewKeyComparator returns a function which compares two rows of fetched
+// columns (in the order of FetchedColumns) according to IndexKeyOrdering,
+// returning a negative value if a comes first in the index, a positive value if
+// b comes first, and 0 if the rows can be in either order. NULLs come first in
+// ascending columns and last in descending columns, like in the key encoding
+// (see IndexFetchSpec_KeyColumn.NullsLast), so the comparator agrees with the
+// order of the KVs of the index. It can be used to merge the rows of scans of
+// the same index (e.g. by a merge join).
+func NewKeyComparator(
+	s *fetchpb.IndexFetchSpec, evalCtx *eval.Context,
+) func(a, b tree.Datums) int {
+	ordering := IndexKeyOrdering(s)
+	return func(a, b tree.Datums) int {
+		return colinfo.CompareDatums(ordering, evalCtx, a, b)
+	}
 }
@@ -11,21 +11,58 @@
 package rowenc_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/geo/geoindex"
 	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/kv"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/server/telemetry"
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/sql"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/catenumpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/catpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/colinfo"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descs"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/desctestutils"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/fetchpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/tabledesc"
+	"github.com/cockroachdb/cockroach/pkg/sql/isql"
+	"github.com/cockroachdb/cockroach/pkg/sql/randgen"
+	"github.com/cockroachdb/cockroach/pkg/sql/row"
 	"github.com/cockroachdb/cockroach/pkg/sql/rowenc"
+	"github.com/cockroachdb/cockroach/pkg/sql/rowenc/rowencpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/rowenc/rowenctest"
+	"github.com/cockroachdb/cockroach/pkg/sql/rowenc/valueside"
+	"github.com/cockroachdb/cockroach/pkg/sql/rowinfra"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/eval"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/sqltelemetry"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
 	"github.com/cockroachdb/cockroach/pkg/testutils/datapathutils"
 	"github.com/cockroachdb/cockroach/pkg/testutils/serverutils"
+	"github.com/cockroachdb/cockroach/pkg/testutils/sqlutils"
+	"github.com/cockroachdb/cockroach/pkg/util/buildutil"
+	"github.com/cockroachdb/cockroach/pkg/util/encoding"
+	"github.com/cockroachdb/cockroach/pkg/util/intsets"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/cockroachdb/cockroach/pkg/util/trigram"
 	"github.com/cockroachdb/datadriven"
+	"github.com/cockroachdb/errors"
+	"github.com/lib/pq/oid"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v2"
 )
 
@@ -49,11 +86,14 @@ func TestInitIndexFetchSpec(t *testing.T) {
 				}
 				return ""
 
-			case "index-fetch":
+			case "index-fetch", "format-index-fetch", "marshal-index-fetch-json", "index-fetch-methods":
 				var params struct {
 					Table   string
 					Index   string
 					Columns []string
+					// Methods are the IndexFetchSpec methods whose results are shown by
+					// index-fetch-methods.
+					Methods []string
 				}
 				if err := yaml.UnmarshalStrict([]byte(d.Input), &params); err != nil {
 					d.Fatalf(t, "failed to parse index-fetch params: %v", err)
@@ -77,6 +117,22 @@ func TestInitIndexFetchSpec(t *testing.T) {
 				if err := rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs); err != nil {
 					d.Fatalf(t, "%+v", err)
 				}
+				switch d.Cmd {
+				case "format-index-fetch":
+					return rowenc.FormatIndexFetchSpec(&spec)
+				case "index-fetch-methods":
+					return formatIndexFetchSpecMethods(t, d, &spec, params.Methods)
+				case "marshal-index-fetch-json":
+					res, err := rowenc.MarshalIndexFetchSpecJSON(&spec)
+					if err != nil {
+						d.Fatalf(t, "%+v", err)
+					}
+					var buf bytes.Buffer
+					if err := json.Indent(&buf, res, "", "  "); err != nil {
+						d.Fatalf(t, "%+v", err)
+					}
+					return buf.String()
+				}
 				res, err := json.MarshalIndent(&spec, "", "  ")
 				if err != nil {
 					d.Fatalf(t, "%+v", err)
@@ -90,3 +146,4732 @@ func TestInitIndexFetchSpec(t *testing.T) {
 		},
 	)
 }
+
+// formatIndexFetchSpecMethods returns the results of the given methods of the
+// spec, one per line.
+func formatIndexFetchSpecMethods(
+	t *testing.T, d *datadriven.TestData, spec *fetchpb.IndexFetchSpec, methods []string,
+) string {
+	var b strings.Builder
+	for _, method := range methods {
+		var res interface{}
+		switch method {
+		case "KeyColumnDirections":
+			res = spec.KeyColumnDirections()
+		case "AllAscending":
+			res = spec.AllAscending()
+		case "NumFetchedKeyColumns":
+			res = spec.NumFetchedKeyColumns()
+		case "SingleKVPerRow":
+			res = spec.SingleKVPerRow()
+		case "AllReferencedColumnIDs":
+			res = spec.AllReferencedColumnIDs().Ordered()
+		case "NullsLast":
+			nullsLast := make([]bool, len(spec.KeyAndSuffixColumns))
+			for i := range spec.KeyAndSuffixColumns {
+				nullsLast[i] = spec.KeyAndSuffixColumns[i].NullsLast()
+			}
+			res = nullsLast
+		case "InKey", "InValue":
+			// Show the names of the fetched columns for which the method returns
+			// true.
+			names := []string{}
+			for i := range spec.FetchedColumns {
+				c := &spec.FetchedColumns[i]
+				if (method == "InKey" && c.InKey()) || (method == "InValue" && c.InValue()) {
+					names = append(names, c.Name)
+				}
+			}
+			res = names
+		default:
+			d.Fatalf(t, "unknown method %s", method)
+		}
+		fmt.Fprintf(&b, "%s: %v\n", method, res)
+	}
+	return b.String()
+}
+
+// columnIDsByName returns the IDs of the given columns of the table.
+func columnIDsByName(
+	t testing.TB, table catalog.TableDescriptor, names ...string,
+) []descpb.ColumnID {
+	ids := make([]descpb.ColumnID, len(names))
+	for i, name := range names {
+		col, err := catalog.MustFindColumnByName(table, name)
+		require.NoError(t, err)
+		ids[i] = col.GetID()
+	}
+	return ids
+}
+
+// makeColumnDropping returns a copy of the table descriptor in which the given
+// column is being dropped: it is a DROP mutation and it is no longer stored in
+// the primary index.
+func makeColumnDropping(
+	t *testing.T, table catalog.TableDescriptor, colName string,
+) catalog.TableDescriptor {
+	mut := tabledesc.NewBuilder(table.TableDesc()).BuildExistingMutableTable()
+	col, err := catalog.MustFindColumnByName(mut, colName)
+	require.NoError(t, err)
+	colDesc := col.ColumnDescDeepCopy()
+	mut.RemoveColumnFromFamilyAndPrimaryIndex(colDesc.ID)
+	for i := range mut.Columns {
+		if mut.Columns[i].ID == colDesc.ID {
+			mut.Columns = append(mut.Columns[:i], mut.Columns[i+1:]...)
+			break
+		}
+	}
+	mut.AddColumnMutation(&colDesc, descpb.DescriptorMutation_DROP)
+	return mut.ImmutableCopy().(catalog.TableDescriptor)
+}
+
+func TestInitIndexFetchSpecChecked(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (a INT PRIMARY KEY, b INT, c INT, d INT, INDEX b_idx (b) STORING (c))`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	primary := table.GetPrimaryIndex()
+	secondary, err := catalog.MustFindIndexByName(table, "b_idx")
+	require.NoError(t, err)
+
+	var spec fetchpb.IndexFetchSpec
+	for _, tc := range []struct {
+		index   catalog.Index
+		columns []string
+		err     string
+	}{
+		{index: primary, columns: []string{"a", "b", "c", "d"}},
+		{index: secondary, columns: []string{"a", "b", "c"}},
+		{index: secondary, columns: []string{"d"}, err: "requested column d (4) not in index b_idx (2) of table t"},
+	} {
+		err := rowenc.InitIndexFetchSpecChecked(
+			&spec, keys.SystemSQLCodec, table, tc.index, columnIDsByName(t, table, tc.columns...),
+		)
+		if tc.err == "" {
+			require.NoError(t, err)
+			require.Len(t, spec.FetchedColumns, len(tc.columns))
+		} else {
+			require.ErrorContains(t, err, tc.err)
+		}
+	}
+
+	// A column that is being dropped is no longer stored in the primary index.
+	dropping := makeColumnDropping(t, table, "d")
+	err = rowenc.InitIndexFetchSpecChecked(
+		&spec, keys.SystemSQLCodec, dropping, dropping.GetPrimaryIndex(),
+		columnIDsByName(t, dropping, "a", "d"),
+	)
+	require.ErrorContains(t, err, "requested column d (4) not in index t_pkey (1) of table t")
+
+	// InitIndexFetchSpec doesn't check the columns of primary indexes, even in
+	// test builds, since some of its callers fetch mutation columns.
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, dropping, dropping.GetPrimaryIndex(),
+		columnIDsByName(t, dropping, "a", "d"),
+	))
+}
+
+func TestFetchColumnType(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  j JSONB,
+  arr INT[],
+  g GEOMETRY,
+  p INT,
+  INVERTED INDEX j_idx (j),
+  INVERTED INDEX arr_idx (arr),
+  INVERTED INDEX g_idx (g),
+  INVERTED INDEX pj_idx (p, j),
+  INDEX fwd_idx (p)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	for _, tc := range []struct {
+		index    string
+		column   string
+		expected *types.T
+	}{
+		{index: "j_idx", column: "j", expected: types.EncodedKey},
+		{index: "j_idx", column: "k", expected: types.Int},
+		{index: "arr_idx", column: "arr", expected: types.EncodedKey},
+		{index: "g_idx", column: "g", expected: types.EncodedKey},
+		{index: "pj_idx", column: "p", expected: types.Int},
+		{index: "pj_idx", column: "j", expected: types.EncodedKey},
+		{index: "fwd_idx", column: "p", expected: types.Int},
+		{index: "t_pkey", column: "j", expected: types.Jsonb},
+	} {
+		index, err := catalog.MustFindIndexByName(table, tc.index)
+		require.NoError(t, err)
+		col, err := catalog.MustFindColumnByName(table, tc.column)
+		require.NoError(t, err)
+		typ := rowenc.FetchColumnType(index, col, col.GetID())
+		require.Truef(t, typ.Identical(tc.expected), "%s.%s: expected %s, got %s",
+			tc.index, tc.column, tc.expected.SQLString(), typ.SQLString())
+	}
+}
+
+// fetchRows scans the given spans with a row.Fetcher initialized using the
+// spec and returns the decoded rows.
+func fetchRows(
+	t testing.TB, kvDB *kv.DB, spec *fetchpb.IndexFetchSpec, spans roachpb.Spans,
+) []tree.Datums {
+	ctx := context.Background()
+	var rf row.Fetcher
+	require.NoError(t, rf.Init(ctx, row.FetcherInitArgs{
+		Txn:   kvDB.NewTxn(ctx, "fetch-rows"),
+		Alloc: &tree.DatumAlloc{},
+		Spec:  spec,
+	}))
+	defer rf.Close(ctx)
+	require.NoError(t, rf.StartScan(
+		ctx, spans, nil /* spanIDs */, rowinfra.NoBytesLimit, rowinfra.NoRowLimit,
+	))
+	var rows []tree.Datums
+	for {
+		datums, err := rf.NextRowDecoded(ctx)
+		require.NoError(t, err)
+		if datums == nil {
+			return rows
+		}
+		rows = append(rows, append(tree.Datums(nil), datums...))
+	}
+}
+
+func TestInitIndexFetchSpecForFamilies(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY, a INT, b INT, c INT, d INT,
+  FAMILY f0 (k, a), FAMILY f1 (b), FAMILY f2 (c), FAMILY f3 (d)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 10, 20, 30, 40), (2, 11, 21, 31, 41)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	for _, tc := range []struct {
+		columns        []string
+		families       []descpb.FamilyID
+		expectedRowTwo string
+	}{
+		{columns: []string{"k", "a", "c"}, families: []descpb.FamilyID{0, 2}, expectedRowTwo: "(2, 11, 31)"},
+		{columns: []string{"k", "d"}, families: []descpb.FamilyID{0, 3}, expectedRowTwo: "(2, 41)"},
+		{columns: []string{"b", "c"}, families: []descpb.FamilyID{1, 2}, expectedRowTwo: "(21, 31)"},
+		// Only one family is needed, so each row has a single KV.
+		{columns: []string{"k", "a"}, families: []descpb.FamilyID{0}, expectedRowTwo: "(2, 11)"},
+	} {
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpecForFamilies(
+			&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(),
+			columnIDsByName(t, table, tc.columns...), tc.families,
+		))
+		require.Equal(t, tc.families[len(tc.families)-1], spec.MaxFamilyID)
+		require.Equal(t, uint32(len(tc.families)), spec.MaxKeysPerRow)
+		require.Equal(t, len(tc.families) == 1, spec.SingleKVPerRow())
+		for _, f := range spec.FamilyDefaultColumns {
+			require.Contains(t, tc.families, f.FamilyID)
+		}
+
+		// Only scan the needed families of the second row.
+		rowKey := rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), table.GetPrimaryIndexID())
+		rowKey = encoding.EncodeVarintAscending(rowKey, 2)
+		spans := rowenc.SplitRowKeyIntoFamilySpans(nil /* appendTo */, rowKey, tc.families)
+		rows := fetchRows(t, kvDB, &spec, spans)
+		require.Len(t, rows, 1)
+		require.Equal(t, tc.expectedRowTwo, tree.AsString(&rows[0]))
+	}
+
+	// The family of a fetched column must be needed.
+	var spec fetchpb.IndexFetchSpec
+	err := rowenc.InitIndexFetchSpecForFamilies(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(),
+		columnIDsByName(t, table, "k", "a", "c"), []descpb.FamilyID{0, 1},
+	)
+	require.True(t, errors.HasAssertionFailure(err))
+	require.ErrorContains(t, err, "column c (4) of index t_pkey (1) of table t is encoded in family 2, which is not needed")
+}
+
+// TestIndexFetchSpecMixedValueFormats verifies that a single spec decodes rows
+// whose values for the same column family are in different formats: the
+// fetcher chooses the decoding of each KV from the tag of its value, so no
+// extra state is needed in the spec to read an index while its rows are being
+// rewritten in a different format.
+func TestIndexFetchSpecMixedValueFormats(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (k INT PRIMARY KEY, a INT, b INT, FAMILY f0 (k, a), FAMILY f1 (b))`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 10, 20), (2, 11, 21)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	bID := columnIDsByName(t, table, "b")[0]
+	require.Equal(t, bID, table.GetFamilies()[1].DefaultColumnID)
+
+	// The value of family f1 is encoded as a single column value because the
+	// family has a default column. Rewrite it for the second row in the tuple
+	// format, which is used for families without one.
+	rowKey := rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), table.GetPrimaryIndexID())
+	rowKey = encoding.EncodeVarintAscending(rowKey, 2)
+	tuple, err := valueside.Encode(nil /* appendTo */, valueside.MakeColumnIDDelta(0, bID), tree.NewDInt(21), nil /* scratch */)
+	require.NoError(t, err)
+	var value roachpb.Value
+	value.SetTuple(tuple)
+	require.NoError(t, kvDB.Put(context.Background(), keys.MakeFamilyKey(rowKey, 1), &value))
+
+	// The fetcher decodes each value according to its tag (see
+	// row.Fetcher.processKV), so the same spec decodes both formats without
+	// knowing that the index contains a mix of them.
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), columnIDsByName(t, table, "k", "a", "b"),
+	))
+	rows := fetchRows(t, kvDB, &spec, roachpb.Spans{table.PrimaryIndexSpan(keys.SystemSQLCodec)})
+	require.Len(t, rows, 2)
+	require.Equal(t, "(1, 10, 20)", tree.AsString(&rows[0]))
+	require.Equal(t, "(2, 11, 21)", tree.AsString(&rows[1]))
+}
+
+func TestIndexFetchSpecNeededFamilyIDs(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY, a INT, b INT, c DECIMAL, d INT, e INT, f INT,
+  FAMILY f0 (k, a), FAMILY f1 (b, c), FAMILY f2 (d), FAMILY f3 (e, f),
+  INDEX a_idx (a) STORING (d),
+  INDEX c_idx (c) STORING (e)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 10, 20, 3.50, 40, 50, 60), (2, 11, 21, 3.51, 41, 51, 61)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	for _, tc := range []struct {
+		index    string
+		columns  []string
+		mvcc     bool
+		expected []descpb.FamilyID
+		// expectedRowTwo is the last row fetched. For the primary index, it is
+		// fetched from the needed families only.
+		expectedRowTwo string
+	}{
+		// Two of the four families are needed, in addition to family 0.
+		{index: "t_pkey", columns: []string{"k", "b", "e"}, expected: []descpb.FamilyID{0, 1, 3}, expectedRowTwo: "(2, 21, 51)"},
+		{index: "t_pkey", columns: []string{"c", "d"}, expected: []descpb.FamilyID{0, 1, 2}, expectedRowTwo: "(3.51, 41)"},
+		{index: "t_pkey", columns: []string{"k", "a"}, expected: []descpb.FamilyID{0}, expectedRowTwo: "(2, 11)"},
+		// The values of a system column depend on all the families.
+		{index: "t_pkey", columns: []string{"k"}, mvcc: true, expected: []descpb.FamilyID{0, 1, 2, 3}},
+		// Stored columns are in the family of the column, but composite columns
+		// are in family 0.
+		{index: "a_idx", columns: []string{"a", "d", "k"}, expected: []descpb.FamilyID{0, 2}, expectedRowTwo: "(11, 41, 2)"},
+		{index: "c_idx", columns: []string{"c", "k"}, expected: []descpb.FamilyID{0}, expectedRowTwo: "(3.51, 2)"},
+		{index: "c_idx", columns: []string{"c", "e"}, expected: []descpb.FamilyID{0, 3}, expectedRowTwo: "(3.51, 51)"},
+	} {
+		index, err := catalog.MustFindIndexByName(table, tc.index)
+		require.NoError(t, err)
+		fetchColumnIDs := columnIDsByName(t, table, tc.columns...)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+			&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs,
+			rowenc.IndexFetchSpecOptions{WithMVCCTimestamp: tc.mvcc},
+		))
+		neededFamilies := spec.NeededFamilyIDs()
+		require.Equal(t, tc.expected, neededFamilies, "%s: %v", tc.index, tc.columns)
+		if tc.mvcc {
+			continue
+		}
+
+		var spans roachpb.Spans
+		if index.Primary() {
+			// The row can be fetched from the needed families only.
+			require.NoError(t, rowenc.InitIndexFetchSpecForFamilies(
+				&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs, neededFamilies,
+			))
+			rowKey := rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID())
+			rowKey = encoding.EncodeVarintAscending(rowKey, 2)
+			spans = rowenc.SplitRowKeyIntoFamilySpans(nil /* appendTo */, rowKey, neededFamilies)
+		} else {
+			prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+			spans = roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}}
+		}
+		rows := fetchRows(t, kvDB, &spec, spans)
+		require.Equal(t, tc.expectedRowTwo, tree.AsString(&rows[len(rows)-1]), "%s: %v", tc.index, tc.columns)
+	}
+
+	// The families of the columns are not part of the initial version.
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), columnIDsByName(t, table, "k", "b", "e"),
+		rowenc.IndexFetchSpecOptions{TargetVersion: fetchpb.IndexFetchSpecVersionInitial},
+	))
+	for i := range spec.FetchedColumns {
+		require.Zero(t, spec.FetchedColumns[i].FamilyID)
+	}
+}
+
+func TestRoundTripWithFetchSpec(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k STRING COLLATE en_US PRIMARY KEY,
+  d DECIMAL,
+  s STRING,
+  FAMILY (k, d), FAMILY (s),
+  INDEX d_idx (d) STORING (s),
+  UNIQUE INDEX dk_idx (d DESC, k),
+  INDEX s_idx (s)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	var env tree.CollationEnvironment
+	k, err := tree.NewDCollatedString("b", "en_US", &env)
+	require.NoError(t, err)
+	d, err := tree.ParseDDecimal("1.50")
+	require.NoError(t, err)
+	rows := []tree.Datums{
+		{k, d, tree.NewDString("foo")},
+		{k, tree.DNull, tree.DNull},
+	}
+
+	for _, index := range table.ActiveIndexes() {
+		var spec fetchpb.IndexFetchSpec
+		var fetchColumnIDs []descpb.ColumnID
+		for _, col := range table.IndexColumns(index) {
+			fetchColumnIDs = append(fetchColumnIDs, col.GetID())
+		}
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs,
+		))
+		for _, r := range rows {
+			rowenctest.RoundTripWithFetchSpec(t, keys.SystemSQLCodec, table, &spec, r)
+		}
+	}
+}
+
+func TestVerifyTypeRoundTrip(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	typs := append([]*types.T(nil), types.Scalar...)
+	typs = append(typs,
+		types.MakeTimeTZ(0),
+		types.MakeTimeTZ(3),
+		types.MakeInterval(types.IntervalTypeMetadata{Precision: 0, PrecisionIsSet: true}),
+		types.MakeInterval(types.IntervalTypeMetadata{Precision: 3, PrecisionIsSet: true}),
+		types.MakeInterval(types.IntervalTypeMetadata{
+			DurationField: types.IntervalDurationField{DurationType: types.IntervalDurationType_DAY},
+		}),
+		types.MakeVarBit(8),
+		types.MakeBit(4),
+		types.MakeDecimal(10, 2),
+		types.MakeVarChar(5),
+		types.MakeCollatedString(types.String, "en_US"),
+		types.IntArray,
+		types.MakeArray(types.Decimal),
+	)
+	for _, typ := range typs {
+		t.Run(typ.SQLString(), func(t *testing.T) {
+			rowenctest.VerifyTypeRoundTrip(t, typ)
+		})
+	}
+}
+
+func TestInitIndexFetchSpecVirtualColumnDependencies(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  a INT PRIMARY KEY,
+  b INT,
+  c INT,
+  v INT AS (b + c + b) VIRTUAL,
+  INDEX v_idx (v)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	vIdx, err := catalog.MustFindIndexByName(table, "v_idx")
+	require.NoError(t, err)
+	fetchCols := columnIDsByName(t, table, "a", "v")
+	expected := columnIDsByName(t, table, "b", "c")
+
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, table, vIdx, fetchCols,
+		rowenc.IndexFetchSpecOptions{IncludeVirtualColumnDependencies: true},
+	))
+	require.Equal(t, expected, spec.VirtualColumnDependencyIDs)
+
+	// The dependencies are not populated unless requested.
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, table, vIdx, fetchCols, rowenc.IndexFetchSpecOptions{},
+	))
+	require.Nil(t, spec.VirtualColumnDependencyIDs)
+
+	// No dependencies if no virtual columns are fetched.
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(),
+		columnIDsByName(t, table, "a", "b", "c"),
+		rowenc.IndexFetchSpecOptions{IncludeVirtualColumnDependencies: true},
+	))
+	require.Nil(t, spec.VirtualColumnDependencyIDs)
+}
+
+// BenchmarkInitIndexFetchSpec measures re-initializing a spec for the same
+// index, as done by lookup and index joins. In the steady state this should
+// not allocate.
+func BenchmarkInitIndexFetchSpec(b *testing.B) {
+	defer leaktest.AfterTest(b)()
+
+	srv, db, kvDB := serverutils.StartServer(b, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(b, `CREATE TABLE t (
+  a INT PRIMARY KEY,
+  b INT,
+  c STRING,
+  d DECIMAL,
+  INDEX bc_idx (b, c DESC) STORING (d),
+  FAMILY (a, b),
+  FAMILY (c, d)
+)`)
+	sqlDB.Exec(b, `CREATE TABLE t_ttl (
+  a INT PRIMARY KEY,
+  b INT,
+  expire_at TIMESTAMPTZ
+) WITH (ttl_expiration_expression = 'expire_at')`)
+	for _, tc := range []struct {
+		table, index string
+		opts         rowenc.IndexFetchSpecOptions
+	}{
+		{table: "t", index: "t_pkey"},
+		{table: "t", index: "bc_idx"},
+		// The TTL expiration column is only computed on request, so the TTL
+		// doesn't affect the default case.
+		{table: "t_ttl", index: "t_ttl_pkey"},
+		{table: "t_ttl", index: "t_ttl_pkey", opts: rowenc.IndexFetchSpecOptions{IncludeTTLExpirationColumn: true}},
+	} {
+		name := tc.index
+		if tc.opts.IncludeTTLExpirationColumn {
+			name += "/ttl-expiration-column"
+		}
+		b.Run(name, func(b *testing.B) {
+			table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", tc.table)
+			index, err := catalog.MustFindIndexByName(table, tc.index)
+			require.NoError(b, err)
+			var fetchColumnIDs []descpb.ColumnID
+			for _, col := range table.PublicColumns() {
+				fetchColumnIDs = append(fetchColumnIDs, col.GetID())
+			}
+			var spec fetchpb.IndexFetchSpec
+			require.NoError(b, rowenc.InitIndexFetchSpecWithOptions(
+				&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs, tc.opts,
+			))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := rowenc.InitIndexFetchSpecWithOptions(
+					&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs, tc.opts,
+				); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkAcquireIndexFetchSpec compares allocating a new spec for every
+// lookup with reusing specs from the pool.
+func BenchmarkAcquireIndexFetchSpec(b *testing.B) {
+	defer leaktest.AfterTest(b)()
+
+	srv, db, kvDB := serverutils.StartServer(b, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(b, `CREATE TABLE t (a INT PRIMARY KEY, b INT, c STRING, d DECIMAL)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	index := table.GetPrimaryIndex()
+	fetchColumnIDs := columnIDsByName(b, table, "a", "b", "c", "d")
+
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			spec := &fetchpb.IndexFetchSpec{}
+			if err := rowenc.InitIndexFetchSpec(
+				spec, keys.SystemSQLCodec, table, index, fetchColumnIDs,
+			); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			spec := rowenc.AcquireIndexFetchSpec()
+			if err := rowenc.InitIndexFetchSpec(
+				spec, keys.SystemSQLCodec, table, index, fetchColumnIDs,
+			); err != nil {
+				b.Fatal(err)
+			}
+			rowenc.ReleaseIndexFetchSpec(spec)
+		}
+	})
+}
+
+func TestReleaseIndexFetchSpec(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (a INT PRIMARY KEY, b INT, c STRING)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	spec := rowenc.AcquireIndexFetchSpec()
+	require.Empty(t, spec.FetchedColumns)
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), columnIDsByName(t, table, "a", "b", "c"),
+	))
+	fetchedCols := spec.FetchedColumns
+	rowenc.ReleaseIndexFetchSpec(spec)
+
+	// The spec is reset, but it keeps the backing array of the fetched columns
+	// (whose contents are cleared).
+	require.Equal(t, fetchpb.IndexFetchSpec{FetchedColumns: fetchedCols[:0]}, *spec)
+	require.Equal(t, 3, cap(spec.FetchedColumns))
+	for i := range fetchedCols {
+		require.Equal(t, fetchpb.IndexFetchSpec_Column{}, fetchedCols[i])
+	}
+
+	// Specs which were not acquired from the pool can be released too.
+	rowenc.ReleaseIndexFetchSpec(&fetchpb.IndexFetchSpec{})
+	require.Empty(t, rowenc.AcquireIndexFetchSpec().FetchedColumns)
+}
+
+func TestOnFetchSpecAlloc(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (a INT PRIMARY KEY, b INT, c STRING)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	var allocs []string
+	rowenc.OnFetchSpecAlloc = func(kind string, n int) {
+		allocs = append(allocs, fmt.Sprintf("%s: %d", kind, n))
+	}
+	defer func() { rowenc.OnFetchSpecAlloc = nil }()
+
+	// The first initialization allocates the fetched columns.
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), columnIDsByName(t, table, "a", "b", "c"),
+	))
+	require.Equal(t, []string{"FetchedColumns: 3"}, allocs)
+
+	// Re-initializing the spec with the same or fewer columns reuses them.
+	allocs = nil
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), columnIDsByName(t, table, "a", "b", "c"),
+	))
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), columnIDsByName(t, table, "c"),
+	))
+	require.Empty(t, allocs)
+
+	// A capacity hint which exceeds the current capacity allocates upfront.
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), columnIDsByName(t, table, "a", "b"),
+		rowenc.IndexFetchSpecOptions{FetchedColumnsCapacityHint: 8},
+	))
+	require.Equal(t, []string{"FetchedColumns: 8"}, allocs)
+
+	// Invalid arguments are rejected before anything is allocated, and the spec
+	// keeps its slice.
+	allocs = nil
+	fetched := spec.FetchedColumns
+	for _, tc := range []struct {
+		codec keys.SQLCodec
+		opts  rowenc.IndexFetchSpecOptions
+	}{
+		{codec: keys.SQLCodec{}, opts: rowenc.IndexFetchSpecOptions{FetchedColumnsCapacityHint: 16}},
+		{codec: keys.SystemSQLCodec, opts: rowenc.IndexFetchSpecOptions{
+			FetchedColumnsCapacityHint: 16, TargetVersion: 1000,
+		}},
+	} {
+		require.Error(t, rowenc.InitIndexFetchSpecWithOptions(
+			&spec, tc.codec, table, table.GetPrimaryIndex(), columnIDsByName(t, table, "a"), tc.opts,
+		))
+	}
+	require.Empty(t, allocs)
+	require.Same(t, &fetched[0], &spec.FetchedColumns[0])
+}
+
+func TestInitIndexFetchSpecHashSharded(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  a INT PRIMARY KEY,
+  b INT,
+  INDEX b_idx (b) USING HASH WITH (bucket_count = 16)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	shardIdx, err := catalog.MustFindIndexByName(table, "b_idx")
+	require.NoError(t, err)
+	shardCol, err := catalog.MustFindColumnByName(table, "crdb_internal_b_shard_16")
+	require.NoError(t, err)
+
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, shardIdx, columnIDsByName(t, table, "a", "b"),
+	))
+	require.Equal(t, shardCol.GetID(), spec.ShardColumnID)
+	require.Equal(t, uint32(16), spec.ShardBucketCount)
+	require.Equal(t, shardCol.GetID(), spec.KeyColumns()[0].ColumnID)
+
+	// The fields are reset when the spec is reused for an index that is not
+	// hash-sharded.
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), columnIDsByName(t, table, "a", "b"),
+	))
+	require.Zero(t, spec.ShardColumnID)
+	require.Zero(t, spec.ShardBucketCount)
+}
+
+func TestInitIndexFetchSpecNullInvertedKey(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  arr INT[] NOT NULL,
+  INVERTED INDEX arr_idx (arr)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, ARRAY[1]), (2, ARRAY[NULL]), (3, ARRAY[NULL, 2])`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	arrIdx, err := catalog.MustFindIndexByName(table, "arr_idx")
+	require.NoError(t, err)
+
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, arrIdx, columnIDsByName(t, table, "k", "arr"),
+	))
+	// The column is not nullable, but the inverted key for a NULL array element
+	// is NULL.
+	require.False(t, spec.FetchedColumns[1].IsNonNullable)
+	invertedCol := spec.KeyColumns()[0]
+	require.True(t, invertedCol.IsInverted)
+	require.False(t, invertedCol.IsNonNullable)
+	// The primary key column is still non-nullable.
+	require.True(t, spec.FetchedColumns[0].IsNonNullable)
+
+	prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), arrIdx.GetID()))
+	rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+	// NULL elements sort first.
+	require.Len(t, rows, 4)
+	for i, expectedKey := range []string{"2", "3"} {
+		require.Equal(t, expectedKey, rows[i][0].String())
+		require.Equal(t, tree.DNull, rows[i][1])
+	}
+	for _, row := range rows[2:] {
+		require.NotEqual(t, tree.DNull, row[1])
+	}
+}
+
+func TestInitIndexFetchSpecStoredColumnsByFamily(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  a INT, b INT, c INT, d INT, e INT,
+  FAMILY f0 (k, a), FAMILY f1 (b, c), FAMILY f2 (d), FAMILY f3 (e),
+  INDEX four_idx (e) STORING (a, b, c, d),
+  INDEX one_idx (e) STORING (d),
+  INDEX none_idx (e)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	ids := func(names ...string) []descpb.ColumnID {
+		return columnIDsByName(t, table, names...)
+	}
+	for _, tc := range []struct {
+		index    string
+		expected []fetchpb.IndexFetchSpec_FamilyStoredColumns
+	}{
+		{
+			index: "four_idx",
+			expected: []fetchpb.IndexFetchSpec_FamilyStoredColumns{
+				{FamilyID: 0, StoredColumnIDs: ids("a")},
+				{FamilyID: 1, StoredColumnIDs: ids("b", "c")},
+				{FamilyID: 2, StoredColumnIDs: ids("d")},
+			},
+		},
+		{
+			index: "one_idx",
+			expected: []fetchpb.IndexFetchSpec_FamilyStoredColumns{
+				{FamilyID: 2, StoredColumnIDs: ids("d")},
+			},
+		},
+		{index: "none_idx"},
+		{index: "t_pkey"},
+	} {
+		t.Run(tc.index, func(t *testing.T) {
+			index, err := catalog.MustFindIndexByName(table, tc.index)
+			require.NoError(t, err)
+			var spec fetchpb.IndexFetchSpec
+			require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+				&spec, keys.SystemSQLCodec, table, index, ids("k"),
+				rowenc.IndexFetchSpecOptions{IncludeStoredColumnsByFamily: true},
+			))
+			require.Equal(t, tc.expected, spec.StoredColumnsByFamily)
+
+			if index.Primary() {
+				return
+			}
+			// The grouping must match the one used by the write path.
+			familyToColumns := rowenc.MakeFamilyToColumnMap(index, table)
+			for _, f := range spec.StoredColumnsByFamily {
+				var written []descpb.ColumnID
+				for _, c := range familyToColumns[f.FamilyID] {
+					written = append(written, c.ColID)
+				}
+				require.ElementsMatch(t, written, f.StoredColumnIDs)
+			}
+		})
+	}
+}
+
+func TestInitIndexFetchSpecByName(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (k INT PRIMARY KEY, "MixedCase" INT, lower INT)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	primary := table.GetPrimaryIndex()
+
+	var spec, expected fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpecByName(
+		&spec, keys.SystemSQLCodec, table, primary, []string{"MixedCase", "k"},
+	))
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&expected, keys.SystemSQLCodec, table, primary, columnIDsByName(t, table, "MixedCase", "k"),
+	))
+	require.Equal(t, expected, spec)
+
+	for _, tc := range []struct {
+		names []string
+		err   string
+	}{
+		// Names are case-sensitive.
+		{names: []string{"mixedcase"}, err: `column "mixedcase" does not exist`},
+		{names: []string{"LOWER"}, err: `column "LOWER" does not exist`},
+		{names: []string{"nonexistent"}, err: `column "nonexistent" does not exist`},
+		{names: []string{"k", "lower", "k"}, err: `column "k" specified more than once`},
+	} {
+		err := rowenc.InitIndexFetchSpecByName(&spec, keys.SystemSQLCodec, table, primary, tc.names)
+		require.ErrorContains(t, err, tc.err)
+	}
+}
+
+// TestInitIndexFetchSpecCollatedString verifies that the types in the spec
+// preserve the locale of collated string columns, which is needed to
+// reconstruct the original values from the index.
+func TestInitIndexFetchSpecCollatedString(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  s STRING COLLATE en_US,
+  INDEX s_idx (s),
+  UNIQUE INDEX s_desc_idx (s DESC)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 'Ünïcode' COLLATE en_US), (2, 'abc' COLLATE en_US), (3, NULL)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	expected := map[string]string{"1": "Ünïcode", "2": "abc"}
+
+	for _, index := range table.ActiveIndexes() {
+		t.Run(index.GetName(), func(t *testing.T) {
+			var spec fetchpb.IndexFetchSpec
+			require.NoError(t, rowenc.InitIndexFetchSpec(
+				&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k", "s"),
+			))
+			require.Equal(t, types.CollatedStringFamily, spec.FetchedColumns[1].Type.Family())
+			require.Equal(t, "en_US", spec.FetchedColumns[1].Type.Locale())
+			for i := range spec.KeyAndSuffixColumns {
+				if c := &spec.KeyAndSuffixColumns[i]; c.Name == "s" {
+					require.Equal(t, "en_US", c.Type.Locale())
+					require.True(t, c.IsComposite)
+				}
+			}
+
+			prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+			rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+			require.Len(t, rows, 3)
+			for _, row := range rows {
+				contents, ok := expected[row[0].String()]
+				if !ok {
+					require.Equal(t, tree.DNull, row[1])
+					continue
+				}
+				d, ok := row[1].(*tree.DCollatedString)
+				require.Truef(t, ok, "expected collated string, got %T", row[1])
+				require.Equal(t, contents, d.Contents)
+				require.Equal(t, "en_US", d.Locale)
+			}
+		})
+	}
+}
+
+func TestIndexFetchSpecsDiff(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (a INT PRIMARY KEY, b INT, c INT, d INT, INDEX b_idx (b) STORING (c))`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	makeSpec := func(table catalog.TableDescriptor, columns ...string) *fetchpb.IndexFetchSpec {
+		index, err := catalog.MustFindIndexByName(table, "b_idx")
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, columns...),
+		))
+		return &spec
+	}
+	orig := makeSpec(table, "a", "b", "c")
+	require.True(t, rowenc.IndexFetchSpecsCompatible(orig, orig))
+
+	// Changing the type of a column.
+	mut := tabledesc.NewBuilder(table.TableDesc()).BuildExistingMutableTable()
+	mut.Columns[1].Type = types.Int4
+	spec := makeSpec(mut.ImmutableCopy().(catalog.TableDescriptor), "a", "b", "c")
+	require.False(t, rowenc.IndexFetchSpecsCompatible(orig, spec))
+	require.Equal(t,
+		"key column 0 (b): type INT8 vs INT4\nfetched column 1 (b): type INT8 vs INT4",
+		rowenc.IndexFetchSpecsDiff(orig, spec),
+	)
+	require.NotEqual(t, orig.Fingerprint(), spec.Fingerprint())
+
+	// Adding a stored column only matters if we fetch it.
+	mut = tabledesc.NewBuilder(table.TableDesc()).BuildExistingMutableTable()
+	mut.Indexes[0].StoreColumnIDs = append(mut.Indexes[0].StoreColumnIDs, mut.Columns[3].ID)
+	mut.Indexes[0].StoreColumnNames = append(mut.Indexes[0].StoreColumnNames, mut.Columns[3].Name)
+	withStored := mut.ImmutableCopy().(catalog.TableDescriptor)
+	require.True(t, rowenc.IndexFetchSpecsCompatible(orig, makeSpec(withStored, "a", "b", "c")))
+	spec = makeSpec(withStored, "a", "b", "c", "d")
+	require.False(t, rowenc.IndexFetchSpecsCompatible(orig, spec))
+	require.Equal(t, "fetched columns: 3 vs 4", rowenc.IndexFetchSpecsDiff(orig, spec))
+
+	// Renames are benign.
+	sqlDB.Exec(t, `ALTER TABLE t RENAME COLUMN b TO b2`)
+	sqlDB.Exec(t, `ALTER INDEX t@b_idx RENAME TO b_idx2`)
+	sqlDB.Exec(t, `ALTER TABLE t RENAME TO t2`)
+	renamed := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t2")
+	index, err := catalog.MustFindIndexByName(renamed, "b_idx2")
+	require.NoError(t, err)
+	var renamedSpec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&renamedSpec, keys.SystemSQLCodec, renamed, index, columnIDsByName(t, renamed, "a", "b2", "c"),
+	))
+	require.NotEqual(t, orig.TableName, renamedSpec.TableName)
+	require.True(t, rowenc.IndexFetchSpecsCompatible(orig, &renamedSpec))
+	require.Empty(t, rowenc.IndexFetchSpecsDiff(orig, &renamedSpec))
+	// Compatible specs have the same fingerprint.
+	require.Equal(t, orig.Fingerprint(), renamedSpec.Fingerprint())
+}
+
+func TestInitIndexFetchSpecPartialIndex(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  a INT,
+  b INT,
+  c STRING,
+  INDEX partial_idx (a) WHERE c = 'foo' AND b > 0 AND b < 10,
+  INDEX full_idx (a)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	opts := rowenc.IndexFetchSpecOptions{IncludePredicateColumns: true}
+	fetchCols := columnIDsByName(t, table, "k", "a")
+
+	partialIdx, err := catalog.MustFindIndexByName(table, "partial_idx")
+	require.NoError(t, err)
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, table, partialIdx, fetchCols, opts,
+	))
+	require.True(t, spec.IsPartial)
+	require.Equal(t, columnIDsByName(t, table, "b", "c"), spec.PredicateColumnIDs)
+
+	// IsPartial is always set, but the predicate columns are only populated on
+	// request.
+	require.NoError(t, rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, table, partialIdx, fetchCols))
+	require.True(t, spec.IsPartial)
+	require.Nil(t, spec.PredicateColumnIDs)
+
+	fullIdx, err := catalog.MustFindIndexByName(table, "full_idx")
+	require.NoError(t, err)
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, table, fullIdx, fetchCols, opts,
+	))
+	require.False(t, spec.IsPartial)
+	require.Nil(t, spec.PredicateColumnIDs)
+}
+
+func TestInitIndexFetchSpecPartialIndexTypes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TYPE status_enum AS ENUM ('active', 'inactive')`)
+	sqlDB.Exec(t, `CREATE TYPE color_enum AS ENUM ('red', 'blue')`)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  a INT,
+  status status_enum,
+  tags status_enum[],
+  c STRING,
+  INDEX status_idx (a) WHERE status = 'active',
+  INDEX tags_idx (a) WHERE c != 'red'::color_enum::STRING AND array_length(tags, 1) > 0,
+  INDEX plain_idx (a) WHERE c = 'foo',
+  INDEX full_idx (a)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	statusID := desctestutils.TestingGetPublicTypeDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "status_enum").GetID()
+	colorID := desctestutils.TestingGetPublicTypeDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "color_enum").GetID()
+	opts := rowenc.IndexFetchSpecOptions{IncludePredicateColumns: true}
+	fetchCols := columnIDsByName(t, table, "k", "a")
+
+	for _, tc := range []struct {
+		index    string
+		expected []descpb.ID
+	}{
+		{index: "status_idx", expected: []descpb.ID{statusID}},
+		{index: "tags_idx", expected: []descpb.ID{statusID, colorID}},
+		{index: "plain_idx", expected: nil},
+		{index: "full_idx", expected: nil},
+	} {
+		t.Run(tc.index, func(t *testing.T) {
+			index, err := catalog.MustFindIndexByName(table, tc.index)
+			require.NoError(t, err)
+			var spec fetchpb.IndexFetchSpec
+			require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+				&spec, keys.SystemSQLCodec, table, index, fetchCols, opts,
+			))
+			require.Equal(t, tc.expected, spec.PredicateTypeIDs)
+
+			// The type IDs are only populated along with the predicate columns.
+			require.NoError(t, rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, table, index, fetchCols))
+			require.Nil(t, spec.PredicateTypeIDs)
+		})
+	}
+}
+
+func TestInitIndexFetchSpecs(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  a INT PRIMARY KEY, b INT, c STRING, d DECIMAL,
+  INDEX b_idx (b) STORING (d),
+  UNIQUE INDEX c_idx (c DESC, b),
+  FAMILY (a, b), FAMILY (c), FAMILY (d)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	indexes := table.ActiveIndexes()
+	fetchColumnIDs := [][]descpb.ColumnID{
+		columnIDsByName(t, table, "a", "b", "c", "d"),
+		columnIDsByName(t, table, "d", "a"),
+		columnIDsByName(t, table, "c"),
+	}
+	require.Len(t, indexes, len(fetchColumnIDs))
+
+	for _, codec := range []keys.SQLCodec{keys.SystemSQLCodec, keys.MakeSQLCodec(roachpb.MustMakeTenantID(10))} {
+		specs := make([]fetchpb.IndexFetchSpec, len(indexes))
+		require.NoError(t, rowenc.InitIndexFetchSpecs(specs, codec, table, indexes, fetchColumnIDs))
+		for i := range specs {
+			var expected fetchpb.IndexFetchSpec
+			require.NoError(t, rowenc.InitIndexFetchSpec(&expected, codec, table, indexes[i], fetchColumnIDs[i]))
+			require.Equal(t, expected, specs[i])
+		}
+
+		// The FetchedColumns slices are reused.
+		fetchedCols := specs[0].FetchedColumns
+		require.NoError(t, rowenc.InitIndexFetchSpecs(specs[:1], codec, table, indexes[:1], fetchColumnIDs[:1]))
+		require.Same(t, &fetchedCols[0], &specs[0].FetchedColumns[0])
+	}
+
+	err := rowenc.InitIndexFetchSpecs(
+		make([]fetchpb.IndexFetchSpec, 2), keys.SystemSQLCodec, table, indexes, fetchColumnIDs,
+	)
+	require.ErrorContains(t, err, "mismatched lengths: 2 specs, 3 indexes, 3 fetch column lists")
+}
+
+func BenchmarkInitIndexFetchSpecs(b *testing.B) {
+	defer leaktest.AfterTest(b)()
+
+	srv, db, kvDB := serverutils.StartServer(b, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(b, `CREATE TABLE t (
+  a INT PRIMARY KEY, b INT, c INT, d INT, e INT,
+  INDEX (b), INDEX (c), INDEX (d), INDEX (e),
+  FAMILY (a, b), FAMILY (c), FAMILY (d), FAMILY (e)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	indexes := table.ActiveIndexes()
+	fetchColumnIDs := make([][]descpb.ColumnID, len(indexes))
+	for i, idx := range indexes {
+		fetchColumnIDs[i] = []descpb.ColumnID{idx.GetKeyColumnID(0)}
+	}
+	specs := make([]fetchpb.IndexFetchSpec, len(indexes))
+
+	b.Run("single", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for j := range specs {
+				if err := rowenc.InitIndexFetchSpec(
+					&specs[j], keys.SystemSQLCodec, table, indexes[j], fetchColumnIDs[j],
+				); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := rowenc.InitIndexFetchSpecs(
+				specs, keys.SystemSQLCodec, table, indexes, fetchColumnIDs,
+			); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestInitIndexFetchSpecRequireReadableIndex(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (a INT PRIMARY KEY, b INT, INDEX b_idx (b))`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	// Make a copy of the descriptor where b_idx is a delete-only index that is
+	// being added.
+	mut := tabledesc.NewBuilder(table.TableDesc()).BuildExistingMutableTable()
+	idxDesc := mut.Indexes[0]
+	mut.Indexes = nil
+	mut.Mutations = append(mut.Mutations, descpb.DescriptorMutation{
+		Descriptor_: &descpb.DescriptorMutation_Index{Index: &idxDesc},
+		State:       descpb.DescriptorMutation_DELETE_ONLY,
+		Direction:   descpb.DescriptorMutation_ADD,
+		MutationID:  1,
+	})
+	deleteOnly := mut.ImmutableCopy().(catalog.TableDescriptor)
+	index, err := catalog.MustFindIndexByName(deleteOnly, "b_idx")
+	require.NoError(t, err)
+	require.True(t, index.DeleteOnly())
+
+	fetchCols := columnIDsByName(t, deleteOnly, "a", "b")
+	var spec fetchpb.IndexFetchSpec
+	err = rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, deleteOnly, index, fetchCols,
+		rowenc.IndexFetchSpecOptions{RequireReadableIndex: true},
+	)
+	require.True(t, errors.Is(err, rowenc.ErrIndexNotReadable))
+	require.ErrorContains(t, err, "index b_idx of table t is delete-only")
+
+	// Without the option (as used by schema changes), the spec is built.
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, deleteOnly, index, fetchCols, rowenc.IndexFetchSpecOptions{},
+	))
+	require.NoError(t, rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, deleteOnly, index, fetchCols))
+
+	// Public indexes are readable.
+	publicIdx, err := catalog.MustFindIndexByName(table, "b_idx")
+	require.NoError(t, err)
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, table, publicIdx, fetchCols,
+		rowenc.IndexFetchSpecOptions{RequireReadableIndex: true},
+	))
+}
+
+func TestInitIndexFetchSpecColumnRoles(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  a INT PRIMARY KEY,
+  b INT NULL,
+  c INT,
+  v INT AS (a + c) VIRTUAL,
+  UNIQUE INDEX b_idx (b) STORING (c)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	bIdx, err := catalog.MustFindIndexByName(table, "b_idx")
+	require.NoError(t, err)
+
+	const (
+		key    = fetchpb.IndexFetchSpec_KEY
+		suffix = fetchpb.IndexFetchSpec_KEY_SUFFIX
+		stored = fetchpb.IndexFetchSpec_STORED
+		none   = fetchpb.IndexFetchSpec_NO_ROLE
+	)
+	for _, tc := range []struct {
+		index           catalog.Index
+		fetchColumnIDs  []descpb.ColumnID
+		keyAndSuffix    []fetchpb.IndexFetchSpec_ColumnRole
+		expectedFetched []fetchpb.IndexFetchSpec_ColumnRole
+	}{
+		{
+			// The primary key column is an implicit suffix column of the unique
+			// index, which is only part of the key if b is NULL.
+			index:           bIdx,
+			fetchColumnIDs:  columnIDsByName(t, table, "a", "b", "c"),
+			keyAndSuffix:    []fetchpb.IndexFetchSpec_ColumnRole{key, suffix},
+			expectedFetched: []fetchpb.IndexFetchSpec_ColumnRole{suffix, key, stored},
+		},
+		{
+			index: table.GetPrimaryIndex(),
+			fetchColumnIDs: append(
+				columnIDsByName(t, table, "c", "a", "b", "v"), colinfo.MVCCTimestampColumnID,
+			),
+			keyAndSuffix:    []fetchpb.IndexFetchSpec_ColumnRole{key},
+			expectedFetched: []fetchpb.IndexFetchSpec_ColumnRole{stored, key, stored, none, none},
+		},
+	} {
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, tc.index, tc.fetchColumnIDs,
+		))
+		var keyAndSuffix, fetched []fetchpb.IndexFetchSpec_ColumnRole
+		for i := range spec.KeyAndSuffixColumns {
+			keyAndSuffix = append(keyAndSuffix, spec.KeyAndSuffixColumns[i].Role)
+		}
+		for i := range spec.FetchedColumns {
+			fetched = append(fetched, spec.FetchedColumns[i].Role)
+		}
+		require.Equal(t, tc.keyAndSuffix, keyAndSuffix, tc.index.GetName())
+		require.Equal(t, tc.expectedFetched, fetched, tc.index.GetName())
+		require.Len(t, spec.KeySuffixColumns(), int(spec.NumKeySuffixColumns))
+	}
+}
+
+func TestInitIndexFetchSpecKeyOnly(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY, a INT, b INT, c INT,
+  FAMILY f0 (k, a), FAMILY f1 (b), FAMILY f2 (c),
+  INDEX a_idx (a) STORING (b, c)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 10, 20, 30), (2, 11, 21, 31)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	aIdx, err := catalog.MustFindIndexByName(table, "a_idx")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		index       catalog.Index
+		columns     []string
+		keyVal      int64
+		expectedRow string
+	}{
+		{index: table.GetPrimaryIndex(), columns: []string{"k"}, keyVal: 2, expectedRow: "(2)"},
+		{index: aIdx, columns: []string{"a", "k"}, keyVal: 11, expectedRow: "(11, 2)"},
+	} {
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpecKeyOnly(
+			&spec, keys.SystemSQLCodec, table, tc.index, columnIDsByName(t, table, tc.columns...),
+		))
+		require.Equal(t, descpb.FamilyID(0), spec.MaxFamilyID)
+		require.Equal(t, uint32(1), spec.MaxKeysPerRow)
+		require.Empty(t, spec.FamilyDefaultColumns)
+
+		// Only scan family 0 of the row.
+		rowKey := rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), tc.index.GetID())
+		rowKey = encoding.EncodeVarintAscending(rowKey, tc.keyVal)
+		if tc.index.GetID() != table.GetPrimaryIndexID() {
+			rowKey = encoding.EncodeVarintAscending(rowKey, 2)
+		}
+		spans := rowenc.SplitRowKeyIntoFamilySpans(nil /* appendTo */, rowKey, []descpb.FamilyID{0})
+		rows := fetchRows(t, kvDB, &spec, spans)
+		require.Len(t, rows, 1)
+		require.Equal(t, tc.expectedRow, tree.AsString(&rows[0]))
+	}
+
+	// Stored columns can't be fetched.
+	var spec fetchpb.IndexFetchSpec
+	require.Error(t, rowenc.InitIndexFetchSpecKeyOnly(
+		&spec, keys.SystemSQLCodec, table, aIdx, columnIDsByName(t, table, "a", "b"),
+	))
+
+	// Composite key columns can't be fetched from the primary index if their
+	// values are encoded outside family 0.
+	sqlDB.Exec(t, `CREATE TABLE composite (
+  d DECIMAL PRIMARY KEY, x INT, e DECIMAL, UNIQUE INDEX e_idx (e),
+  FAMILY (x), FAMILY (d, e)
+)`)
+	composite := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "composite")
+	require.ErrorContains(t, rowenc.InitIndexFetchSpecKeyOnly(
+		&spec, keys.SystemSQLCodec, composite, composite.GetPrimaryIndex(),
+		columnIDsByName(t, composite, "d"),
+	), "composite key column d (1) of index composite_pkey (1) of table composite is encoded in family 1")
+	// The secondary index encoding stores the composite key columns in family 0.
+	eIdx, err := catalog.MustFindIndexByName(composite, "e_idx")
+	require.NoError(t, err)
+	require.NoError(t, rowenc.InitIndexFetchSpecKeyOnly(
+		&spec, keys.SystemSQLCodec, composite, eIdx, columnIDsByName(t, composite, "e", "d"),
+	))
+
+	// After a write that only touches family 1, the MVCC timestamp of family 0
+	// is older than the one of the row, so system columns can't be fetched from
+	// family 0 of a table with multiple families.
+	sqlDB.Exec(t, `UPDATE t SET b = 22 WHERE k = 2`)
+	tsColumns := append(columnIDsByName(t, table, "k"), colinfo.MVCCTimestampColumnID)
+	require.ErrorContains(t, rowenc.InitIndexFetchSpecKeyOnly(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), tsColumns,
+	), "system column crdb_internal_mvcc_timestamp")
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), tsColumns,
+	))
+	rowKey := rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), table.GetPrimaryIndexID())
+	rowKey = encoding.EncodeVarintAscending(rowKey, 2)
+	family0Rows := fetchRows(t, kvDB, &spec, rowenc.SplitRowKeyIntoFamilySpans(
+		nil /* appendTo */, rowKey, []descpb.FamilyID{0},
+	))
+	allRows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: rowKey, EndKey: roachpb.Key(rowKey).PrefixEnd()}})
+	require.Len(t, family0Rows, 1)
+	require.Len(t, allRows, 1)
+	require.NotEqual(t, family0Rows[0][1].String(), allRows[0][1].String())
+
+	// With a single family, all the columns are in family 0.
+	sqlDB.Exec(t, `CREATE TABLE single (k INT PRIMARY KEY, v INT)`)
+	single := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "single")
+	require.NoError(t, rowenc.InitIndexFetchSpecKeyOnly(
+		&spec, keys.SystemSQLCodec, single, single.GetPrimaryIndex(),
+		append(columnIDsByName(t, single, "k"), colinfo.MVCCTimestampColumnID),
+	))
+}
+
+// BenchmarkInitIndexFetchSpecKeyOnly compares looking up rows of a table with
+// many column families using a regular spec (which reads all the families of
+// each row) and a key-only spec (which only reads family 0).
+func BenchmarkInitIndexFetchSpecKeyOnly(b *testing.B) {
+	defer leaktest.AfterTest(b)()
+
+	srv, db, kvDB := serverutils.StartServer(b, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	const numFamilies = 16
+	const numRows = 100
+	var cols, families strings.Builder
+	for i := 1; i < numFamilies; i++ {
+		fmt.Fprintf(&cols, ", c%d INT", i)
+		fmt.Fprintf(&families, ", FAMILY (c%d)", i)
+	}
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(b, fmt.Sprintf(`CREATE TABLE t (k INT PRIMARY KEY%s, FAMILY (k)%s)`, cols.String(), families.String()))
+	sqlDB.Exec(b, fmt.Sprintf(
+		`INSERT INTO t SELECT i%s FROM generate_series(1, %d) AS g(i)`,
+		strings.Repeat(", i", numFamilies-1), numRows,
+	))
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	fetchColumnIDs := columnIDsByName(b, table, "k")
+
+	var rowSpans, familySpans roachpb.Spans
+	for i := 1; i <= numRows; i++ {
+		rowKey := rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), table.GetPrimaryIndexID())
+		rowKey = encoding.EncodeVarintAscending(rowKey, int64(i))
+		rowSpans = append(rowSpans, roachpb.Span{Key: rowKey, EndKey: roachpb.Key(rowKey).PrefixEnd()})
+		familySpans = rowenc.SplitRowKeyIntoFamilySpans(familySpans, rowKey, []descpb.FamilyID{0})
+	}
+
+	for _, keyOnly := range []bool{false, true} {
+		b.Run(fmt.Sprintf("key-only=%t", keyOnly), func(b *testing.B) {
+			var spec fetchpb.IndexFetchSpec
+			spans := rowSpans
+			if keyOnly {
+				require.NoError(b, rowenc.InitIndexFetchSpecKeyOnly(
+					&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), fetchColumnIDs,
+				))
+				spans = familySpans
+			} else {
+				require.NoError(b, rowenc.InitIndexFetchSpec(
+					&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), fetchColumnIDs,
+				))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if rows := fetchRows(b, kvDB, &spec, spans); len(rows) != numRows {
+					b.Fatalf("expected %d rows, got %d", numRows, len(rows))
+				}
+			}
+		})
+	}
+}
+
+func TestInitIndexFetchSpecGeoConfig(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  geom GEOMETRY,
+  geog GEOGRAPHY,
+  j JSONB,
+  INVERTED INDEX geom_idx (geom) WITH (s2_max_level=15, s2_max_cells=8, geometry_min_x=0, geometry_max_x=100),
+  INVERTED INDEX geog_idx (geog) WITH (s2_level_mod=2),
+  INVERTED INDEX j_idx (j)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	for _, tc := range []struct {
+		index  string
+		column string
+		check  func(t *testing.T, cfg geoindex.Config)
+	}{
+		{
+			index:  "geom_idx",
+			column: "geom",
+			check: func(t *testing.T, cfg geoindex.Config) {
+				require.True(t, cfg.IsGeometry())
+				require.Equal(t, int32(15), cfg.S2Geometry.S2Config.MaxLevel)
+				require.Equal(t, int32(8), cfg.S2Geometry.S2Config.MaxCells)
+				require.Equal(t, float64(0), cfg.S2Geometry.MinX)
+				require.Equal(t, float64(100), cfg.S2Geometry.MaxX)
+			},
+		},
+		{
+			index:  "geog_idx",
+			column: "geog",
+			check: func(t *testing.T, cfg geoindex.Config) {
+				require.True(t, cfg.IsGeography())
+				require.Equal(t, int32(2), cfg.S2Geography.S2Config.LevelMod)
+			},
+		},
+		{
+			index:  "j_idx",
+			column: "j",
+			check: func(t *testing.T, cfg geoindex.Config) {
+				require.True(t, cfg.IsEmpty())
+			},
+		},
+	} {
+		t.Run(tc.index, func(t *testing.T) {
+			index, err := catalog.MustFindIndexByName(table, tc.index)
+			require.NoError(t, err)
+			var spec fetchpb.IndexFetchSpec
+			require.NoError(t, rowenc.InitIndexFetchSpec(
+				&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k", tc.column),
+			))
+			require.True(t, spec.GeoConfig.Equal(index.GetGeoConfig()))
+			tc.check(t, spec.GeoConfig)
+
+			// The config must survive the serialization of the spec.
+			buf, err := protoutil.Marshal(&spec)
+			require.NoError(t, err)
+			var decoded fetchpb.IndexFetchSpec
+			require.NoError(t, protoutil.Unmarshal(buf, &decoded))
+			tc.check(t, decoded.GeoConfig)
+			require.True(t, decoded.GeoConfig.Equal(spec.GeoConfig))
+		})
+	}
+}
+
+func TestInitIndexFetchSpecInvertedPrefixColumns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  tenant INT,
+  region STRING,
+  arr INT[],
+  INVERTED INDEX arr_idx (tenant, region, arr)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 10, 'east', ARRAY[1, 2]), (2, 20, 'west', ARRAY[3])`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	arrIdx, err := catalog.MustFindIndexByName(table, "arr_idx")
+	require.NoError(t, err)
+
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, arrIdx, columnIDsByName(t, table, "k", "tenant", "region", "arr"),
+	))
+	require.Equal(t, uint32(1), spec.NumKeySuffixColumns)
+	keyCols := spec.KeyColumns()
+	require.Len(t, keyCols, 3)
+	// Only the last key column is inverted; the prefix columns keep their types.
+	for i, expected := range []*types.T{types.Int, types.String, types.EncodedKey} {
+		require.Truef(t, keyCols[i].Type.Identical(expected), "key column %d: expected %s, got %s",
+			i, expected.SQLString(), keyCols[i].Type.SQLString())
+		require.Equal(t, i == 2, keyCols[i].IsInverted)
+	}
+	require.Equal(t, "k", spec.KeySuffixColumns()[0].Name)
+	for i, expected := range []*types.T{types.Int, types.Int, types.String, types.EncodedKey} {
+		require.True(t, spec.FetchedColumns[i].Type.Identical(expected))
+	}
+
+	prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), arrIdx.GetID()))
+	rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+	require.Len(t, rows, 3)
+	for i, expected := range []struct {
+		prefixCols string
+		element    int
+	}{
+		{prefixCols: "(1, 10, 'east')", element: 1},
+		{prefixCols: "(1, 10, 'east')", element: 2},
+		{prefixCols: "(2, 20, 'west')", element: 3},
+	} {
+		prefixCols := rows[i][:3]
+		require.Equal(t, expected.prefixCols, tree.AsString(&prefixCols))
+
+		// The inverted key is the encoding of the array element.
+		arr := tree.NewDArray(types.Int)
+		require.NoError(t, arr.Append(tree.NewDInt(tree.DInt(expected.element))))
+		invertedKeys, err := rowenc.EncodeInvertedIndexTableKeys(arr, nil /* inKey */, arrIdx.GetVersion())
+		require.NoError(t, err)
+		require.Len(t, invertedKeys, 1)
+		require.Equal(t, tree.DEncodedKey(invertedKeys[0]), *rows[i][3].(*tree.DEncodedKey))
+	}
+}
+
+func TestIndexFetchSpecKeyComparator(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY, a INT, b STRING, c INT, d INT,
+  INDEX ab_idx (a ASC, b DESC),
+  UNIQUE INDEX c_idx (c DESC),
+  UNIQUE INDEX d_idx (d)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES
+  (1, 1, 'x', 10, NULL), (2, 1, NULL, NULL, 5), (3, NULL, 'y', NULL, NULL),
+  (4, 2, 'x', 20, NULL), (5, 1, 'y', 30, 3), (6, NULL, NULL, 40, 4)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	evalCtx := eval.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	for _, tc := range []struct {
+		index    string
+		columns  []string
+		ordering colinfo.ColumnOrdering
+		// expected is the order of the k values of the rows.
+		expected []int
+	}{
+		{
+			index:    "t_pkey",
+			columns:  []string{"a", "k"},
+			ordering: colinfo.ColumnOrdering{{ColIdx: 1, Direction: encoding.Ascending}},
+			expected: []int{1, 2, 3, 4, 5, 6},
+		},
+		{
+			// NULLs come first in the ascending column and last in the descending
+			// column.
+			index:   "ab_idx",
+			columns: []string{"k", "a", "b"},
+			ordering: colinfo.ColumnOrdering{
+				{ColIdx: 1, Direction: encoding.Ascending},
+				{ColIdx: 2, Direction: encoding.Descending},
+				{ColIdx: 0, Direction: encoding.Ascending},
+			},
+			expected: []int{3, 6, 5, 1, 2, 4},
+		},
+		{
+			// The rows with a NULL key column are ordered by the key suffix column.
+			index:   "c_idx",
+			columns: []string{"c", "k"},
+			ordering: colinfo.ColumnOrdering{
+				{ColIdx: 0, Direction: encoding.Descending},
+				{ColIdx: 1, Direction: encoding.Ascending},
+			},
+			expected: []int{6, 5, 4, 1, 2, 3},
+		},
+		{
+			// Most rows have a NULL key column, so the rows are mostly ordered by the
+			// key suffix column.
+			index:   "d_idx",
+			columns: []string{"k", "d"},
+			ordering: colinfo.ColumnOrdering{
+				{ColIdx: 1, Direction: encoding.Ascending},
+				{ColIdx: 0, Direction: encoding.Ascending},
+			},
+			expected: []int{1, 3, 4, 5, 6, 2},
+		},
+		{
+			// Without the key suffix column, the rows with a NULL key can be in any
+			// order.
+			index:    "d_idx",
+			columns:  []string{"d"},
+			ordering: colinfo.ColumnOrdering{{ColIdx: 0, Direction: encoding.Ascending}},
+		},
+		{
+			// The rows are not ordered by b without a.
+			index:    "ab_idx",
+			columns:  []string{"b", "k"},
+			ordering: colinfo.ColumnOrdering{},
+		},
+	} {
+		index, err := catalog.MustFindIndexByName(table, tc.index)
+		require.NoError(t, err)
+		fetchColumnIDs := columnIDsByName(t, table, tc.columns...)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs))
+		require.Equal(t, tc.ordering, rowenc.IndexKeyOrdering(&spec), "%s: %v", tc.index, tc.columns)
+		if tc.expected == nil {
+			continue
+		}
+		kIdx := len(tc.columns) - 1
+		if tc.columns[0] == "k" {
+			kIdx = 0
+		}
+
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+		rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+		var order []int
+		for _, row := range rows {
+			order = append(order, int(tree.MustBeDInt(row[kIdx])))
+		}
+		require.Equal(t, tc.expected, order, tc.index)
+
+		// The comparator agrees with the order of the index.
+		cmp := rowenc.NewKeyComparator(&spec, &evalCtx)
+		for i := 1; i < len(rows); i++ {
+			require.Greater(t, 0, cmp(rows[i-1], rows[i]), "%s: %s vs %s", tc.index, rows[i-1], rows[i])
+			require.Less(t, 0, cmp(rows[i], rows[i-1]), "%s: %s vs %s", tc.index, rows[i], rows[i-1])
+			require.Zero(t, cmp(rows[i], rows[i]))
+		}
+		shuffled := append([]tree.Datums(nil), rows...)
+		rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		sort.Slice(shuffled, func(i, j int) bool { return cmp(shuffled[i], shuffled[j]) < 0 })
+		require.Equal(t, rows, shuffled)
+	}
+}
+
+func TestInitIndexFetchSpecTargetVersion(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  a INT PRIMARY KEY,
+  b INT,
+  c INT,
+  INDEX b_idx (b) USING HASH WITH (bucket_count = 4) WHERE c > 0
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 10, 100), (2, 20, 200)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	bIdx, err := catalog.MustFindIndexByName(table, "b_idx")
+	require.NoError(t, err)
+	fetchColumnIDs := columnIDsByName(t, table, "a", "b")
+
+	var current, initial fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&current, keys.SystemSQLCodec, table, bIdx, fetchColumnIDs,
+		rowenc.IndexFetchSpecOptions{TargetVersion: fetchpb.IndexFetchSpecVersionCurrent},
+	))
+	require.Equal(t, uint32(fetchpb.IndexFetchSpecVersionCurrent), current.Version)
+	require.True(t, current.IsPartial)
+	require.NotZero(t, current.ShardColumnID)
+	require.Equal(t, uint32(4), current.ShardBucketCount)
+	require.Equal(t, fetchpb.IndexFetchSpec_KEY, current.KeyAndSuffixColumns[0].Role)
+	require.Equal(t, fetchpb.IndexFetchSpec_KEY_SUFFIX, current.FetchedColumns[0].Role)
+
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&initial, keys.SystemSQLCodec, table, bIdx, fetchColumnIDs,
+		rowenc.IndexFetchSpecOptions{TargetVersion: fetchpb.IndexFetchSpecVersionInitial},
+	))
+	require.Equal(t, uint32(fetchpb.IndexFetchSpecVersionInitial), initial.Version)
+	require.False(t, initial.IsPartial)
+	require.Zero(t, initial.ShardColumnID)
+	require.Zero(t, initial.ShardBucketCount)
+	for i := range initial.KeyAndSuffixColumns {
+		require.Equal(t, fetchpb.IndexFetchSpec_NO_ROLE, initial.KeyAndSuffixColumns[i].Role)
+	}
+	for i := range initial.FetchedColumns {
+		require.Equal(t, fetchpb.IndexFetchSpec_NO_ROLE, initial.FetchedColumns[i].Role)
+	}
+	// The columns shared with the table descriptor must not be modified.
+	require.Equal(t, fetchpb.IndexFetchSpec_KEY, table.IndexFetchSpecKeyAndSuffixColumns(bIdx)[0].Role)
+	// The only decoding-related difference is the version.
+	require.Equal(t, "version: 2 vs 1", rowenc.IndexFetchSpecsDiff(&current, &initial))
+
+	// Both specs can be used to fetch rows.
+	prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), bIdx.GetID()))
+	spans := roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}}
+	require.Equal(t, fetchRows(t, kvDB, &current, spans), fetchRows(t, kvDB, &initial, spans))
+
+	// Optional fields which are not supported by the target version can't be
+	// requested.
+	require.Error(t, rowenc.InitIndexFetchSpecWithOptions(
+		&initial, keys.SystemSQLCodec, table, bIdx, fetchColumnIDs,
+		rowenc.IndexFetchSpecOptions{
+			TargetVersion:           fetchpb.IndexFetchSpecVersionInitial,
+			IncludePredicateColumns: true,
+		},
+	))
+	require.Error(t, rowenc.InitIndexFetchSpecWithOptions(
+		&initial, keys.SystemSQLCodec, table, bIdx, fetchColumnIDs,
+		rowenc.IndexFetchSpecOptions{TargetVersion: fetchpb.IndexFetchSpecVersionCurrent + 1},
+	))
+}
+
+func TestInitIndexFetchSpecKeySuffixColumnIDs(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  a INT,
+  b INT,
+  c INT,
+  d INT,
+  PRIMARY KEY (c, a DESC, b),
+  INDEX d_idx (d),
+  INDEX da_idx (d, a),
+  UNIQUE INDEX bd_idx (b, d)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	for _, tc := range []struct {
+		index    string
+		expected []string
+	}{
+		{index: "t_pkey", expected: nil},
+		// The key suffix columns follow the order of the primary key.
+		{index: "d_idx", expected: []string{"c", "a", "b"}},
+		{index: "da_idx", expected: []string{"c", "b"}},
+		{index: "bd_idx", expected: []string{"c", "a"}},
+	} {
+		index, err := catalog.MustFindIndexByName(table, tc.index)
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, table, index, nil /* fetchColumnIDs */))
+		var expected []descpb.ColumnID
+		if tc.expected != nil {
+			expected = columnIDsByName(t, table, tc.expected...)
+		}
+		require.Equal(t, expected, spec.KeySuffixColumnIDs, tc.index)
+		// The IDs match the key suffix columns.
+		suffixCols := spec.KeySuffixColumns()
+		require.Len(t, suffixCols, len(spec.KeySuffixColumnIDs))
+		for i := range suffixCols {
+			require.Equal(t, spec.KeySuffixColumnIDs[i], suffixCols[i].ColumnID)
+		}
+	}
+}
+
+// hydratedTableDescriptor returns the descriptor of the given table in
+// defaultdb, with hydrated column types (which is necessary for user-defined
+// types like enums).
+func hydratedTableDescriptor(
+	t testing.TB, srv serverutils.TestServerInterface, kvDB *kv.DB, name string,
+) catalog.TableDescriptor {
+	id := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", name).GetID()
+	var table catalog.TableDescriptor
+	require.NoError(t, sql.TestingDescsTxn(context.Background(), srv,
+		func(ctx context.Context, txn isql.Txn, col *descs.Collection) (err error) {
+			table, err = col.ByID(txn.KV()).Get().Table(ctx, id)
+			return err
+		},
+	))
+	return table
+}
+
+// fuzzColumnTypes are the column types used by FuzzIndexFetchSpecRoundTrip.
+// The first ones have special encodings; the corpus contains a table for each
+// type, using it for the first column.
+var fuzzColumnTypes = []struct {
+	name string
+	// inverted is set if the type can be indexed by an inverted index.
+	inverted bool
+}{
+	{name: "JSONB", inverted: true},
+	{name: "INT[]", inverted: true},
+	{name: "fuzz_enum"},
+	{name: "STRING COLLATE en_US"},
+	{name: "DECIMAL"},
+	{name: "INTERVAL"},
+	{name: "FLOAT"},
+	{name: "INT"},
+	{name: "STRING"},
+	{name: "BOOL"},
+	{name: "BYTES"},
+	{name: "TIMESTAMPTZ"},
+	{name: "UUID"},
+}
+
+// FuzzIndexFetchSpecRoundTrip creates tables with random column types, column
+// families and indexes (including unique, partial and inverted indexes), and
+// verifies that random rows encoded into each index decode back to the same
+// values using an IndexFetchSpec.
+func FuzzIndexFetchSpecRoundTrip(f *testing.F) {
+	defer leaktest.AfterTest(f)()
+
+	srv, db, kvDB := serverutils.StartServer(f, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(f, `CREATE TYPE fuzz_enum AS ENUM ('a', 'b', 'c')`)
+
+	for i := range fuzzColumnTypes {
+		f.Add(int64(i), uint8(i))
+	}
+
+	tableNum := 0
+	f.Fuzz(func(t *testing.T, seed int64, firstType uint8) {
+		rng := rand.New(rand.NewSource(seed))
+		tableNum++
+		name := fmt.Sprintf("t%d", tableNum)
+
+		colTypes := []int{int(firstType) % len(fuzzColumnTypes)}
+		for n := rng.Intn(4); n > 0; n-- {
+			colTypes = append(colTypes, rng.Intn(len(fuzzColumnTypes)))
+		}
+		defs := []string{"k INT NOT NULL"}
+		pkCols := []string{"k"}
+		families := [][]string{{"k"}, nil, nil}
+		var nonPKCols, invertedCols []string
+		for i, typIdx := range colTypes {
+			typ := fuzzColumnTypes[typIdx]
+			col := fmt.Sprintf("c%d", i)
+			if i == 0 && !typ.inverted && rng.Intn(2) == 0 {
+				defs = append(defs, fmt.Sprintf("%s %s NOT NULL", col, typ.name))
+				pkCols = append(pkCols, col)
+			} else {
+				defs = append(defs, fmt.Sprintf("%s %s", col, typ.name))
+				nonPKCols = append(nonPKCols, col)
+			}
+			if typ.inverted {
+				invertedCols = append(invertedCols, col)
+			}
+			fam := rng.Intn(len(families))
+			families[fam] = append(families[fam], col)
+		}
+		allCols := append(append([]string(nil), pkCols...), nonPKCols...)
+
+		randDirection := func() string {
+			if rng.Intn(2) == 0 {
+				return " DESC"
+			}
+			return ""
+		}
+		randPredicate := func() string {
+			if rng.Intn(3) == 0 {
+				return " WHERE k > 0"
+			}
+			return ""
+		}
+		rng.Shuffle(len(pkCols), func(i, j int) { pkCols[i], pkCols[j] = pkCols[j], pkCols[i] })
+		for i := range pkCols {
+			pkCols[i] += randDirection()
+		}
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(pkCols, ", ")))
+
+		for i, n := 0, 1+rng.Intn(3); i < n; i++ {
+			perm := rng.Perm(len(allCols))
+			var keyCols []string
+			isKeyCol := make(map[string]bool)
+			for _, ord := range perm[:1+rng.Intn(2)] {
+				keyCols = append(keyCols, allCols[ord]+randDirection())
+				isKeyCol[allCols[ord]] = true
+			}
+			var storing []string
+			for _, col := range nonPKCols {
+				if !isKeyCol[col] && rng.Intn(2) == 0 {
+					storing = append(storing, col)
+				}
+			}
+			def := fmt.Sprintf("INDEX i%d (%s)", i, strings.Join(keyCols, ", "))
+			if rng.Intn(3) == 0 {
+				def = "UNIQUE " + def
+			}
+			if len(storing) > 0 {
+				def += fmt.Sprintf(" STORING (%s)", strings.Join(storing, ", "))
+			}
+			defs = append(defs, def+randPredicate())
+		}
+		for i, col := range invertedCols {
+			if rng.Intn(2) == 0 {
+				continue
+			}
+			if rng.Intn(2) == 0 {
+				// Use a prefix column.
+				col = "k, " + col
+			}
+			defs = append(defs, fmt.Sprintf("INVERTED INDEX inv%d (%s)%s", i, col, randPredicate()))
+		}
+		for i, cols := range families {
+			if len(cols) > 0 {
+				defs = append(defs, fmt.Sprintf("FAMILY f%d (%s)", i, strings.Join(cols, ", ")))
+			}
+		}
+		createTable := fmt.Sprintf("CREATE TABLE %s (\n  %s\n)", name, strings.Join(defs, ",\n  "))
+		sqlDB.Exec(t, createTable)
+		table := hydratedTableDescriptor(t, srv, kvDB, name)
+
+		for i := 0; i < 10; i++ {
+			var datums tree.Datums
+			for _, col := range table.PublicColumns() {
+				datums = append(datums, randgen.RandDatum(rng, col.GetType(), col.IsNullable()))
+			}
+			for _, index := range table.ActiveIndexes() {
+				var spec fetchpb.IndexFetchSpec
+				var fetchColumnIDs []descpb.ColumnID
+				for _, col := range table.IndexColumns(index) {
+					fetchColumnIDs = append(fetchColumnIDs, col.GetID())
+				}
+				require.NoError(t, rowenc.InitIndexFetchSpec(
+					&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs,
+				), createTable)
+				rowenctest.RoundTripWithFetchSpec(t, keys.SystemSQLCodec, table, &spec, datums)
+			}
+		}
+	})
+}
+
+func TestInitIndexFetchSpecEnum(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TYPE greeting AS ENUM ('hello', 'howdy', 'hi')`)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  g greeting,
+  ga greeting[],
+  INDEX g_idx (g DESC) STORING (ga)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 'howdy', ARRAY['hi']), (2, 'hi', NULL), (3, NULL, ARRAY['hello', 'howdy'])`)
+
+	// The descriptor types are not hydrated when the descriptor is not read
+	// through a collection, so the enum columns can't be fetched.
+	unhydrated := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	gIdx, err := catalog.MustFindIndexByName(unhydrated, "g_idx")
+	require.NoError(t, err)
+	var spec fetchpb.IndexFetchSpec
+	for _, col := range []string{"g", "ga"} {
+		err := rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, unhydrated, gIdx, columnIDsByName(t, unhydrated, "k", col),
+		)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "is not hydrated")
+	}
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, unhydrated, gIdx, columnIDsByName(t, unhydrated, "k"),
+	))
+
+	table := hydratedTableDescriptor(t, srv, kvDB, "t")
+	for _, index := range table.ActiveIndexes() {
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k", "g", "ga"),
+		))
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+		rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+		var res []string
+		for i := range rows {
+			res = append(res, tree.AsString(&rows[i]))
+		}
+		expected := []string{
+			`(1, 'howdy', ARRAY['hi'])`,
+			`(2, 'hi', NULL)`,
+			`(3, NULL, ARRAY['hello','howdy'])`,
+		}
+		if index.GetID() == gIdx.GetID() {
+			// The index is descending on g, and NULLs sort last.
+			expected = []string{expected[1], expected[0], expected[2]}
+		}
+		require.Equal(t, expected, res, index.GetName())
+	}
+}
+
+func TestInitIndexFetchSpecInvertedAndStoredJSON(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  s STRING,
+  j JSONB,
+  INVERTED INDEX j_idx (j),
+  INDEX s_idx (s) STORING (j)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 'x', '{"a": 1, "b": [2, 3]}')`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	for _, tc := range []struct {
+		index string
+		typ   *types.T
+		role  fetchpb.IndexFetchSpec_ColumnRole
+	}{
+		// The inverted scan fetches the inverted keys...
+		{index: "j_idx", typ: types.EncodedKey, role: fetchpb.IndexFetchSpec_KEY},
+		// ... while the other scans fetch the JSON values.
+		{index: "s_idx", typ: types.Jsonb, role: fetchpb.IndexFetchSpec_STORED},
+		{index: "t_pkey", typ: types.Jsonb, role: fetchpb.IndexFetchSpec_STORED},
+	} {
+		index, err := catalog.MustFindIndexByName(table, tc.index)
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k", "j"),
+		))
+		col := &spec.FetchedColumns[1]
+		require.True(t, col.Type.Identical(tc.typ), "%s: %s", tc.index, col.Type.SQLString())
+		require.Equal(t, tc.role, col.Role, tc.index)
+
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+		rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+		if tc.typ.Family() == types.EncodedKeyFamily {
+			// There is an inverted key for each path of the JSON value.
+			require.Len(t, rows, 3)
+			for _, row := range rows {
+				require.IsType(t, (*tree.DEncodedKey)(nil), row[1])
+			}
+			continue
+		}
+		require.Len(t, rows, 1)
+		require.Equal(t, `(1, '{"a": 1, "b": [2, 3]}')`, tree.AsString(&rows[0]), tc.index)
+	}
+
+	// A key column whose type doesn't match the type of the fetched column is
+	// detected in test builds.
+	index, err := catalog.MustFindIndexByName(table, "j_idx")
+	require.NoError(t, err)
+	corrupt := inconsistentKeyColumnsTable{
+		TableDescriptor: table,
+		modify: func(cols []fetchpb.IndexFetchSpec_KeyColumn) []fetchpb.IndexFetchSpec_KeyColumn {
+			cols[0].Type = types.Jsonb
+			return cols
+		},
+	}
+	var spec fetchpb.IndexFetchSpec
+	err = rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, corrupt, index, columnIDsByName(t, table, "k", "j"))
+	if buildutil.CrdbTestBuild {
+		require.ErrorContains(t, err, "fetched column j (3) has type")
+	} else {
+		require.NoError(t, err)
+	}
+}
+
+func TestInitIndexFetchSpecExpressionColumns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  name STRING,
+  a INT,
+  b INT,
+  INDEX lower_idx ((lower(name))),
+  INDEX sum_idx (a, (a + b) DESC)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 'Foo', 1, 10), (2, 'bar', 2, 20)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	for _, tc := range []struct {
+		index      string
+		expr       string
+		referenced []string
+		// keyColOrd is the ordinal of the expression column in the key.
+		keyColOrd int
+	}{
+		{index: "lower_idx", expr: "lower(name)", referenced: []string{"name"}, keyColOrd: 0},
+		{index: "sum_idx", expr: "a + b", referenced: []string{"a", "b"}, keyColOrd: 1},
+	} {
+		index, err := catalog.MustFindIndexByName(table, tc.index)
+		require.NoError(t, err)
+		exprColID := index.GetKeyColumnID(tc.keyColOrd)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+			&spec, keys.SystemSQLCodec, table, index, []descpb.ColumnID{exprColID},
+			rowenc.IndexFetchSpecOptions{IncludeExpressionColumns: true},
+		))
+		require.Len(t, spec.ExpressionColumns, 1)
+		exprCol := spec.ExpressionColumns[0]
+		require.Equal(t, exprColID, exprCol.ColumnID)
+		require.Equal(t, tc.expr, exprCol.Expr)
+		require.Equal(t, columnIDsByName(t, table, tc.referenced...), exprCol.ReferencedColumnIDs)
+
+		// The expression column can be fetched from the index.
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+		rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+		require.Len(t, rows, 2)
+	}
+
+	// Without the option, or for other indexes, there are no expression columns.
+	var spec fetchpb.IndexFetchSpec
+	lowerIdx, err := catalog.MustFindIndexByName(table, "lower_idx")
+	require.NoError(t, err)
+	require.NoError(t, rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, table, lowerIdx, nil /* fetchColumnIDs */))
+	require.Nil(t, spec.ExpressionColumns)
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), columnIDsByName(t, table, "k", "name"),
+		rowenc.IndexFetchSpecOptions{IncludeExpressionColumns: true},
+	))
+	require.Nil(t, spec.ExpressionColumns)
+}
+
+func TestIndexFetchSpecDefaultColumnForFamily(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY, a INT, z INT, b INT, c INT, d INT, e INT,
+  FAMILY f0 (k, a, z), FAMILY f1 (b), FAMILY f2 (c), FAMILY f3 (d), FAMILY f4 (e),
+  INDEX a_idx (a)
+)`)
+	// Dropping columns c and e removes families 2 and 4.
+	sqlDB.Exec(t, `ALTER TABLE t DROP COLUMN c`)
+	sqlDB.Exec(t, `ALTER TABLE t DROP COLUMN e`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	// Also check a descriptor where the families are not stored in ID order.
+	mut := tabledesc.NewBuilder(table.TableDesc()).BuildExistingMutableTable()
+	families := mut.Families
+	for i, j := 0, len(families)-1; i < j; i, j = i+1, j-1 {
+		families[i], families[j] = families[j], families[i]
+	}
+	reversed := mut.ImmutableCopy().(catalog.TableDescriptor)
+	require.Equal(t, descpb.FamilyID(3), reversed.GetFamilies()[0].ID)
+
+	for _, table := range []catalog.TableDescriptor{table, reversed} {
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), columnIDsByName(t, table, "k", "a", "b", "d"),
+		))
+		require.Equal(t, []fetchpb.IndexFetchSpec_FamilyDefaultColumn{
+			{FamilyID: 1, DefaultColumnID: columnIDsByName(t, table, "b")[0]},
+			{FamilyID: 3, DefaultColumnID: columnIDsByName(t, table, "d")[0]},
+		}, spec.FamilyDefaultColumns)
+
+		for _, tc := range []struct {
+			family   descpb.FamilyID
+			column   string
+			expected bool
+		}{
+			{family: 0},
+			{family: 1, column: "b", expected: true},
+			{family: 2},
+			{family: 3, column: "d", expected: true},
+			{family: 4},
+		} {
+			colID, ok := spec.DefaultColumnForFamily(tc.family)
+			require.Equal(t, tc.expected, ok, "family %d", tc.family)
+			if tc.expected {
+				require.Equal(t, columnIDsByName(t, table, tc.column)[0], colID)
+			} else {
+				require.Zero(t, colID)
+			}
+		}
+	}
+
+	// In test builds, the specs of secondary indexes are checked to be sorted in
+	// case a descriptor implementation doesn't sort them.
+	unsorted := unsortedFamilyDefaultColumnsTable{TableDescriptor: table}
+	index, err := catalog.MustFindIndexByName(unsorted, "a_idx")
+	require.NoError(t, err)
+	var spec fetchpb.IndexFetchSpec
+	err = rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, unsorted, index, columnIDsByName(t, table, "k"))
+	if buildutil.CrdbTestBuild {
+		require.ErrorContains(t, err, "family default columns of table t are not sorted by family ID: 3 before 1")
+	} else {
+		require.NoError(t, err)
+	}
+}
+
+// unsortedFamilyDefaultColumnsTable is a table descriptor whose family default
+// columns are returned in reverse order.
+type unsortedFamilyDefaultColumnsTable struct {
+	catalog.TableDescriptor
+}
+
+func (t unsortedFamilyDefaultColumnsTable) FamilyDefaultColumns() []fetchpb.IndexFetchSpec_FamilyDefaultColumn {
+	cols := append(
+		[]fetchpb.IndexFetchSpec_FamilyDefaultColumn(nil), t.TableDescriptor.FamilyDefaultColumns()...,
+	)
+	for i, j := 0, len(cols)-1; i < j; i, j = i+1, j-1 {
+		cols[i], cols[j] = cols[j], cols[i]
+	}
+	return cols
+}
+
+func TestInitIndexFetchSpecCapacityHint(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (a INT PRIMARY KEY, b INT, c INT, d INT)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	allColumnIDs := columnIDsByName(t, table, "a", "b", "c", "d")
+	opts := rowenc.IndexFetchSpecOptions{FetchedColumnsCapacityHint: len(allColumnIDs)}
+
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), allColumnIDs[:1], opts,
+	))
+	require.Len(t, spec.FetchedColumns, 1)
+	require.Equal(t, len(allColumnIDs), cap(spec.FetchedColumns))
+	first := &spec.FetchedColumns[0]
+
+	// Adding columns up to the hint reuses the slice, and the spec is the same
+	// as without the hint.
+	for i := 2; i <= len(allColumnIDs); i++ {
+		require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+			&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), allColumnIDs[:i], opts,
+		))
+		require.Same(t, first, &spec.FetchedColumns[0])
+
+		var expected fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&expected, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), allColumnIDs[:i],
+		))
+		require.Equal(t, expected.FetchedColumns, spec.FetchedColumns)
+	}
+}
+
+func BenchmarkInitIndexFetchSpecCapacityHint(b *testing.B) {
+	defer leaktest.AfterTest(b)()
+
+	srv, db, kvDB := serverutils.StartServer(b, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	const numColumns = 16
+	var cols strings.Builder
+	for i := 1; i < numColumns; i++ {
+		fmt.Fprintf(&cols, ", c%d INT", i)
+	}
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(b, fmt.Sprintf(`CREATE TABLE t (k INT PRIMARY KEY%s)`, cols.String()))
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	fetchColumnIDs := make([]descpb.ColumnID, 0, numColumns)
+	for _, col := range table.PublicColumns() {
+		fetchColumnIDs = append(fetchColumnIDs, col.GetID())
+	}
+
+	// Each iteration initializes a new spec with a growing set of columns, as
+	// done by adaptive column pruning.
+	for _, hint := range []int{0, numColumns} {
+		b.Run(fmt.Sprintf("hint=%d", hint), func(b *testing.B) {
+			opts := rowenc.IndexFetchSpecOptions{FetchedColumnsCapacityHint: hint}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var spec fetchpb.IndexFetchSpec
+				for n := 1; n <= len(fetchColumnIDs); n++ {
+					if err := rowenc.InitIndexFetchSpecWithOptions(
+						&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), fetchColumnIDs[:n], opts,
+					); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestInitIndexFetchSpecDuplicateColumns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (a INT PRIMARY KEY, b DECIMAL, c INT, INDEX b_idx (b) STORING (c))`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	index, err := catalog.MustFindIndexByName(table, "b_idx")
+	require.NoError(t, err)
+
+	var spec fetchpb.IndexFetchSpec
+	err = rowenc.InitIndexFetchSpecChecked(
+		&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "a", "b", "c", "b"),
+	)
+	require.ErrorContains(t, err, "column b (2) of table t is fetched more than once")
+	// In test builds, the check is also done for secondary indexes by default.
+	err = rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "a", "a"))
+	if buildutil.CrdbTestBuild {
+		require.ErrorContains(t, err, "column a (1) of table t is fetched more than once")
+	} else {
+		require.NoError(t, err)
+	}
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), columnIDsByName(t, table, "a", "a"),
+	))
+
+	// The composite column b is decoded from both the key and the value, but it
+	// is only fetched once.
+	require.NoError(t, rowenc.InitIndexFetchSpecChecked(
+		&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "a", "b", "c"),
+	))
+	require.Len(t, spec.FetchedColumns, 3)
+	require.True(t, spec.KeyAndSuffixColumns[0].IsComposite)
+}
+
+func TestInitIndexFetchSpecExtraKeyColumns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(ctx)
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k1 INT, k2 STRING, u INT, v INT,
+  PRIMARY KEY (k1, k2),
+  UNIQUE INDEX u_idx (u),
+  INDEX v_idx (v)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 'a', 10, 100), (2, 'b', NULL, 100), (3, 'c', NULL, NULL)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	for _, tc := range []struct {
+		index   string
+		columns []string
+		extra   []bool
+		rows    []string
+	}{
+		{
+			// The primary key columns are only encoded in the key if u is NULL.
+			index:   "u_idx",
+			columns: []string{"u", "k1", "k2"},
+			extra:   []bool{false, true, true},
+			rows:    []string{"(NULL, 2, 'b')", "(NULL, 3, 'c')", "(10, 1, 'a')"},
+		},
+		{
+			index:   "u_idx",
+			columns: []string{"k2"},
+			extra:   []bool{true},
+			rows:    []string{"('b')", "('c')", "('a')"},
+		},
+		// The primary key columns are always encoded in the key of a non-unique
+		// index.
+		{
+			index:   "v_idx",
+			columns: []string{"v", "k1", "k2"},
+			extra:   []bool{false, false, false},
+			rows:    []string{"(NULL, 3, 'c')", "(100, 1, 'a')", "(100, 2, 'b')"},
+		},
+		{
+			index:   "t_pkey",
+			columns: []string{"k1", "k2", "u"},
+			extra:   []bool{false, false, false},
+			rows:    []string{"(1, 'a', 10)", "(2, 'b', NULL)", "(3, 'c', NULL)"},
+		},
+	} {
+		index, err := catalog.MustFindIndexByName(table, tc.index)
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, tc.columns...),
+		))
+		for i := range spec.FetchedColumns {
+			col := &spec.FetchedColumns[i]
+			require.Equal(t, tc.extra[i], col.IsExtraKeyColumn, "%s: %s", tc.index, col.Name)
+			if col.IsExtraKeyColumn {
+				require.Equal(t, fetchpb.IndexFetchSpec_KEY_SUFFIX, col.Role)
+				require.True(t, col.InKey())
+				require.False(t, col.InValue())
+			}
+		}
+		for _, c := range spec.KeyAndSuffixColumns {
+			require.False(t, c.IsExtraKeyColumn)
+		}
+
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+		rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+		var actual []string
+		for i := range rows {
+			actual = append(actual, tree.AsString(&rows[i]))
+		}
+		require.Equal(t, tc.rows, actual, "%s: %v", tc.index, tc.columns)
+	}
+
+	// The key of the u_idx entry with a non-NULL u doesn't contain the primary
+	// key columns, which are only in the value.
+	index, err := catalog.MustFindIndexByName(table, "u_idx")
+	require.NoError(t, err)
+	prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+	kvs, err := kvDB.Scan(ctx, prefix, prefix.PrefixEnd(), 0 /* maxRows */)
+	require.NoError(t, err)
+	require.Len(t, kvs, 3)
+	expectedKey := roachpb.Key(keys.MakeFamilyKey(encoding.EncodeVarintAscending(prefix.Clone(), 10), 0))
+	require.Equal(t, expectedKey, kvs[2].Key)
+	require.NotEmpty(t, kvs[2].ValueBytes())
+
+	// The flag is not part of the initial version.
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "u", "k1", "k2"),
+		rowenc.IndexFetchSpecOptions{TargetVersion: fetchpb.IndexFetchSpecVersionInitial},
+	))
+	for i := range spec.FetchedColumns {
+		require.False(t, spec.FetchedColumns[i].IsExtraKeyColumn)
+	}
+}
+
+// inconsistentKeyColumnsTable is a table descriptor whose key and suffix
+// columns, as reported to IndexFetchSpec, are modified by a function.
+type inconsistentKeyColumnsTable struct {
+	catalog.TableDescriptor
+	modify func([]fetchpb.IndexFetchSpec_KeyColumn) []fetchpb.IndexFetchSpec_KeyColumn
+}
+
+func (t inconsistentKeyColumnsTable) IndexFetchSpecKeyAndSuffixColumns(
+	idx catalog.Index,
+) []fetchpb.IndexFetchSpec_KeyColumn {
+	cols := t.TableDescriptor.IndexFetchSpecKeyAndSuffixColumns(idx)
+	return t.modify(append([]fetchpb.IndexFetchSpec_KeyColumn(nil), cols...))
+}
+
+func TestInitIndexFetchSpecInconsistentKeySuffixColumns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (a INT, b INT, c INT, PRIMARY KEY (a, b), INDEX c_idx (c))`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	index, err := catalog.MustFindIndexByName(table, "c_idx")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name     string
+		index    catalog.Index
+		modify   func([]fetchpb.IndexFetchSpec_KeyColumn) []fetchpb.IndexFetchSpec_KeyColumn
+		expected string
+	}{
+		{
+			name:  "missing suffix column",
+			index: index,
+			modify: func(cols []fetchpb.IndexFetchSpec_KeyColumn) []fetchpb.IndexFetchSpec_KeyColumn {
+				return cols[:len(cols)-1]
+			},
+			expected: "index c_idx (2) of table t has 1 key and 2 key suffix columns but 2 key and suffix columns in the spec",
+		},
+		{
+			name:  "extra suffix column",
+			index: index,
+			modify: func(cols []fetchpb.IndexFetchSpec_KeyColumn) []fetchpb.IndexFetchSpec_KeyColumn {
+				return append(cols, cols[1])
+			},
+			expected: "index c_idx (2) of table t has 1 key and 2 key suffix columns but 4 key and suffix columns in the spec",
+		},
+		{
+			name:  "suffix column with key role",
+			index: index,
+			modify: func(cols []fetchpb.IndexFetchSpec_KeyColumn) []fetchpb.IndexFetchSpec_KeyColumn {
+				cols[2].Role = fetchpb.IndexFetchSpec_KEY
+				return cols
+			},
+			expected: "key suffix column b (2) of index c_idx (2) of table t has role KEY",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			corrupt := inconsistentKeyColumnsTable{TableDescriptor: table, modify: tc.modify}
+			var spec fetchpb.IndexFetchSpec
+			err := rowenc.InitIndexFetchSpec(
+				&spec, keys.SystemSQLCodec, corrupt, tc.index, columnIDsByName(t, table, "a"),
+			)
+			if !buildutil.CrdbTestBuild {
+				// The check is only done in test builds.
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.expected)
+			require.True(t, errors.HasAssertionFailure(err))
+		})
+	}
+
+	// The consistent descriptor passes the check.
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "a"),
+	))
+}
+
+func TestInitIndexFetchSpecSystemColumns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (a INT PRIMARY KEY, b INT, c INT, INDEX b_idx (b))`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 10, 100), (2, 20, 200)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	secondary, err := catalog.MustFindIndexByName(table, "b_idx")
+	require.NoError(t, err)
+
+	for _, index := range []catalog.Index{table.GetPrimaryIndex(), secondary} {
+		fetchColumnIDs := append(
+			columnIDsByName(t, table, "a", "b"), colinfo.MVCCTimestampColumnID, colinfo.TableOIDColumnID,
+		)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpecChecked(
+			&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs,
+		))
+		for i, expectedType := range []*types.T{types.Int, types.Int, types.Decimal, types.Oid} {
+			col := &spec.FetchedColumns[i]
+			require.True(t, col.Type.Identical(expectedType), "%s: %s", col.Name, col.Type.SQLString())
+			require.Equal(t, i >= 2, col.IsSystemColumn, col.Name)
+		}
+		require.Equal(t, fetchpb.IndexFetchSpec_NO_ROLE, spec.FetchedColumns[2].Role)
+
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+		rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+		require.Len(t, rows, 2)
+		for _, row := range rows {
+			require.NotEqual(t, tree.DNull, row[2])
+			require.Equal(t, tree.NewDOid(oid.Oid(table.GetID())), row[3])
+		}
+	}
+
+	// The system columns can be selected through both indexes.
+	for _, index := range []string{"t_pkey", "b_idx"} {
+		sqlDB.CheckQueryResults(t, fmt.Sprintf(
+			`SELECT a, crdb_internal_mvcc_timestamp IS NOT NULL, tableoid = 't'::REGCLASS::OID
+FROM t@%s ORDER BY a`, index,
+		), [][]string{{"1", "true", "true"}, {"2", "true", "true"}})
+	}
+}
+
+// TestInitIndexFetchSpecUnregisteredSystemColumn verifies that only the system
+// columns registered in colinfo (the MVCC timestamp and the table OID) can be
+// fetched: there are no synthetic columns for the origin of logically
+// replicated rows, since the KVs don't record their origin in this version.
+func TestInitIndexFetchSpecUnregisteredSystemColumn(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (a INT PRIMARY KEY, b INT)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	require.Len(t, colinfo.AllSystemColumnDescs, catalog.NumSystemColumns)
+	unregisteredID := descpb.ColumnID(catalog.SmallestSystemColumnColumnID - 1)
+	require.False(t, colinfo.IsColIDSystemColumn(unregisteredID))
+
+	var spec fetchpb.IndexFetchSpec
+	err := rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(),
+		append(columnIDsByName(t, table, "a", "b"), unregisteredID),
+	)
+	require.ErrorContains(t, err, fmt.Sprintf(`column-id "%d" does not exist`, unregisteredID))
+}
+
+// TestInitIndexFetchSpecLegacyFormatVersion verifies that tables at the
+// pre-column-family format version don't need a separate value encoding in the
+// spec: their descriptors are upgraded when they are deserialized, with each
+// non-key column in its own family whose ID is the column ID, which is how the
+// legacy encoding lays out the values.
+func TestInitIndexFetchSpecLegacyFormatVersion(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (a INT PRIMARY KEY, b INT, c STRING)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	require.Equal(t, descpb.InterleavedFormatVersion, table.GetFormatVersion())
+
+	var spec fetchpb.IndexFetchSpec
+	fetchColumnIDs := columnIDsByName(t, table, "a", "b", "c")
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), fetchColumnIDs,
+	))
+	require.Zero(t, spec.MaxFamilyID)
+	require.Empty(t, spec.FamilyDefaultColumns)
+
+	legacyDesc := protoutil.Clone(table.TableDesc()).(*descpb.TableDescriptor)
+	legacyDesc.FormatVersion = descpb.BaseFormatVersion
+	legacyDesc.Families = nil
+	legacyDesc.NextFamilyID = 0
+	b := tabledesc.NewBuilder(legacyDesc)
+	require.NoError(t, b.RunPostDeserializationChanges())
+	legacy := b.BuildImmutableTable()
+	require.Equal(t, descpb.InterleavedFormatVersion, legacy.GetFormatVersion())
+
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, legacy, legacy.GetPrimaryIndex(), fetchColumnIDs,
+	))
+	require.Equal(t, descpb.FamilyID(fetchColumnIDs[2]), spec.MaxFamilyID)
+	require.Equal(t, []fetchpb.IndexFetchSpec_FamilyDefaultColumn{
+		{FamilyID: descpb.FamilyID(fetchColumnIDs[1]), DefaultColumnID: fetchColumnIDs[1]},
+		{FamilyID: descpb.FamilyID(fetchColumnIDs[2]), DefaultColumnID: fetchColumnIDs[2]},
+	}, spec.FamilyDefaultColumns)
+	// Family 0 (which only contains the primary key) and one family for each of
+	// b and c.
+	require.Equal(t, uint32(3), spec.MaxKeysPerRow)
+}
+
+// TestInitIndexFetchSpecInterleaved verifies that specs are not built for
+// interleaved indexes. Interleaved tables are no longer supported, and such
+// descriptors fail validation; their keys embed the keys of the parent index,
+// which the fetchers can't decode.
+func TestInitIndexFetchSpecInterleaved(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE p (a INT PRIMARY KEY)`)
+	sqlDB.Exec(t, `CREATE TABLE c (a INT, b INT, PRIMARY KEY (a, b))`)
+	parent := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "p")
+	child := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "c")
+
+	// Interleave the primary index of c into the primary index of p, the way
+	// older versions did.
+	mutChild := tabledesc.NewBuilder(child.TableDesc()).BuildExistingMutableTable()
+	mutChild.PrimaryIndex.Interleave.Ancestors = []descpb.InterleaveDescriptor_Ancestor{
+		{TableID: parent.GetID(), IndexID: parent.GetPrimaryIndexID(), SharedPrefixLen: 1},
+	}
+	interleavedChild := mutChild.ImmutableCopy().(catalog.TableDescriptor)
+	mutParent := tabledesc.NewBuilder(parent.TableDesc()).BuildExistingMutableTable()
+	mutParent.PrimaryIndex.InterleavedBy = []descpb.ForeignKeyReference{
+		{Table: child.GetID(), Index: child.GetPrimaryIndexID()},
+	}
+	interleavedParent := mutParent.ImmutableCopy().(catalog.TableDescriptor)
+
+	for _, tc := range []struct {
+		table    catalog.TableDescriptor
+		expected string
+	}{
+		{table: interleavedChild, expected: "index c_pkey (1) of table c is interleaved"},
+		{table: interleavedParent, expected: "index p_pkey (1) of table p is interleaved"},
+	} {
+		var spec fetchpb.IndexFetchSpec
+		err := rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, tc.table, tc.table.GetPrimaryIndex(), columnIDsByName(t, tc.table, "a"),
+		)
+		require.ErrorContains(t, err, tc.expected)
+		require.True(t, errors.HasAssertionFailure(err))
+	}
+
+	// The tables can be read once they are no longer interleaved.
+	for _, table := range []catalog.TableDescriptor{parent, child} {
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), columnIDsByName(t, table, "a"),
+		))
+	}
+}
+
+// TestInitIndexFetchSpecKeyOnlySuffixColumns verifies that the primary key
+// columns can be fetched from (only) the key and family 0 of non-covering
+// secondary indexes.
+func TestInitIndexFetchSpecKeyOnlySuffixColumns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k1 INT, k2 STRING, a INT, b INT, c INT,
+  PRIMARY KEY (k1, k2),
+  FAMILY f0 (k1, k2, a), FAMILY f1 (b), FAMILY f2 (c),
+  INDEX b_idx (b),
+  UNIQUE INDEX c_idx (c)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 'one', 10, 20, 30), (2, 'two', 11, 21, 31)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	for _, tc := range []struct {
+		index  string
+		keyVal int64
+		suffix bool
+	}{
+		// The primary key columns are key suffix columns of b_idx.
+		{index: "b_idx", keyVal: 21, suffix: true},
+		// The primary key columns are encoded in the value of c_idx.
+		{index: "c_idx", keyVal: 31},
+	} {
+		index, err := catalog.MustFindIndexByName(table, tc.index)
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpecKeyOnly(
+			&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k1", "k2"),
+		))
+		require.Equal(t, descpb.FamilyID(0), spec.MaxFamilyID)
+		require.Equal(t, uint32(1), spec.MaxKeysPerRow)
+		require.Empty(t, spec.FamilyDefaultColumns)
+		for i := range spec.FetchedColumns {
+			require.Equal(t, fetchpb.IndexFetchSpec_KEY_SUFFIX, spec.FetchedColumns[i].Role)
+		}
+
+		rowKey := rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID())
+		rowKey = encoding.EncodeVarintAscending(rowKey, tc.keyVal)
+		if tc.suffix {
+			rowKey = encoding.EncodeVarintAscending(rowKey, 2)
+			rowKey = encoding.EncodeStringAscending(rowKey, "two")
+		}
+		spans := rowenc.SplitRowKeyIntoFamilySpans(nil /* appendTo */, rowKey, []descpb.FamilyID{0})
+		rows := fetchRows(t, kvDB, &spec, spans)
+		require.Len(t, rows, 1)
+		require.Equal(t, "(2, 'two')", tree.AsString(&rows[0]))
+	}
+}
+
+func TestInitIndexFetchSpecAllColumns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k1 INT, k2 INT, a INT, b INT, c INT, d INT, v INT AS (a + b) VIRTUAL,
+  PRIMARY KEY (k2, k1),
+  FAMILY f0 (k1, k2, a), FAMILY f1 (b, c), FAMILY f2 (d),
+  INDEX ba_idx (b, a) STORING (d, c),
+  UNIQUE INDEX c_idx (c) STORING (a)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 2, 3, 4, 5, 6)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	for _, tc := range []struct {
+		index    string
+		expected []string
+		row      string
+	}{
+		{index: "t_pkey", expected: []string{"k2", "k1", "a", "b", "c", "d"}, row: "(2, 1, 3, 4, 5, 6)"},
+		{index: "ba_idx", expected: []string{"b", "a", "k2", "k1", "d", "c"}, row: "(4, 3, 2, 1, 6, 5)"},
+		{index: "c_idx", expected: []string{"c", "k2", "k1", "a"}, row: "(5, 2, 1, 3)"},
+	} {
+		index, err := catalog.MustFindIndexByName(table, tc.index)
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpecAllColumns(&spec, keys.SystemSQLCodec, table, index))
+		names := make([]string, len(spec.FetchedColumns))
+		for i := range spec.FetchedColumns {
+			names[i] = spec.FetchedColumns[i].Name
+		}
+		require.Equal(t, tc.expected, names, tc.index)
+
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+		rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+		require.Len(t, rows, 1)
+		require.Equal(t, tc.row, tree.AsString(&rows[0]), tc.index)
+	}
+}
+
+func TestInitIndexFetchSpecCompositeKeyColumns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k DECIMAL PRIMARY KEY, a DECIMAL, b DECIMAL, c INT,
+  INDEX a_idx (a, c) STORING (b)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1.50, 2.000, 3.0, 4)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	for _, tc := range []struct {
+		index     string
+		composite []bool
+	}{
+		{index: "t_pkey", composite: []bool{true, false, false, false}},
+		{index: "a_idx", composite: []bool{true, true, false, false}},
+	} {
+		index, err := catalog.MustFindIndexByName(table, tc.index)
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k", "a", "b", "c"),
+		))
+		for i := range spec.FetchedColumns {
+			col := &spec.FetchedColumns[i]
+			require.Equal(t, tc.composite[i], col.IsCompositeKeyColumn, "%s: %s", tc.index, col.Name)
+		}
+
+		// The scale of the decimals is preserved.
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+		rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+		require.Len(t, rows, 1)
+		require.Equal(t, "(1.50, 2.000, 3.0, 4)", tree.AsString(&rows[0]), tc.index)
+	}
+}
+
+// TestInitIndexFetchSpecCompositeKeyColumnFamily verifies that the value of a
+// composite primary key column is read from the family which contains the
+// column, even when that is not family 0.
+func TestInitIndexFetchSpecCompositeKeyColumnFamily(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	// In t, k is the default column of its family (so its value is not encoded
+	// as a tuple); in u, it shares its family with b.
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k DECIMAL PRIMARY KEY, a INT, b INT,
+  FAMILY f0 (a), FAMILY f1 (k), FAMILY f2 (b)
+)`)
+	sqlDB.Exec(t, `CREATE TABLE u (
+  k DECIMAL PRIMARY KEY, a INT, b INT,
+  FAMILY f0 (a), FAMILY f1 (b, k)
+)`)
+	for _, name := range []string{"t", "u"} {
+		sqlDB.Exec(t, fmt.Sprintf(`INSERT INTO %s VALUES (1.500, 1, 2), (2, 3, 4)`, name))
+		table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", name)
+		index := table.GetPrimaryIndex()
+		kCol, err := catalog.MustFindColumnByName(table, "k")
+		require.NoError(t, err)
+
+		// The family of k is needed to fetch k (along with family 0, which is
+		// needed as a sentinel since the other family might be empty).
+		var neededCols intsets.Fast
+		neededCols.Add(kCol.Ordinal())
+		families := rowenc.NeededColumnFamilyIDs(neededCols, table, index)
+		require.Equal(t, []descpb.FamilyID{0, 1}, families, name)
+
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpecForFamilies(
+			&spec, keys.SystemSQLCodec, table, index, []descpb.ColumnID{kCol.GetID()}, families,
+		))
+		require.True(t, spec.FetchedColumns[0].IsCompositeKeyColumn)
+		if name == "t" {
+			require.Contains(t, spec.FamilyDefaultColumns, fetchpb.IndexFetchSpec_FamilyDefaultColumn{
+				FamilyID: 1, DefaultColumnID: kCol.GetID(),
+			})
+		}
+
+		// The scale of the decimal survives the round trip, both when reading the
+		// needed families of the row and when reading all of them.
+		d, err := tree.ParseDDecimal("1.500")
+		require.NoError(t, err)
+		rowKey := rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID())
+		rowKey = encoding.EncodeDecimalAscending(rowKey, &d.Decimal)
+		rows := fetchRows(t, kvDB, &spec, rowenc.SplitRowKeyIntoFamilySpans(nil /* appendTo */, rowKey, families))
+		require.Len(t, rows, 1)
+		require.Equal(t, "(1.500)", tree.AsString(&rows[0]), name)
+
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k", "b"),
+		))
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+		rows = fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+		require.Len(t, rows, 2)
+		require.Equal(t, "(1.500, 2)", tree.AsString(&rows[0]), name)
+		require.Equal(t, "(2, 4)", tree.AsString(&rows[1]), name)
+	}
+}
+
+// TestInitIndexFetchSpecDeleteOnlyColumn verifies that a non-nullable column
+// which is being dropped (and is still present in the indexes) can be read,
+// including for rows which don't have a value for it.
+func TestInitIndexFetchSpecDeleteOnlyColumn(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (a INT PRIMARY KEY, c INT, INDEX c_idx (c))`)
+	// The second row simulates a row inserted while c is DELETE_ONLY.
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 10), (2, NULL)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	// makeTable returns a copy of the table in which c is not nullable and,
+	// if deleteOnly is set, is a DELETE_ONLY column being dropped.
+	makeTable := func(deleteOnly bool) catalog.TableDescriptor {
+		mut := tabledesc.NewBuilder(table.TableDesc()).BuildExistingMutableTable()
+		mut.Columns[1].Nullable = false
+		if deleteOnly {
+			colDesc := mut.Columns[1]
+			mut.Columns = mut.Columns[:1]
+			mut.AddColumnMutation(&colDesc, descpb.DescriptorMutation_DROP)
+			mut.Mutations[len(mut.Mutations)-1].State = descpb.DescriptorMutation_DELETE_ONLY
+		}
+		return mut.ImmutableCopy().(catalog.TableDescriptor)
+	}
+	fetch := func(
+		table catalog.TableDescriptor, index string, expectNonNullable bool,
+	) ([]string, error) {
+		idx, err := catalog.MustFindIndexByName(table, index)
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, idx, columnIDsByName(t, table, "a", "c"),
+		))
+		require.Equal(t, expectNonNullable, spec.FetchedColumns[1].IsNonNullable)
+
+		var rf row.Fetcher
+		ctx := context.Background()
+		require.NoError(t, rf.Init(ctx, row.FetcherInitArgs{
+			Txn:   kvDB.NewTxn(ctx, "fetch-rows"),
+			Alloc: &tree.DatumAlloc{},
+			Spec:  &spec,
+		}))
+		defer rf.Close(ctx)
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), idx.GetID()))
+		require.NoError(t, rf.StartScan(
+			ctx, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}},
+			nil /* spanIDs */, rowinfra.NoBytesLimit, rowinfra.NoRowLimit,
+		))
+		var rows []string
+		for {
+			datums, err := rf.NextRowDecoded(ctx)
+			if err != nil || datums == nil {
+				return rows, err
+			}
+			rows = append(rows, tree.AsString(&datums))
+		}
+	}
+
+	// If c is public, the missing value is reported as a corruption.
+	_, err := fetch(makeTable(false /* deleteOnly */), "t_pkey", true /* expectNonNullable */)
+	require.ErrorContains(t, err, "Non-nullable column \"t:c\" with no value")
+
+	// If c is being dropped, the missing value is NULL.
+	deleteOnly := makeTable(true /* deleteOnly */)
+	rows, err := fetch(deleteOnly, "t_pkey", false /* expectNonNullable */)
+	require.NoError(t, err)
+	require.Equal(t, []string{"(1, 10)", "(2, NULL)"}, rows)
+	rows, err = fetch(deleteOnly, "c_idx", false /* expectNonNullable */)
+	require.NoError(t, err)
+	require.Equal(t, []string{"(2, NULL)", "(1, 10)"}, rows)
+}
+
+func TestInitIndexFetchSpecMissingInvertedColumn(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (a INT PRIMARY KEY, j JSONB, INVERTED INDEX j_idx (j))`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	// Corrupt the descriptor so that the inverted column of the index doesn't
+	// exist.
+	mut := tabledesc.NewBuilder(table.TableDesc()).BuildExistingMutableTable()
+	require.Equal(t, descpb.IndexDescriptor_INVERTED, mut.Indexes[0].Type)
+	mut.Indexes[0].KeyColumnIDs[0] = 100
+	corrupt := mut.ImmutableCopy().(catalog.TableDescriptor)
+	index, err := catalog.MustFindIndexByName(corrupt, "j_idx")
+	require.NoError(t, err)
+
+	var spec fetchpb.IndexFetchSpec
+	err = rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, corrupt, index, columnIDsByName(t, corrupt, "a"))
+	require.True(t, errors.HasAssertionFailure(err))
+	require.ErrorContains(t, err, "cannot resolve the type of key column 0 of index j_idx (2) of table t")
+}
+
+func TestInitIndexFetchSpecTrigramIndex(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (k INT PRIMARY KEY, s STRING NOT NULL, INVERTED INDEX s_idx (s gin_trgm_ops))`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 'Hello')`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	index, err := catalog.MustFindIndexByName(table, "s_idx")
+	require.NoError(t, err)
+	require.Equal(t, catpb.InvertedIndexColumnKind_TRIGRAM, index.InvertedColumnKind())
+
+	// The inverted key is fetched like for JSON and array inverted indexes.
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k", "s"),
+	))
+	keyCol := &spec.KeyAndSuffixColumns[0]
+	require.True(t, keyCol.IsInverted)
+	require.True(t, keyCol.Type.Identical(types.EncodedKey))
+	col := &spec.FetchedColumns[1]
+	require.True(t, col.Type.Identical(types.EncodedKey))
+	require.False(t, col.IsNonNullable)
+	require.Equal(t, fetchpb.IndexFetchSpec_KEY, col.Role)
+
+	// There is a row for each trigram, in which the inverted key is the encoded
+	// trigram.
+	prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+	var trigrams []string
+	for _, row := range fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}}) {
+		require.Equal(t, "1", row[0].String())
+		_, trgm, err := encoding.DecodeUnsafeStringAscending([]byte(*row[1].(*tree.DEncodedKey)), nil)
+		require.NoError(t, err)
+		trigrams = append(trigrams, trgm)
+	}
+	require.Equal(t, trigram.MakeTrigrams("Hello", true /* pad */), trigrams)
+}
+
+func TestIndexFetchSpecEqual(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TYPE greeting AS ENUM ('hello', 'howdy', 'hi')`)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  g greeting,
+  s STRING,
+  v INT AS (k + 1) VIRTUAL,
+  FAMILY (k, g), FAMILY (s),
+  INDEX g_idx (g) STORING (s)
+)`)
+	initSpec := func() *fetchpb.IndexFetchSpec {
+		// Each spec uses its own copy of the descriptor, so their types are
+		// distinct.
+		table := hydratedTableDescriptor(t, srv, kvDB, "t")
+		index, err := catalog.MustFindIndexByName(table, "g_idx")
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+			&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k", "g", "s", "v"),
+			rowenc.IndexFetchSpecOptions{
+				IncludeVirtualColumnDependencies: true,
+				IncludeStoredColumnsByFamily:     true,
+			},
+		))
+		return &spec
+	}
+	spec, other := initSpec(), initSpec()
+	require.NotSame(t, spec.FetchedColumns[1].Type, other.FetchedColumns[1].Type)
+	require.True(t, spec.Equal(other))
+	require.True(t, other.Equal(spec))
+	require.True(t, spec.Equal(spec.Clone()))
+	require.False(t, spec.Equal(nil))
+	require.True(t, (*fetchpb.IndexFetchSpec)(nil).Equal(nil))
+
+	// The capacity of the slices doesn't matter, and neither does the
+	// difference between nil and empty slices.
+	other.FetchedColumns = append(make([]fetchpb.IndexFetchSpec_Column, 0, 100), other.FetchedColumns...)
+	require.Nil(t, other.PartitioningColumnIDs)
+	other.PartitioningColumnIDs = []descpb.ColumnID{}
+	require.True(t, spec.Equal(other))
+
+	// Types are compared with Equivalent, so a different width doesn't matter.
+	other.FetchedColumns[0].Type = types.Int4
+	require.True(t, spec.Equal(other))
+
+	for _, tc := range []struct {
+		name   string
+		modify func(s *fetchpb.IndexFetchSpec)
+	}{
+		{"column type", func(s *fetchpb.IndexFetchSpec) { s.FetchedColumns[2].Type = types.Int }},
+		{"key column type", func(s *fetchpb.IndexFetchSpec) { s.KeyAndSuffixColumns[0].Type = types.String }},
+		{"column name", func(s *fetchpb.IndexFetchSpec) { s.FetchedColumns[3].Name = "u" }},
+		{"key column direction", func(s *fetchpb.IndexFetchSpec) {
+			s.KeyAndSuffixColumns[0].Direction = catenumpb.IndexColumn_DESC
+		}},
+		{"fewer columns", func(s *fetchpb.IndexFetchSpec) { s.FetchedColumns = s.FetchedColumns[:3] }},
+		{"stored columns", func(s *fetchpb.IndexFetchSpec) { s.StoredColumnsByFamily[0].StoredColumnIDs[0]++ }},
+		{"virtual column dependencies", func(s *fetchpb.IndexFetchSpec) { s.VirtualColumnDependencyIDs = nil }},
+		{"table name", func(s *fetchpb.IndexFetchSpec) { s.TableName = "u" }},
+		{"max family", func(s *fetchpb.IndexFetchSpec) { s.MaxFamilyID++ }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			modified := spec.Clone()
+			tc.modify(modified)
+			require.False(t, spec.Equal(modified))
+			require.False(t, modified.Equal(spec))
+		})
+	}
+}
+
+func TestInitIndexFetchSpecImplicitPrimaryKey(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (a INT, b STRING, INDEX a_idx (a))`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (2, 'x'), (1, NULL), (NULL, 'z')`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	rowid, err := catalog.MustFindColumnByName(table, "rowid")
+	require.NoError(t, err)
+	require.True(t, rowid.IsHidden())
+	require.Equal(t, []descpb.ColumnID{rowid.GetID()}, table.GetPrimaryIndex().CollectKeyColumnIDs().Ordered())
+
+	scan := func(spec *fetchpb.IndexFetchSpec) []tree.Datums {
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), spec.IndexID))
+		return fetchRows(t, kvDB, spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+	}
+
+	// Full scan of the primary index, which is keyed on rowid.
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), columnIDsByName(t, table, "rowid", "a", "b"),
+	))
+	require.Len(t, spec.KeyAndSuffixColumns, 1)
+	require.Equal(t, rowid.GetID(), spec.KeyAndSuffixColumns[0].ColumnID)
+	require.True(t, spec.KeyAndSuffixColumns[0].IsNonNullable)
+	require.Zero(t, spec.NumKeySuffixColumns)
+	require.True(t, spec.FetchedColumns[0].IsNonNullable)
+	require.Equal(t, fetchpb.IndexFetchSpec_KEY, spec.FetchedColumns[0].Role)
+	require.False(t, spec.FetchedColumns[1].IsNonNullable)
+	require.False(t, spec.FetchedColumns[2].IsNonNullable)
+	primaryRows := scan(&spec)
+	require.Len(t, primaryRows, 3)
+	aByRowID := make(map[string]string)
+	for _, row := range primaryRows {
+		require.NotEqual(t, tree.DNull, row[0])
+		aByRowID[row[0].String()] = row[1].String()
+	}
+
+	// Scan of the secondary index, in which rowid is the key suffix.
+	index, err := catalog.MustFindIndexByName(table, "a_idx")
+	require.NoError(t, err)
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "rowid", "a"),
+	))
+	require.Equal(t, uint32(1), spec.NumKeySuffixColumns)
+	require.Equal(t, []descpb.ColumnID{rowid.GetID()}, spec.KeySuffixColumnIDs)
+	suffixCol := &spec.KeySuffixColumns()[0]
+	require.Equal(t, rowid.GetID(), suffixCol.ColumnID)
+	require.True(t, suffixCol.IsNonNullable)
+	require.True(t, spec.FetchedColumns[0].IsNonNullable)
+	require.False(t, spec.FetchedColumns[1].IsNonNullable)
+	var res []string
+	for _, row := range scan(&spec) {
+		a, ok := aByRowID[row[0].String()]
+		require.True(t, ok)
+		require.Equal(t, a, row[1].String())
+		res = append(res, a)
+	}
+	// The index is ordered on a, and NULLs sort first.
+	require.Equal(t, []string{"NULL", "1", "2"}, res)
+}
+
+func TestInitIndexFetchSpecCheckedEncodingType(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  a INT PRIMARY KEY,
+  b INT,
+  c INT,
+  d INT,
+  v INT AS (b + c) VIRTUAL,
+  FAMILY f0 (a, b),
+  FAMILY f1 (c, d),
+  INDEX b_idx (b) STORING (c)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	// newPrimary is a copy of the table in which b_idx is a new primary index
+	// being built (e.g. by ALTER PRIMARY KEY): a secondary index which uses the
+	// primary encoding and stores all the columns.
+	mut := tabledesc.NewBuilder(table.TableDesc()).BuildExistingMutableTable()
+	mut.Indexes[0].EncodingType = catenumpb.PrimaryIndexEncoding
+	mut.Indexes[0].StoreColumnNames = []string{"c", "d"}
+	mut.Indexes[0].StoreColumnIDs = columnIDsByName(t, table, "c", "d")
+	newPrimary := mut.ImmutableCopy().(catalog.TableDescriptor)
+
+	// noFamily is a (corrupt) copy of the table in which d isn't in any family,
+	// so it is not written to the primary index even though it is stored.
+	mut = tabledesc.NewBuilder(table.TableDesc()).BuildExistingMutableTable()
+	mut.Families[1].ColumnNames = []string{"c"}
+	mut.Families[1].ColumnIDs = columnIDsByName(t, table, "c")
+	noFamily := mut.ImmutableCopy().(catalog.TableDescriptor)
+
+	for _, tc := range []struct {
+		table   catalog.TableDescriptor
+		index   string
+		columns []string
+		err     string
+	}{
+		// Primary encoding. Virtual columns aren't stored but can be fetched.
+		{table: table, index: "t_pkey", columns: []string{"a", "b", "c", "d", "v"}},
+		{table: newPrimary, index: "b_idx", columns: []string{"a", "b", "c", "d", "v"}},
+		{table: noFamily, index: "t_pkey", columns: []string{"a", "b", "c"}},
+		{
+			table: noFamily, index: "t_pkey", columns: []string{"a", "d"},
+			err: "requested column d (4) not in index t_pkey (1) of table t",
+		},
+		// Secondary encoding.
+		{table: table, index: "b_idx", columns: []string{"a", "b", "c"}},
+		{
+			table: table, index: "b_idx", columns: []string{"b", "d"},
+			err: "requested column d (4) not in index b_idx (2) of table t",
+		},
+		// v is computed from b and c, which are both available.
+		{table: table, index: "b_idx", columns: []string{"b", "v"}},
+	} {
+		index, err := catalog.MustFindIndexByName(tc.table, tc.index)
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		err = rowenc.InitIndexFetchSpecChecked(
+			&spec, keys.SystemSQLCodec, tc.table, index, columnIDsByName(t, tc.table, tc.columns...),
+		)
+		if tc.err == "" {
+			require.NoError(t, err, "%s %v", tc.index, tc.columns)
+			continue
+		}
+		require.ErrorContains(t, err, tc.err)
+		if buildutil.CrdbTestBuild && !index.Primary() {
+			// The check also runs in test builds for the secondary indexes of both
+			// encodings.
+			err := rowenc.InitIndexFetchSpec(
+				&spec, keys.SystemSQLCodec, tc.table, index, columnIDsByName(t, tc.table, tc.columns...),
+			)
+			require.ErrorContains(t, err, tc.err)
+		}
+	}
+}
+
+func TestInitIndexFetchSpecInvertedColumnDirection(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  tenant INT,
+  j JSONB,
+  INVERTED INDEX j_idx (tenant DESC, j)
+)`)
+	// The inverted column itself can't be descending.
+	sqlDB.ExpectErr(t, "the last column in an inverted index cannot have the DESC option",
+		`CREATE INVERTED INDEX ON t (j DESC)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 10, '{"a": 1}'), (2, 20, '{"b": 2}')`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	checkSpec := func(
+		table catalog.TableDescriptor, expected []catenumpb.IndexColumn_Direction,
+	) *fetchpb.IndexFetchSpec {
+		index, err := catalog.MustFindIndexByName(table, "j_idx")
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k", "tenant", "j"),
+		))
+		require.Equal(t, expected, spec.KeyColumnDirections())
+		// The type of the inverted column is overridden, but not its direction.
+		invertedCol := &spec.KeyColumns()[1]
+		require.True(t, invertedCol.IsInverted)
+		require.True(t, invertedCol.Type.Identical(types.EncodedKey))
+		require.Equal(t, expected[1], invertedCol.Direction)
+		return &spec
+	}
+
+	const (
+		asc  = catenumpb.IndexColumn_ASC
+		desc = catenumpb.IndexColumn_DESC
+	)
+	// The prefix column is descending; the inverted column and the key suffix
+	// are ascending.
+	spec := checkSpec(table, []catenumpb.IndexColumn_Direction{desc, asc, asc})
+	index, err := catalog.MustFindIndexByName(table, "j_idx")
+	require.NoError(t, err)
+	prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+	var tenants []string
+	for _, row := range fetchRows(t, kvDB, spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}}) {
+		// A JSON value can have multiple inverted keys.
+		if tenant := row[1].String(); len(tenants) == 0 || tenants[len(tenants)-1] != tenant {
+			tenants = append(tenants, tenant)
+		}
+	}
+	// The rows are in decreasing order of tenant.
+	require.Equal(t, []string{"20", "10"}, tenants)
+
+	// If the descriptor says that the inverted column is descending, the
+	// direction is propagated as well.
+	mut := tabledesc.NewBuilder(table.TableDesc()).BuildExistingMutableTable()
+	mut.Indexes[0].KeyColumnDirections[1] = desc
+	checkSpec(mut.ImmutableCopy().(catalog.TableDescriptor), []catenumpb.IndexColumn_Direction{desc, desc, asc})
+}
+
+func TestAddFetchColumn(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY, a INT, b INT, c INT, d INT,
+  FAMILY f0 (k, a), FAMILY f1 (b), FAMILY f2 (c, d),
+  INDEX b_idx (b)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 10, 20, 30, 40), (2, 11, 21, 31, 41)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	primary := table.GetPrimaryIndex()
+	tableDefaults := append([]fetchpb.IndexFetchSpec_FamilyDefaultColumn(nil), table.FamilyDefaultColumns()...)
+
+	// Start with a spec which only covers family 0.
+	spec := fetchpb.IndexFetchSpec{FetchedColumns: make([]fetchpb.IndexFetchSpec_Column, 0, 5)}
+	require.NoError(t, rowenc.InitIndexFetchSpecForFamilies(
+		&spec, keys.SystemSQLCodec, table, primary, columnIDsByName(t, table, "k", "a"),
+		[]descpb.FamilyID{0},
+	))
+	firstCol := &spec.FetchedColumns[0]
+	require.Equal(t, uint32(1), spec.MaxKeysPerRow)
+	require.Len(t, spec.FamilyDefaultColumns, 1)
+
+	for _, tc := range []struct {
+		column           string
+		maxKeysPerRow    uint32
+		maxFamilyID      descpb.FamilyID
+		defaultFamilyIDs []descpb.FamilyID
+	}{
+		// b is the default column of family 1.
+		{column: "b", maxKeysPerRow: 2, maxFamilyID: 1, defaultFamilyIDs: []descpb.FamilyID{0, 1}},
+		// Family 2 has no default column.
+		{column: "c", maxKeysPerRow: 3, maxFamilyID: 2, defaultFamilyIDs: []descpb.FamilyID{0, 1}},
+		// Family 2 is already covered.
+		{column: "d", maxKeysPerRow: 3, maxFamilyID: 2, defaultFamilyIDs: []descpb.FamilyID{0, 1}},
+	} {
+		numCols := len(spec.FetchedColumns)
+		require.NoError(t, rowenc.AddFetchColumn(&spec, table, primary, columnIDsByName(t, table, tc.column)[0]))
+		require.Len(t, spec.FetchedColumns, numCols+1)
+		require.Equal(t, tc.column, spec.FetchedColumns[numCols].Name)
+		require.Equal(t, fetchpb.IndexFetchSpec_STORED, spec.FetchedColumns[numCols].Role)
+		require.Equal(t, tc.maxKeysPerRow, spec.MaxKeysPerRow, tc.column)
+		require.Equal(t, tc.maxFamilyID, spec.MaxFamilyID, tc.column)
+		var defaultFamilyIDs []descpb.FamilyID
+		for _, f := range spec.FamilyDefaultColumns {
+			defaultFamilyIDs = append(defaultFamilyIDs, f.FamilyID)
+		}
+		require.Equal(t, tc.defaultFamilyIDs, defaultFamilyIDs, tc.column)
+	}
+	// The capacity of FetchedColumns was reused, and the descriptor wasn't
+	// modified.
+	require.Same(t, firstCol, &spec.FetchedColumns[0])
+	require.Equal(t, tableDefaults, table.FamilyDefaultColumns())
+
+	// The spec matches the one built for all the columns at once.
+	var expected fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&expected, keys.SystemSQLCodec, table, primary, columnIDsByName(t, table, "k", "a", "b", "c", "d"),
+	))
+	require.Equal(t, expected.FetchedColumns, spec.FetchedColumns)
+	require.Equal(t, expected.MaxKeysPerRow, spec.MaxKeysPerRow)
+	require.Equal(t, expected.MaxFamilyID, spec.MaxFamilyID)
+	require.Equal(t, expected.FamilyDefaultColumns, spec.FamilyDefaultColumns)
+	prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), primary.GetID()))
+	rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+	require.Len(t, rows, 2)
+	require.Equal(t, "(2, 11, 21, 31, 41)", tree.AsString(&rows[1]))
+
+	// Invalid columns are rejected and leave the spec unchanged.
+	err := rowenc.AddFetchColumn(&spec, table, primary, columnIDsByName(t, table, "b")[0])
+	require.ErrorContains(t, err, "column b (3) of table t is fetched more than once")
+	require.Len(t, spec.FetchedColumns, 5)
+	bIdx, err := catalog.MustFindIndexByName(table, "b_idx")
+	require.NoError(t, err)
+	err = rowenc.AddFetchColumn(&spec, table, bIdx, columnIDsByName(t, table, "c")[0])
+	require.ErrorContains(t, err, "spec for index 1 of table")
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, bIdx, columnIDsByName(t, table, "k", "b"),
+	))
+	err = rowenc.AddFetchColumn(&spec, table, bIdx, columnIDsByName(t, table, "c")[0])
+	require.ErrorContains(t, err, "requested column c (4) not in index b_idx (2) of table t")
+	require.Len(t, spec.FetchedColumns, 2)
+}
+
+// TestIndexFetchTelemetry verifies that the fetchers increment the telemetry
+// counters of the features of the indexes they scan.
+func TestIndexFetchTelemetry(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY, a INT, d DECIMAL, j JSONB, b INT,
+  FAMILY f0 (k, a, d, j), FAMILY f1 (b),
+  INDEX a_idx (a) WHERE a > 0,
+  INDEX d_idx (d),
+  INVERTED INDEX j_idx (j)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	for _, tc := range []struct {
+		index   string
+		counter telemetry.Counter
+	}{
+		{index: "j_idx", counter: sqltelemetry.IndexFetchInvertedCounter},
+		{index: "a_idx", counter: sqltelemetry.IndexFetchPartialCounter},
+		{index: "d_idx", counter: sqltelemetry.IndexFetchCompositeCounter},
+		{index: "t_pkey", counter: sqltelemetry.IndexFetchMultiFamilyCounter},
+	} {
+		index, err := catalog.MustFindIndexByName(table, tc.index)
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k"),
+		))
+		// Other scans can run concurrently, so we can only check that the
+		// counter was incremented.
+		before := telemetry.Read(tc.counter)
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+		fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+		require.Greater(t, telemetry.Read(tc.counter), before, tc.index)
+	}
+}
+
+func TestInitIndexFetchSpecVirtualColumnNotCovered(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  a INT,
+  b INT,
+  v INT AS (a + b) VIRTUAL,
+  INDEX ab_idx (a) STORING (b),
+  INDEX a_idx (a),
+  INDEX v_idx (v)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	for _, tc := range []struct {
+		index string
+		err   string
+	}{
+		{index: "t_pkey"},
+		{index: "ab_idx"},
+		{index: "a_idx", err: "virtual column v of table t references column b, which is not in index a_idx"},
+		// v is a key column, so its value is decoded from the index.
+		{index: "v_idx"},
+	} {
+		index, err := catalog.MustFindIndexByName(table, tc.index)
+		require.NoError(t, err)
+		fetchCols := columnIDsByName(t, table, "k", "v")
+		var spec fetchpb.IndexFetchSpec
+		errs := []error{
+			rowenc.InitIndexFetchSpecWithOptions(
+				&spec, keys.SystemSQLCodec, table, index, fetchCols,
+				rowenc.IndexFetchSpecOptions{RequireVirtualColumnsCovered: true},
+			),
+			rowenc.InitIndexFetchSpecChecked(&spec, keys.SystemSQLCodec, table, index, fetchCols),
+		}
+		for _, err := range errs {
+			if tc.err == "" {
+				require.NoError(t, err, tc.index)
+				continue
+			}
+			require.True(t, errors.Is(err, rowenc.ErrVirtualColumnNotCovered), "%+v", err)
+			require.ErrorContains(t, err, tc.err)
+		}
+		if tc.err != "" && !buildutil.CrdbTestBuild {
+			// The check is not done by default.
+			require.NoError(t, rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, table, index, fetchCols))
+		}
+	}
+}
+
+func TestPrimaryIndexFetchSpecFrom(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  a INT, b STRING, c INT, d INT,
+  PRIMARY KEY (b DESC, a),
+  INDEX c_idx (c)
+)`)
+	sqlDB.Exec(t, `CREATE TABLE u (k INT PRIMARY KEY, c INT, INDEX c_idx (c))`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 'x', 10, 100), (2, 'y', 20, 200)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	cIdx, err := catalog.MustFindIndexByName(table, "c_idx")
+	require.NoError(t, err)
+	primary := table.GetPrimaryIndex()
+
+	var secondary fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&secondary, keys.SystemSQLCodec, table, cIdx, columnIDsByName(t, table, "a", "b", "c"),
+	))
+	spec, err := rowenc.PrimaryIndexFetchSpecFrom(
+		&secondary, keys.SystemSQLCodec, table, columnIDsByName(t, table, "a", "b", "d"),
+	)
+	require.NoError(t, err)
+	require.False(t, spec.IsSecondaryIndex)
+	require.Equal(t, primary.GetID(), spec.IndexID)
+	var expected fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&expected, keys.SystemSQLCodec, table, primary, columnIDsByName(t, table, "a", "b", "d"),
+	))
+	require.Equal(t, expected, spec)
+
+	// The key columns are the primary key columns, which are the key suffix
+	// columns of the secondary index.
+	keyCols := spec.KeyColumns()
+	require.Len(t, keyCols, primary.NumKeyColumns())
+	for i := range keyCols {
+		require.Equal(t, primary.GetKeyColumnID(i), keyCols[i].ColumnID)
+		require.Equal(t, primary.GetKeyColumnDirection(i), keyCols[i].Direction)
+		require.Equal(t, primary.GetKeyColumnID(i), secondary.KeySuffixColumns()[i].ColumnID)
+	}
+
+	// Look up the rows fetched from the secondary index in the primary index.
+	prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), cIdx.GetID()))
+	var spans roachpb.Spans
+	for _, row := range fetchRows(t, kvDB, &secondary, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}}) {
+		span, err := rowenc.MakeSpanForPrefix(&spec, keys.SystemSQLCodec, tree.Datums{row[1], row[0]})
+		require.NoError(t, err)
+		spans = append(spans, span)
+	}
+	var res []string
+	for _, row := range fetchRows(t, kvDB, &spec, spans) {
+		res = append(res, tree.AsString(&row))
+	}
+	require.ElementsMatch(t, []string{"(1, 'x', 100)", "(2, 'y', 200)"}, res)
+
+	// The version of the secondary spec is preserved.
+	var oldSecondary fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&oldSecondary, keys.SystemSQLCodec, table, cIdx, columnIDsByName(t, table, "a", "b"),
+		rowenc.IndexFetchSpecOptions{TargetVersion: fetchpb.IndexFetchSpecVersionInitial},
+	))
+	spec, err = rowenc.PrimaryIndexFetchSpecFrom(
+		&oldSecondary, keys.SystemSQLCodec, table, columnIDsByName(t, table, "d"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, fetchpb.IndexFetchSpecVersionInitial, spec.Version)
+
+	// Invalid secondary specs.
+	other := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "u")
+	_, err = rowenc.PrimaryIndexFetchSpecFrom(
+		&secondary, keys.SystemSQLCodec, other, columnIDsByName(t, other, "k"),
+	)
+	require.ErrorContains(t, err, "spec for table t")
+	_, err = rowenc.PrimaryIndexFetchSpecFrom(
+		&expected, keys.SystemSQLCodec, table, columnIDsByName(t, table, "d"),
+	)
+	require.ErrorContains(t, err, "is not for a secondary index")
+	_, err = rowenc.PrimaryIndexFetchSpecFrom(
+		&secondary, keys.MakeSQLCodec(roachpb.MustMakeTenantID(10)), table, columnIDsByName(t, table, "d"),
+	)
+	require.ErrorContains(t, err, "was built with a different codec")
+}
+
+func TestInitIndexFetchSpecInvalidCodec(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (k INT PRIMARY KEY, v INT)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	fetchCols := columnIDsByName(t, table, "k", "v")
+
+	var spec fetchpb.IndexFetchSpec
+	err := rowenc.InitIndexFetchSpec(&spec, keys.SQLCodec{}, table, table.GetPrimaryIndex(), fetchCols)
+	require.ErrorContains(t, err, "invalid SQL codec")
+	specs := make([]fetchpb.IndexFetchSpec, 1)
+	err = rowenc.InitIndexFetchSpecs(
+		specs, keys.SQLCodec{}, table, []catalog.Index{table.GetPrimaryIndex()}, [][]descpb.ColumnID{fetchCols},
+	)
+	require.ErrorContains(t, err, "invalid SQL codec")
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), fetchCols,
+	))
+}
+
+func TestInitIndexFetchSpecRegionColumn(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	// Multi-region databases need a multi-region cluster, so we make the
+	// tables REGIONAL BY ROW by modifying their descriptors. The region columns
+	// aren't of the region enum type, but that doesn't matter for the specs.
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  crdb_region STRING NOT NULL, k INT, v INT, w INT,
+  PRIMARY KEY (crdb_region, k),
+  INDEX v_idx (crdb_region, v),
+  INDEX w_idx (w)
+)`)
+	sqlDB.Exec(t, `CREATE TABLE u (reg STRING NOT NULL, k INT, PRIMARY KEY (reg, k))`)
+	makeRegionalByRow := func(name string, regionColName tree.Name) catalog.TableDescriptor {
+		table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", name)
+		mut := tabledesc.NewBuilder(table.TableDesc()).BuildExistingMutableTable()
+		mut.SetTableLocalityRegionalByRow(regionColName)
+		return mut.ImmutableCopy().(catalog.TableDescriptor)
+	}
+	t1 := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	rbr := makeRegionalByRow("t", tree.RegionalByRowRegionNotSpecifiedName)
+	rbrAs := makeRegionalByRow("u", "reg")
+	require.True(t, rbr.IsLocalityRegionalByRow())
+
+	for _, tc := range []struct {
+		table    catalog.TableDescriptor
+		index    string
+		expected string
+	}{
+		{table: rbr, index: "t_pkey", expected: "crdb_region"},
+		{table: rbr, index: "v_idx", expected: "crdb_region"},
+		// The index is not partitioned by region.
+		{table: rbr, index: "w_idx"},
+		{table: rbrAs, index: "u_pkey", expected: "reg"},
+		// Not a REGIONAL BY ROW table.
+		{table: t1, index: "t_pkey"},
+		{table: t1, index: "v_idx"},
+	} {
+		index, err := catalog.MustFindIndexByName(tc.table, tc.index)
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, tc.table, index, columnIDsByName(t, tc.table, "k"),
+		))
+		var expected descpb.ColumnID
+		if tc.expected != "" {
+			expected = columnIDsByName(t, tc.table, tc.expected)[0]
+			require.Equal(t, expected, spec.KeyColumns()[0].ColumnID)
+			require.Contains(t, rowenc.FormatIndexFetchSpec(&spec), "regional by row")
+		}
+		require.Equal(t, expected, spec.RegionColumnID, "%s@%s", tc.table.GetName(), tc.index)
+	}
+
+	// The field is not part of the initial version.
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, rbr, rbr.GetPrimaryIndex(), columnIDsByName(t, rbr, "k"),
+		rowenc.IndexFetchSpecOptions{TargetVersion: fetchpb.IndexFetchSpecVersionInitial},
+	))
+	require.Zero(t, spec.RegionColumnID)
+}
+
+func TestInitIndexFetchSpecPartitioningColumns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	// Partitioning requires an enterprise license, so we partition the indexes
+	// by modifying the descriptor. The partition values are never decoded when
+	// building the specs, so they are left empty.
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  a INT, b INT, c INT, k INT, v INT,
+  PRIMARY KEY (a, b, k),
+  INDEX c_idx (c, b),
+  INDEX v_idx (v)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	mut := tabledesc.NewBuilder(table.TableDesc()).BuildExistingMutableTable()
+	// The primary index is partitioned by a, with one of the partitions
+	// subpartitioned by b.
+	mut.PrimaryIndex.Partitioning = catpb.PartitioningDescriptor{
+		NumColumns: 1,
+		List: []catpb.PartitioningDescriptor_List{
+			{Name: "p1", Values: [][]byte{{}}},
+			{Name: "p2", Values: [][]byte{{}}, Subpartitioning: catpb.PartitioningDescriptor{
+				NumColumns: 1,
+				List:       []catpb.PartitioningDescriptor_List{{Name: "p2_1", Values: [][]byte{{}}}},
+			}},
+		},
+	}
+	mut.Indexes[0].Partitioning = catpb.PartitioningDescriptor{
+		NumColumns: 1,
+		List:       []catpb.PartitioningDescriptor_List{{Name: "p3", Values: [][]byte{{}}}},
+	}
+	partitioned := mut.ImmutableCopy().(catalog.TableDescriptor)
+
+	for _, tc := range []struct {
+		table    catalog.TableDescriptor
+		index    string
+		expected []string
+	}{
+		{table: partitioned, index: "t_pkey", expected: []string{"a", "b"}},
+		{table: partitioned, index: "c_idx", expected: []string{"c"}},
+		// The index is not partitioned.
+		{table: partitioned, index: "v_idx"},
+		{table: table, index: "t_pkey"},
+		{table: table, index: "c_idx"},
+	} {
+		index, err := catalog.MustFindIndexByName(tc.table, tc.index)
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+			&spec, keys.SystemSQLCodec, tc.table, index, columnIDsByName(t, tc.table, "k"),
+			rowenc.IndexFetchSpecOptions{IncludePartitioningColumns: true},
+		))
+		var expected []descpb.ColumnID
+		if tc.expected != nil {
+			expected = columnIDsByName(t, tc.table, tc.expected...)
+		}
+		require.Equal(t, expected, spec.PartitioningColumnIDs, "%s", tc.index)
+
+		// Without the option, the columns are not reported.
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, tc.table, index, columnIDsByName(t, tc.table, "k"),
+		))
+		require.Nil(t, spec.PartitioningColumnIDs)
+	}
+
+	// The partitioning can't use more columns than the index has.
+	mut.Indexes[0].Partitioning.NumColumns = 3
+	invalid := mut.ImmutableCopy().(catalog.TableDescriptor)
+	index, err := catalog.MustFindIndexByName(invalid, "c_idx")
+	require.NoError(t, err)
+	var spec fetchpb.IndexFetchSpec
+	require.ErrorContains(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, invalid, index, columnIDsByName(t, invalid, "k"),
+		rowenc.IndexFetchSpecOptions{IncludePartitioningColumns: true},
+	), "partitioning of index c_idx of table t uses 3 columns but the index has 2 key columns")
+
+	// The field is not part of the initial version.
+	require.ErrorContains(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, partitioned, partitioned.GetPrimaryIndex(), columnIDsByName(t, partitioned, "k"),
+		rowenc.IndexFetchSpecOptions{
+			TargetVersion:              fetchpb.IndexFetchSpecVersionInitial,
+			IncludePartitioningColumns: true,
+		},
+	), "doesn't support the requested optional fields")
+}
+
+func TestInitIndexFetchSpecOutputColumns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (k INT PRIMARY KEY, a INT, b INT, c INT, d INT)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	fetchColumnIDs := columnIDsByName(t, table, "k", "a", "b", "c")
+
+	for _, tc := range []struct {
+		output   []string
+		expected []int32
+		err      string
+	}{
+		{output: []string{"k", "a", "b", "c"}, expected: []int32{0, 1, 2, 3}},
+		{output: []string{"c", "b", "a", "k"}, expected: []int32{3, 2, 1, 0}},
+		{output: []string{"c", "k"}, expected: []int32{1, -1, -1, 0}},
+		{output: []string{}, expected: []int32{-1, -1, -1, -1}},
+		// Output columns must be a subset of the fetched columns.
+		{output: []string{"k", "a", "b", "c", "d"}, err: "is not a fetched column"},
+		{output: []string{"d"}, err: "is not a fetched column"},
+		{output: []string{"a", "k", "a"}, err: "output column a (2) of table t is specified more than once"},
+	} {
+		t.Run(strings.Join(tc.output, ","), func(t *testing.T) {
+			var spec fetchpb.IndexFetchSpec
+			err := rowenc.InitIndexFetchSpecWithOptions(
+				&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), fetchColumnIDs,
+				rowenc.IndexFetchSpecOptions{OutputColumnIDs: columnIDsByName(t, table, tc.output...)},
+			)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, spec.ColumnToOutputIdx)
+		})
+	}
+
+	// Without the option, there is no mapping.
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), fetchColumnIDs,
+	))
+	require.Nil(t, spec.ColumnToOutputIdx)
+
+	// The mapping is not part of the initial version.
+	require.ErrorContains(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), fetchColumnIDs,
+		rowenc.IndexFetchSpecOptions{
+			TargetVersion:   fetchpb.IndexFetchSpecVersionInitial,
+			OutputColumnIDs: fetchColumnIDs,
+		},
+	), "doesn't support the requested optional fields")
+}
+
+func TestIndexFetchSpecHydrateTypes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(ctx)
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TYPE greeting AS ENUM ('hello', 'howdy', 'hi')`)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  g greeting,
+  ga greeting[],
+  INDEX g_idx (g) STORING (ga)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 'howdy', ARRAY['hi']), (2, 'hi', NULL)`)
+
+	hydrate := func(spec *fetchpb.IndexFetchSpec) {
+		require.NoError(t, sql.TestingDescsTxn(ctx, srv,
+			func(ctx context.Context, txn isql.Txn, col *descs.Collection) error {
+				resolver := descs.NewDistSQLTypeResolver(col, txn.KV())
+				return spec.HydrateTypes(ctx, &resolver)
+			},
+		))
+	}
+
+	for _, indexName := range []string{"t_pkey", "g_idx"} {
+		// The descriptor is not hydrated since it's not read through a
+		// collection.
+		table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+		index, err := catalog.MustFindIndexByName(table, indexName)
+		require.NoError(t, err)
+		fetchColumnIDs := columnIDsByName(t, table, "k", "g", "ga")
+		var spec fetchpb.IndexFetchSpec
+		require.ErrorContains(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs,
+		), "is not hydrated")
+		require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+			&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs,
+			rowenc.IndexFetchSpecOptions{AllowUnhydratedTypes: true},
+		))
+
+		// Simulate shipping the spec to a remote node, which receives the types
+		// without their metadata.
+		data, err := protoutil.Marshal(&spec)
+		require.NoError(t, err)
+		var remote fetchpb.IndexFetchSpec
+		require.NoError(t, protoutil.Unmarshal(data, &remote))
+
+		for _, s := range []*fetchpb.IndexFetchSpec{&spec, &remote} {
+			require.False(t, s.FetchedColumns[1].Type.IsHydrated())
+			hydrate(s)
+			for _, typ := range s.FetchedColumnTypes() {
+				require.Equal(t, typ.UserDefined(), typ.IsHydrated())
+			}
+			for i := range s.KeyAndSuffixColumns {
+				typ := s.KeyAndSuffixColumns[i].Type
+				require.Equal(t, typ.UserDefined(), typ.IsHydrated())
+			}
+
+			prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+			rows := fetchRows(t, kvDB, s, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+			var res []string
+			for i := range rows {
+				res = append(res, tree.AsString(&rows[i]))
+			}
+			require.Equal(t, []string{`(1, 'howdy', ARRAY['hi'])`, `(2, 'hi', NULL)`}, res, indexName)
+		}
+	}
+}
+
+func TestInitIndexFetchSpecWithMVCCTimestamp(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY, a INT, b INT,
+  FAMILY f0 (k, a), FAMILY f1 (b),
+  INDEX a_idx (a)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 10, 100), (2, 20, 200)`)
+	// Only the second family of the first row is updated, so the timestamp of
+	// the row in the primary index is the timestamp of that family.
+	sqlDB.Exec(t, `UPDATE t SET b = 101 WHERE k = 1`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	for _, indexName := range []string{"t_pkey", "a_idx"} {
+		index, err := catalog.MustFindIndexByName(table, indexName)
+		require.NoError(t, err)
+		fetchColumnIDs := columnIDsByName(t, table, "k", "a")
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+			&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs,
+			rowenc.IndexFetchSpecOptions{WithMVCCTimestamp: true},
+		))
+		require.Len(t, fetchColumnIDs, 2, "the caller's slice must not be modified")
+		require.Len(t, spec.FetchedColumns, 3)
+		tsCol := &spec.FetchedColumns[2]
+		require.Equal(t, colinfo.MVCCTimestampColumnID, tsCol.ColumnID)
+		require.True(t, tsCol.IsSystemColumn)
+		require.Equal(t, types.Decimal, tsCol.Type)
+		// The timestamp depends on all the KVs of the row.
+		require.Equal(t, uint32(table.IndexKeysPerRow(index)), spec.MaxKeysPerRow)
+
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+		rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+		expected := sqlDB.QueryStr(t, fmt.Sprintf(
+			`SELECT k, a, crdb_internal_mvcc_timestamp FROM t@%s ORDER BY k`, indexName,
+		))
+		require.Len(t, rows, len(expected))
+		for i := range rows {
+			require.Equal(t, expected[i][2], rows[i][2].String(), indexName)
+		}
+	}
+	// The values differ between the indexes since the update only rewrote the
+	// primary index KV of the second family.
+	tsByIndex := sqlDB.QueryStr(t, `SELECT (SELECT crdb_internal_mvcc_timestamp FROM t@t_pkey WHERE k = 1) >
+  (SELECT crdb_internal_mvcc_timestamp FROM t@a_idx WHERE k = 1)`)
+	require.Equal(t, [][]string{{"true"}}, tsByIndex)
+
+	// The MVCC timestamp column can't be requested twice.
+	var spec fetchpb.IndexFetchSpec
+	require.ErrorContains(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(),
+		[]descpb.ColumnID{colinfo.MVCCTimestampColumnID},
+		rowenc.IndexFetchSpecOptions{WithMVCCTimestamp: true},
+	), "already a fetch column")
+}
+
+func TestIndexFetchSpecLayoutVersion(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY, a INT, b INT,
+  INDEX a_idx (a),
+  INDEX ab_idx (a) STORING (b)
+)`)
+	// tokens returns the tokens of the primary index, a_idx and ab_idx, in this
+	// order (by index ID, since the indexes might have been renamed).
+	tokens := func(table catalog.TableDescriptor) []uint64 {
+		var res []uint64
+		for _, index := range table.ActiveIndexes() {
+			token := rowenc.IndexFetchSpecLayoutVersion(table, index)
+			require.NotZero(t, token)
+			res = append(res, token)
+		}
+		require.Len(t, res, 3)
+		return res
+	}
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	orig := tokens(table)
+	require.Equal(t, orig, tokens(table))
+	// The layouts of the two secondary indexes differ by the stored column.
+	require.NotEqual(t, orig[1], orig[2])
+
+	// Renames don't change the layout.
+	sqlDB.Exec(t, `ALTER TABLE t RENAME COLUMN b TO bb`)
+	sqlDB.Exec(t, `ALTER INDEX t@a_idx RENAME TO a_idx2`)
+	sqlDB.Exec(t, `ALTER TABLE t RENAME TO u`)
+	table = desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "u")
+	require.Equal(t, orig, tokens(table))
+
+	// Adding a stored column to a_idx changes its layout.
+	mut := tabledesc.NewBuilder(table.TableDesc()).BuildExistingMutableTable()
+	for i := range mut.Indexes {
+		if mut.Indexes[i].Name == "a_idx2" {
+			mut.Indexes[i].StoreColumnIDs = columnIDsByName(t, table, "bb")
+			mut.Indexes[i].StoreColumnNames = []string{"bb"}
+		}
+	}
+	withStored := tokens(mut.ImmutableCopy().(catalog.TableDescriptor))
+	require.Equal(t, orig[0], withStored[0])
+	require.NotEqual(t, orig[1], withStored[1])
+	require.Equal(t, orig[2], withStored[2])
+
+	// Adding a column adds a stored column to the primary index, but doesn't
+	// change the secondary indexes.
+	sqlDB.Exec(t, `ALTER TABLE u ADD COLUMN c INT`)
+	table = desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "u")
+	afterAdd := tokens(table)
+	require.NotEqual(t, orig[0], afterAdd[0])
+	require.Equal(t, orig[1:], afterAdd[1:])
+}
+
+func TestInitIndexFetchSpecArrayColumns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  ia INT[],
+  sa STRING[],
+  INDEX sa_idx (sa) STORING (ia)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES
+  (1, ARRAY[1, NULL, 3], ARRAY['a', 'b']),
+  (2, ARRAY[], ARRAY[NULL, 'c']),
+  (3, NULL, NULL)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	fetchColumnIDs := columnIDsByName(t, table, "k", "ia", "sa")
+
+	for _, index := range table.ActiveIndexes() {
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs,
+		))
+		require.Equal(t, types.Int, spec.FetchedColumns[1].Type.ArrayContents())
+		require.Equal(t, types.String, spec.FetchedColumns[2].Type.ArrayContents())
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+		rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+		var res []string
+		for i := range rows {
+			res = append(res, tree.AsString(&rows[i]))
+		}
+		sort.Strings(res)
+		require.Equal(t, []string{
+			`(1, ARRAY[1,NULL,3], ARRAY['a','b'])`,
+			`(2, ARRAY[], ARRAY[NULL,'c'])`,
+			`(3, NULL, NULL)`,
+		}, res, index.GetName())
+	}
+
+	// An array type without its element type can't be decoded.
+	mut := tabledesc.NewBuilder(table.TableDesc()).BuildExistingMutableTable()
+	mut.Columns[1].Type = &types.T{InternalType: types.InternalType{
+		Family: types.ArrayFamily, Oid: oid.T__int8,
+	}}
+	corrupt := mut.ImmutableCopy().(catalog.TableDescriptor)
+	var spec fetchpb.IndexFetchSpec
+	require.ErrorContains(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, corrupt, corrupt.GetPrimaryIndex(), fetchColumnIDs,
+	), "column ia of table t: array type with OID 1016 has no element type")
+}
+
+// TestIndexFetchSpecFamilyDefaultColumnsRequired verifies that the values of
+// the families with a default column can't be decoded without
+// FamilyDefaultColumns, since the single column encoding is chosen when the
+// values are written.
+func TestIndexFetchSpecFamilyDefaultColumnsRequired(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(ctx)
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (k INT PRIMARY KEY, a INT, b INT, FAMILY f0 (k, a), FAMILY f1 (b))`)
+	sqlDB.Exec(t, `CREATE TABLE u (k INT PRIMARY KEY, a INT, b INT, c INT, FAMILY f0 (k, a), FAMILY f1 (b, c))`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 10, 100)`)
+	sqlDB.Exec(t, `INSERT INTO u VALUES (1, 10, 100, 1000)`)
+
+	for _, tc := range []struct {
+		table    string
+		expected string
+	}{
+		// f1 has a default column, whose value is encoded without its column ID.
+		{table: "t", expected: "(1, 10, 100)"},
+		// f1 has no default column, so its value is encoded as a tuple.
+		{table: "u", expected: "(1, 10, 100, 1000)"},
+	} {
+		table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", tc.table)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpecAllColumns(
+			&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(),
+		))
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), table.GetPrimaryIndexID()))
+		spans := roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}}
+		rows := fetchRows(t, kvDB, &spec, spans)
+		require.Len(t, rows, 1)
+		require.Equal(t, tc.expected, tree.AsString(&rows[0]))
+
+		spec.FamilyDefaultColumns = nil
+		var rf row.Fetcher
+		require.NoError(t, rf.Init(ctx, row.FetcherInitArgs{
+			Txn:   kvDB.NewTxn(ctx, "fetch-rows"),
+			Alloc: &tree.DatumAlloc{},
+			Spec:  &spec,
+		}))
+		require.NoError(t, rf.StartScan(
+			ctx, spans, nil /* spanIDs */, rowinfra.NoBytesLimit, rowinfra.NoRowLimit,
+		))
+		datums, err := rf.NextRowDecoded(ctx)
+		if tc.table == "t" {
+			require.ErrorContains(t, err, "single entry value with no default column id")
+		} else {
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, tree.AsString(&datums))
+		}
+		rf.Close(ctx)
+	}
+}
+
+func TestInitIndexFetchSpecIndexVersion(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY, a INT, b INT, c INT,
+  FAMILY f0 (k, a), FAMILY f1 (b), FAMILY f2 (c),
+  INDEX a_idx (a) STORING (b, c)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	// Make a copy of the descriptor in which a_idx uses the original format,
+	// which encodes all the stored columns in a single KV.
+	mut := tabledesc.NewBuilder(table.TableDesc()).BuildExistingMutableTable()
+	for i := range mut.Indexes {
+		if mut.Indexes[i].Name == "a_idx" {
+			mut.Indexes[i].Version = descpb.BaseIndexFormatVersion
+		}
+	}
+	baseFormat := mut.ImmutableCopy().(catalog.TableDescriptor)
+
+	for _, tc := range []struct {
+		table                 catalog.TableDescriptor
+		expectedVersion       descpb.IndexDescriptorVersion
+		expectedMaxKeysPerRow uint32
+	}{
+		{table: table, expectedVersion: descpb.LatestIndexDescriptorVersion, expectedMaxKeysPerRow: 3},
+		{table: baseFormat, expectedVersion: descpb.BaseIndexFormatVersion, expectedMaxKeysPerRow: 1},
+	} {
+		index, err := catalog.MustFindIndexByName(tc.table, "a_idx")
+		require.NoError(t, err)
+		require.Equal(t, tc.expectedVersion, index.GetVersion())
+
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, tc.table, index, columnIDsByName(t, tc.table, "k", "a", "b", "c"),
+		))
+		require.Equal(t, uint32(tc.expectedVersion), spec.IndexVersion)
+		require.Equal(t, tc.expectedMaxKeysPerRow, spec.MaxKeysPerRow)
+
+		rowenctest.RoundTripWithFetchSpec(t, keys.SystemSQLCodec, tc.table, &spec, tree.Datums{
+			tree.NewDInt(1), tree.NewDInt(2), tree.NewDInt(3), tree.NewDInt(4),
+		})
+		rowenctest.RoundTripWithFetchSpec(t, keys.SystemSQLCodec, tc.table, &spec, tree.Datums{
+			tree.NewDInt(1), tree.NewDInt(2), tree.DNull, tree.NewDInt(4),
+		})
+	}
+}
+
+func TestInitIndexFetchSpecTemporaryIndex(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(ctx)
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY, a INT, b INT, c STRING,
+  FAMILY f0 (k, a, b), FAMILY f1 (c),
+  INDEX a_idx (a) STORING (b, c)
+)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	// Make a copy of the descriptor where a_idx is the (write-only) temporary
+	// index of an index backfill.
+	mut := tabledesc.NewBuilder(table.TableDesc()).BuildExistingMutableTable()
+	idxDesc := mut.Indexes[0]
+	idxDesc.UseDeletePreservingEncoding = true
+	mut.Indexes = nil
+	mut.Mutations = append(mut.Mutations, descpb.DescriptorMutation{
+		Descriptor_: &descpb.DescriptorMutation_Index{Index: &idxDesc},
+		State:       descpb.DescriptorMutation_WRITE_ONLY,
+		Direction:   descpb.DescriptorMutation_ADD,
+		MutationID:  1,
+	})
+	temp := mut.ImmutableCopy().(catalog.TableDescriptor)
+	index, err := catalog.MustFindIndexByName(temp, "a_idx")
+	require.NoError(t, err)
+	require.True(t, index.IsTemporaryIndexForBackfill())
+
+	fetchCols := columnIDsByName(t, temp, "k", "a", "b", "c")
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, temp, index, fetchCols))
+	require.True(t, spec.IsTemporaryIndex)
+
+	// The public index doesn't use the delete preserving encoding.
+	publicIdx, err := catalog.MustFindIndexByName(table, "a_idx")
+	require.NoError(t, err)
+	var publicSpec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(&publicSpec, keys.SystemSQLCodec, table, publicIdx, fetchCols))
+	require.False(t, publicSpec.IsTemporaryIndex)
+	require.Contains(t, rowenc.IndexFetchSpecsDiff(&spec, &publicSpec), "temporary index: true vs false")
+
+	// The initial version can't describe temporary indexes.
+	err = rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, temp, index, fetchCols,
+		rowenc.IndexFetchSpecOptions{TargetVersion: fetchpb.IndexFetchSpecVersionInitial},
+	)
+	require.ErrorContains(t, err, "doesn't support temporary index a_idx")
+	require.NoError(t, rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, temp, index, fetchCols))
+
+	var colMap catalog.TableColMap
+	for i, col := range temp.PublicColumns() {
+		colMap.Set(col.GetID(), i)
+	}
+	// encode returns the KVs of the temporary index for the given row; if
+	// deleted is set, the KVs are the delete markers written when the row is
+	// deleted (see row.RowHelper).
+	encode := func(datums tree.Datums, deleted bool) []roachpb.KeyValue {
+		entries, err := rowenc.EncodeSecondaryIndex(
+			keys.SystemSQLCodec, temp, index, colMap, datums, false, /* includeEmpty */
+		)
+		require.NoError(t, err)
+		kvs := make([]roachpb.KeyValue, len(entries))
+		for i := range entries {
+			kvs[i] = roachpb.KeyValue{Key: entries[i].Key, Value: entries[i].Value}
+			if deleted {
+				kvs[i].Value = roachpb.Value{}
+				require.NoError(t, kvs[i].Value.SetProto(&rowencpb.IndexValueWrapper{Deleted: true}))
+			}
+		}
+		return kvs
+	}
+	added := tree.Datums{tree.NewDInt(1), tree.NewDInt(10), tree.NewDInt(100), tree.NewDString("foo")}
+	deleted := tree.Datums{tree.NewDInt(2), tree.NewDInt(20), tree.NewDInt(200), tree.NewDString("bar")}
+	kvs := append(encode(added, false /* deleted */), encode(deleted, true /* deleted */)...)
+	// The entries are wrapped.
+	wrapper, err := rowenc.DecodeWrapper(&kvs[0].Value)
+	require.NoError(t, err)
+	require.False(t, wrapper.Deleted)
+
+	var rf row.Fetcher
+	require.NoError(t, rf.Init(ctx, row.FetcherInitArgs{
+		WillUseKVProvider: true,
+		Alloc:             &tree.DatumAlloc{},
+		Spec:              &spec,
+	}))
+	defer rf.Close(ctx)
+	require.NoError(t, rf.ConsumeKVProvider(ctx, &row.KVProvider{KVs: kvs}))
+
+	var res []string
+	for {
+		datums, err := rf.NextRowDecoded(ctx)
+		require.NoError(t, err)
+		if datums == nil {
+			break
+		}
+		res = append(res, fmt.Sprintf("%s deleted=%t", tree.AsString(&datums), rf.RowIsDeleted()))
+	}
+	require.Equal(t, []string{
+		"(1, 10, 100, 'foo') deleted=false",
+		// The key columns of a deleted entry are decoded from the key.
+		"(2, 20, NULL, NULL) deleted=true",
+	}, res)
+}
+
+func TestInitIndexFetchSpecIdentityColumns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  a INT GENERATED BY DEFAULT AS IDENTITY (START 10),
+  b INT
+)`)
+	sqlDB.Exec(t, `INSERT INTO t (b) VALUES (100), (200)`)
+	sqlDB.Exec(t, `INSERT INTO t (a, b) VALUES (5, 300)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), columnIDsByName(t, table, "k", "a", "b"),
+	))
+	var isIdentity []bool
+	for i := range spec.FetchedColumns {
+		isIdentity = append(isIdentity, spec.FetchedColumns[i].IsIdentity)
+	}
+	require.Equal(t, []bool{true, true, false}, isIdentity)
+	// The flag is only set for the fetched columns.
+	require.False(t, spec.KeyColumns()[0].IsIdentity)
+
+	// The identity columns are decoded like any other INT column.
+	rows := fetchRows(t, kvDB, &spec, roachpb.Spans{table.PrimaryIndexSpan(keys.SystemSQLCodec)})
+	var actual []string
+	for i := range rows {
+		actual = append(actual, tree.AsString(&rows[i]))
+	}
+	require.Equal(t, []string{"(1, 10, 100)", "(2, 11, 200)", "(3, 5, 300)"}, actual)
+
+	// The flag is not part of the initial version.
+	require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+		&spec, keys.SystemSQLCodec, table, table.GetPrimaryIndex(), columnIDsByName(t, table, "k", "a", "b"),
+		rowenc.IndexFetchSpecOptions{TargetVersion: fetchpb.IndexFetchSpecVersionInitial},
+	))
+	for i := range spec.FetchedColumns {
+		require.False(t, spec.FetchedColumns[i].IsIdentity)
+	}
+}
+
+func TestInitIndexFetchSpecOnUpdateColumns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  v INT,
+  u TIMESTAMPTZ DEFAULT '2023-01-01' ON UPDATE now(),
+  INDEX v_idx (v) STORING (u)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t (k, v) VALUES (1, 10)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	for _, indexName := range []string{"t_pkey", "v_idx"} {
+		index, err := catalog.MustFindIndexByName(table, indexName)
+		require.NoError(t, err)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(
+			&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k", "v", "u"),
+		))
+		var hasOnUpdate []bool
+		for i := range spec.FetchedColumns {
+			hasOnUpdate = append(hasOnUpdate, spec.FetchedColumns[i].HasOnUpdate)
+		}
+		require.Equal(t, []bool{false, false, true}, hasOnUpdate, indexName)
+
+		// The column is decoded like any other stored column.
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+		rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+		require.Len(t, rows, 1)
+		keyAndValue := rows[0][:2]
+		require.Equal(t, "(1, 10)", tree.AsString(&keyAndValue), indexName)
+		u, ok := rows[0][2].(*tree.DTimestampTZ)
+		require.True(t, ok, indexName)
+		require.True(t, u.Time.Equal(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)), indexName)
+
+		// The flag is not part of the initial version.
+		require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+			&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k", "v", "u"),
+			rowenc.IndexFetchSpecOptions{TargetVersion: fetchpb.IndexFetchSpecVersionInitial},
+		))
+		require.False(t, spec.FetchedColumns[2].HasOnUpdate)
+	}
+}
+
+func TestInitIndexFetchSpecInvisibleIndexes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (k INT PRIMARY KEY, a INT, b INT, c INT)`)
+	sqlDB.Exec(t, `CREATE INDEX a_idx ON t (a)`)
+	sqlDB.Exec(t, `CREATE INDEX b_idx ON t (b) NOT VISIBLE`)
+	sqlDB.Exec(t, `CREATE INDEX c_idx ON t (c) VISIBILITY 0.25`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 10, 20, 30), (2, 11, 21, 31)`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+
+	for _, tc := range []struct {
+		index        string
+		column       string
+		invisibility float64
+	}{
+		{index: "t_pkey", column: "a", invisibility: 0},
+		{index: "a_idx", column: "a", invisibility: 0},
+		{index: "b_idx", column: "b", invisibility: 1},
+		{index: "c_idx", column: "c", invisibility: 0.75},
+	} {
+		index, err := catalog.MustFindIndexByName(table, tc.index)
+		require.NoError(t, err)
+		require.Equal(t, tc.invisibility != 0, index.IsNotVisible(), tc.index)
+		fetchColumnIDs := columnIDsByName(t, table, "k", tc.column)
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs))
+		require.Equal(t, tc.invisibility, spec.Invisibility, tc.index)
+
+		// The invisibility doesn't affect decoding.
+		prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+		rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+		require.Len(t, rows, 2)
+
+		// The field is not part of the initial version.
+		require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+			&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs,
+			rowenc.IndexFetchSpecOptions{TargetVersion: fetchpb.IndexFetchSpecVersionInitial},
+		))
+		require.Zero(t, spec.Invisibility, tc.index)
+	}
+
+	// The invisible indexes can still be scanned when they are forced.
+	sqlDB.CheckQueryResults(t, `SELECT k, b FROM t@b_idx ORDER BY b`, [][]string{{"1", "20"}, {"2", "21"}})
+	sqlDB.CheckQueryResults(t, `SELECT k, c FROM t@c_idx ORDER BY c`, [][]string{{"1", "30"}, {"2", "31"}})
+
+	// Changing the visibility of the index is reflected in the spec.
+	sqlDB.Exec(t, `ALTER INDEX t@b_idx VISIBLE`)
+	table = desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	index, err := catalog.MustFindIndexByName(table, "b_idx")
+	require.NoError(t, err)
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k", "b"),
+	))
+	require.Zero(t, spec.Invisibility)
+}
+
+// TestInitIndexFetchSpecTypeModifiers verifies that the fetched column types
+// keep the type modifiers of the columns (the width of bit and string types,
+// the precision and scale of decimals, the precision of timestamps), including
+// for array element types, both in the spec and after sending it to another
+// node, so that the decoded datums have the declared dimensions.
+func TestInitIndexFetchSpecTypeModifiers(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k BIT(3) PRIMARY KEY,
+  d DECIMAL(10, 2),
+  vc VARCHAR(3)[],
+  ts TIMESTAMP(3),
+  INDEX d_idx (d) STORING (vc, ts)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (B'101', 1.5, ARRAY['ab', 'abc'], '2023-01-02 03:04:05.678')`)
+	table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", "t")
+	secondary, err := catalog.MustFindIndexByName(table, "d_idx")
+	require.NoError(t, err)
+
+	for _, index := range []catalog.Index{table.GetPrimaryIndex(), secondary} {
+		fetchColumnIDs := columnIDsByName(t, table, "k", "d", "vc", "ts")
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs))
+		data, err := protoutil.Marshal(&spec)
+		require.NoError(t, err)
+		var remote fetchpb.IndexFetchSpec
+		require.NoError(t, protoutil.Unmarshal(data, &remote))
+
+		for _, s := range []*fetchpb.IndexFetchSpec{&spec, &remote} {
+			for i, colID := range fetchColumnIDs {
+				col, err := catalog.MustFindColumnByID(table, colID)
+				require.NoError(t, err)
+				typ := s.FetchedColumns[i].Type
+				require.True(t, typ.Identical(col.GetType()), "%s: %s", col.GetName(), typ.SQLString())
+			}
+			require.Equal(t, "BIT(3)", s.FetchedColumns[0].Type.SQLString())
+			require.Equal(t, "DECIMAL(10,2)", s.FetchedColumns[1].Type.SQLString())
+			require.Equal(t, "VARCHAR(3)[]", s.FetchedColumns[2].Type.SQLString())
+			require.Equal(t, "TIMESTAMP(3)", s.FetchedColumns[3].Type.SQLString())
+
+			prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+			rows := fetchRows(t, kvDB, s, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+			require.Len(t, rows, 1)
+			require.Equal(t, uint(3), tree.MustBeDBitArray(rows[0][0]).BitLen())
+			require.Equal(t, int32(-2), rows[0][1].(*tree.DDecimal).Exponent)
+			require.Equal(t, tree.Datums{tree.NewDString("ab"), tree.NewDString("abc")}, rows[0][2].(*tree.DArray).Array)
+			require.True(t, rows[0][3].(*tree.DTimestamp).Time.Equal(time.Date(2023, 1, 2, 3, 4, 5, 678000000, time.UTC)))
+		}
+	}
+}
+
+func TestInitIndexFetchSpecTTLExpirationColumn(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(context.Background())
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TABLE t_after (k INT PRIMARY KEY, v INT, INDEX v_idx (v)) WITH (ttl_expire_after = '10 days')`)
+	sqlDB.Exec(t, `CREATE TABLE t_expr (
+  k INT PRIMARY KEY,
+  expire_at TIMESTAMPTZ,
+  INDEX expire_idx (expire_at)
+) WITH (ttl_expiration_expression = 'expire_at')`)
+	sqlDB.Exec(t, `CREATE TABLE t_computed (
+  k INT PRIMARY KEY,
+  ts TIMESTAMPTZ
+) WITH (ttl_expiration_expression = '(ts + ''1 day'':::INTERVAL)')`)
+	sqlDB.Exec(t, `CREATE TABLE t_none (k INT PRIMARY KEY, ts TIMESTAMPTZ)`)
+	expiration := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	sqlDB.Exec(t, `INSERT INTO t_after VALUES (1, 10)`)
+	sqlDB.Exec(t, `UPDATE t_after SET crdb_internal_expiration = $1`, expiration)
+	sqlDB.Exec(t, `INSERT INTO t_expr VALUES (1, $1)`, expiration)
+
+	for _, tc := range []struct {
+		table     string
+		index     string
+		ttlColumn string
+		err       string
+	}{
+		{table: "t_after", ttlColumn: catpb.TTLDefaultExpirationColumnName},
+		{table: "t_after", index: "v_idx", ttlColumn: catpb.TTLDefaultExpirationColumnName, err: "not in index"},
+		{table: "t_expr", ttlColumn: "expire_at"},
+		{table: "t_expr", index: "expire_idx", ttlColumn: "expire_at"},
+		{table: "t_computed"},
+		{table: "t_none"},
+	} {
+		t.Run(fmt.Sprintf("%s/%s", tc.table, tc.index), func(t *testing.T) {
+			table := desctestutils.TestingGetPublicTableDescriptor(kvDB, keys.SystemSQLCodec, "defaultdb", tc.table)
+			index := table.GetPrimaryIndex()
+			if tc.index != "" {
+				var err error
+				index, err = catalog.MustFindIndexByName(table, tc.index)
+				require.NoError(t, err)
+			}
+			opts := rowenc.IndexFetchSpecOptions{IncludeTTLExpirationColumn: true}
+			var spec fetchpb.IndexFetchSpec
+			if tc.ttlColumn == "" {
+				require.NoError(t, rowenc.InitIndexFetchSpecWithOptions(
+					&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k"), opts,
+				))
+				require.Zero(t, spec.TTLExpirationColumnID)
+				return
+			}
+
+			fetchColumnIDs := columnIDsByName(t, table, "k", tc.ttlColumn)
+			err := rowenc.InitIndexFetchSpecWithOptions(&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs, opts)
+			if tc.err != "" {
+				if buildutil.CrdbTestBuild {
+					require.ErrorContains(t, err, tc.err)
+				} else {
+					require.NoError(t, err)
+				}
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, fetchColumnIDs[1], spec.TTLExpirationColumnID)
+			require.Contains(t, rowenc.FormatIndexFetchSpec(&spec), fmt.Sprintf("row-level TTL (expiration column %d)", fetchColumnIDs[1]))
+
+			// The TTL expiration column is only set on request, and the initial
+			// version doesn't support it.
+			var otherSpec fetchpb.IndexFetchSpec
+			require.NoError(t, rowenc.InitIndexFetchSpec(
+				&otherSpec, keys.SystemSQLCodec, table, index, fetchColumnIDs,
+			))
+			require.Zero(t, otherSpec.TTLExpirationColumnID)
+			require.ErrorContains(t, rowenc.InitIndexFetchSpecWithOptions(
+				&otherSpec, keys.SystemSQLCodec, table, index, fetchColumnIDs,
+				rowenc.IndexFetchSpecOptions{
+					IncludeTTLExpirationColumn: true,
+					TargetVersion:              fetchpb.IndexFetchSpecVersionInitial,
+				},
+			), "doesn't support the requested optional fields")
+
+			prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+			rows := fetchRows(t, kvDB, &spec, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}})
+			require.Len(t, rows, 1)
+			require.Equal(t, types.TimestampTZFamily, spec.FetchedColumns[1].Type.Family())
+			ts, ok := rows[0][1].(*tree.DTimestampTZ)
+			require.True(t, ok, "%T", rows[0][1])
+			require.True(t, ts.Time.Equal(expiration))
+		})
+	}
+}
+
+func TestRehydrateIndexFetchSpec(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	srv, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
+	defer srv.Stopper().Stop(ctx)
+
+	sqlDB := sqlutils.MakeSQLRunner(db)
+	sqlDB.Exec(t, `CREATE TYPE greeting AS ENUM ('hello', 'howdy', 'hi')`)
+	sqlDB.Exec(t, `CREATE TABLE t (
+  k INT PRIMARY KEY,
+  g greeting,
+  j JSONB,
+  INDEX g_idx (g),
+  INVERTED INDEX j_idx (j)
+)`)
+	sqlDB.Exec(t, `INSERT INTO t VALUES (1, 'howdy', '{"a": 1}'), (2, 'hi', NULL)`)
+	table := hydratedTableDescriptor(t, srv, kvDB, "t")
+
+	rehydrate := func(spec *fetchpb.IndexFetchSpec) error {
+		return sql.TestingDescsTxn(ctx, srv,
+			func(ctx context.Context, txn isql.Txn, col *descs.Collection) error {
+				resolver := descs.NewDistSQLTypeResolver(col, txn.KV())
+				return rowenc.RehydrateIndexFetchSpec(ctx, spec, &resolver)
+			},
+		)
+	}
+	// roundTrip returns a copy of the spec as received by a remote node, with
+	// the types missing their metadata.
+	roundTrip := func(spec *fetchpb.IndexFetchSpec) *fetchpb.IndexFetchSpec {
+		data, err := protoutil.Marshal(spec)
+		require.NoError(t, err)
+		var remote fetchpb.IndexFetchSpec
+		require.NoError(t, protoutil.Unmarshal(data, &remote))
+		return &remote
+	}
+
+	index, err := catalog.MustFindIndexByName(table, "g_idx")
+	require.NoError(t, err)
+	var spec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&spec, keys.SystemSQLCodec, table, index, columnIDsByName(t, table, "k", "g"),
+	))
+	remote := roundTrip(&spec)
+	require.False(t, remote.FetchedColumns[1].Type.IsHydrated())
+	require.NoError(t, rehydrate(remote))
+	require.True(t, remote.FetchedColumns[1].Type.IsHydrated())
+	require.True(t, rowenc.IndexFetchSpecsCompatible(&spec, remote))
+
+	prefix := roachpb.Key(rowenc.MakeIndexKeyPrefix(keys.SystemSQLCodec, table.GetID(), index.GetID()))
+	var res []string
+	for _, row := range fetchRows(t, kvDB, remote, roachpb.Spans{{Key: prefix, EndKey: prefix.PrefixEnd()}}) {
+		res = append(res, tree.AsString(&row))
+	}
+	require.Equal(t, []string{`(1, 'howdy')`, `(2, 'hi')`}, res)
+
+	invIndex, err := catalog.MustFindIndexByName(table, "j_idx")
+	require.NoError(t, err)
+	var invSpec fetchpb.IndexFetchSpec
+	require.NoError(t, rowenc.InitIndexFetchSpec(
+		&invSpec, keys.SystemSQLCodec, table, invIndex, columnIDsByName(t, table, "k"),
+	))
+	require.NoError(t, rehydrate(roundTrip(&invSpec)))
+
+	for _, tc := range []struct {
+		spec     *fetchpb.IndexFetchSpec
+		corrupt  func(s *fetchpb.IndexFetchSpec)
+		expected string
+	}{
+		{
+			spec:     &spec,
+			corrupt:  func(s *fetchpb.IndexFetchSpec) { s.Version = 0 },
+			expected: "unsupported IndexFetchSpec version 0",
+		},
+		{
+			spec:     &spec,
+			corrupt:  func(s *fetchpb.IndexFetchSpec) { s.MaxKeysPerRow = 0 },
+			expected: "invalid max keys per row 0",
+		},
+		{
+			spec:     &spec,
+			corrupt:  func(s *fetchpb.IndexFetchSpec) { s.KeyPrefixLength = 0 },
+			expected: "missing key prefix length",
+		},
+		{
+			spec:     &spec,
+			corrupt:  func(s *fetchpb.IndexFetchSpec) { s.NumKeySuffixColumns = 3 },
+			expected: "3 key suffix columns but only 2 key and suffix columns",
+		},
+		{
+			spec:     &spec,
+			corrupt:  func(s *fetchpb.IndexFetchSpec) { s.FetchedColumns[1].Type = nil },
+			expected: "fetched column g (2) has no type",
+		},
+		{
+			spec:     &spec,
+			corrupt:  func(s *fetchpb.IndexFetchSpec) { s.ColumnToOutputIdx = []int32{0} },
+			expected: "column to output mapping has 1 entries for 2 fetched columns",
+		},
+		{
+			spec:     &invSpec,
+			corrupt:  func(s *fetchpb.IndexFetchSpec) { s.KeyAndSuffixColumns[0].Type = nil },
+			expected: "key column j (3) has no type",
+		},
+		{
+			spec:     &invSpec,
+			corrupt:  func(s *fetchpb.IndexFetchSpec) { s.KeyAndSuffixColumns[0].Type = types.Jsonb },
+			expected: "inverted column j (3) has type JSONB instead of the encoded key type",
+		},
+	} {
+		remote := roundTrip(tc.spec)
+		tc.corrupt(remote)
+		err := rehydrate(remote)
+		require.ErrorContains(t, err, tc.expected)
+		require.ErrorContains(t, err, fmt.Sprintf("index %s of table t", tc.spec.IndexName))
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+// Package rowenctest contains test utilities for verifying that rows encoded
+// into an index can be decoded back using an IndexFetchSpec.
+package rowenctest
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/catenumpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/colinfo"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/fetchpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/tabledesc"
+	"github.com/cockroachdb/cockroach/pkg/sql/randgen"
+	"github.com/cockroachdb/cockroach/pkg/sql/row"
+	"github.com/cockroachdb/cockroach/pkg/sql/rowenc"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/util/randutil"
+	"github.com/stretchr/testify/require"
+)
+
+// RoundTripWithFetchSpec encodes the given row into the index for which the
+// spec was initialized, decodes the resulting KVs with a row.Fetcher using the
+// spec, and verifies that every fetched column decodes to its value in the row.
+//
+// The datums must contain a value for each public column of the table, in the
+// order of table.PublicColumns(); values of virtual computed columns must be
+// consistent with the other values. The table descriptor and the codec are
+// needed to encode the row, since the spec only describes how to decode it.
+//
+// The values are compared using their string representation, which catches
+// differences that are not visible to Compare (e.g. the scale of a decimal, or
+// the locale of a collated string); this matters for composite types, where
+// the key encoding alone doesn't contain the full value. The inverted key of an
+// inverted index is not verified since it doesn't decode to the original
+// value.
+func RoundTripWithFetchSpec(
+	t testing.TB,
+	codec keys.SQLCodec,
+	table catalog.TableDescriptor,
+	spec *fetchpb.IndexFetchSpec,
+	datums tree.Datums,
+) {
+	t.Helper()
+	ctx := context.Background()
+
+	index, err := catalog.MustFindIndexByID(table, spec.IndexID)
+	require.NoError(t, err)
+	var colMap catalog.TableColMap
+	for i, col := range table.PublicColumns() {
+		colMap.Set(col.GetID(), i)
+	}
+	require.Len(t, datums, colMap.Len(), "expected one value per public column")
+
+	var entries []rowenc.IndexEntry
+	if index.Primary() {
+		entries, err = rowenc.EncodePrimaryIndex(codec, table, index, colMap, datums, false /* includeEmpty */)
+	} else {
+		entries, err = rowenc.EncodeSecondaryIndex(codec, table, index, colMap, datums, false /* includeEmpty */)
+	}
+	require.NoError(t, err)
+	kvs := make([]roachpb.KeyValue, len(entries))
+	for i := range entries {
+		kvs[i] = roachpb.KeyValue{Key: entries[i].Key, Value: entries[i].Value}
+	}
+	// The fetcher expects the KVs in key order (which might not be the case for
+	// the keys of an inverted index).
+	sort.Slice(kvs, func(i, j int) bool {
+		return kvs[i].Key.Compare(kvs[j].Key) < 0
+	})
+
+	var rf row.Fetcher
+	require.NoError(t, rf.Init(ctx, row.FetcherInitArgs{
+		WillUseKVProvider: true,
+		Alloc:             &tree.DatumAlloc{},
+		Spec:              spec,
+	}))
+	defer rf.Close(ctx)
+	require.NoError(t, rf.ConsumeKVProvider(ctx, &row.KVProvider{KVs: kvs}))
+
+	numRows := 0
+	for {
+		decoded, err := rf.NextRowDecoded(ctx)
+		require.NoError(t, err)
+		if decoded == nil {
+			break
+		}
+		numRows++
+		require.Len(t, decoded, len(spec.FetchedColumns))
+		for i := range spec.FetchedColumns {
+			col := &spec.FetchedColumns[i]
+			if col.Type.Family() == types.EncodedKeyFamily {
+				continue
+			}
+			ord, ok := colMap.Get(col.ColumnID)
+			require.Truef(t, ok, "fetched column %s is not a public column", col.Name)
+			require.Equalf(
+				t, datums[ord].String(), decoded[i].String(),
+				"column %s of index %s", col.Name, spec.IndexName,
+			)
+		}
+	}
+	// Each row corresponds to a single key in forward indexes; inverted indexes
+	// can have any number of keys per row.
+	if index.GetType() != descpb.IndexDescriptor_INVERTED {
+		require.Equalf(t, 1, numRows, "expected exactly one row from index %s", spec.IndexName)
+	}
+}
+
+// numRandomDatums is the number of random (non-NULL) values of the type which
+// VerifyTypeRoundTrip encodes, in addition to NULL.
+const numRandomDatums = 10
+
+// VerifyTypeRoundTrip verifies that values of the given type can be decoded
+// using an IndexFetchSpec from each of the placements a column can have in an
+// index: as a stored (value-encoded) column of the primary index and of a
+// secondary index, and, if the type is indexable, as an ascending or
+// descending key column of a secondary index (with a composite value, if the
+// type can have a composite key encoding).
+//
+// The values are NULL and some random values of the type; the seed is logged
+// if the verification fails.
+func VerifyTypeRoundTrip(t testing.TB, typ *types.T) {
+	t.Helper()
+	rng, seed := randutil.NewTestRand()
+	defer func() {
+		if t.Failed() {
+			t.Logf("type %s, random seed: %d", typ.SQLString(), seed)
+		}
+	}()
+
+	table := makeRoundTripTable(typ)
+	datums := []tree.Datum{tree.DNull}
+	for i := 0; i < numRandomDatums; i++ {
+		datums = append(datums, randgen.RandDatum(rng, typ, false /* nullOk */))
+	}
+	fetchColumnIDs := []descpb.ColumnID{1, 2}
+	for _, index := range table.ActiveIndexes() {
+		var spec fetchpb.IndexFetchSpec
+		require.NoError(t, rowenc.InitIndexFetchSpec(&spec, keys.SystemSQLCodec, table, index, fetchColumnIDs))
+		for i, d := range datums {
+			RoundTripWithFetchSpec(
+				t, keys.SystemSQLCodec, table, &spec, tree.Datums{tree.NewDInt(tree.DInt(i)), d},
+			)
+		}
+	}
+}
+
+// makeRoundTripTable returns the descriptor of the following table, where the
+// v_asc and v_desc indexes only exist if the type is indexable:
+//
+//	CREATE TABLE t (
+//	  k INT PRIMARY KEY,
+//	  v <typ>,
+//	  INDEX k_storing_v (k) STORING (v),
+//	  INDEX v_asc (v ASC),
+//	  INDEX v_desc (v DESC)
+//	)
+func makeRoundTripTable(typ *types.T) catalog.TableDescriptor {
+	indexes := []descpb.IndexDescriptor{{
+		ID:                  2,
+		Name:                "k_storing_v",
+		KeyColumnIDs:        []descpb.ColumnID{1},
+		KeyColumnNames:      []string{"k"},
+		KeyColumnDirections: []catenumpb.IndexColumn_Direction{catenumpb.IndexColumn_ASC},
+		StoreColumnIDs:      []descpb.ColumnID{2},
+		StoreColumnNames:    []string{"v"},
+		Version:             descpb.LatestIndexDescriptorVersion,
+	}}
+	if colinfo.ColumnTypeIsIndexable(typ) {
+		var compositeColumnIDs []descpb.ColumnID
+		if colinfo.CanHaveCompositeKeyEncoding(typ) {
+			compositeColumnIDs = []descpb.ColumnID{2}
+		}
+		for _, dir := range []catenumpb.IndexColumn_Direction{catenumpb.IndexColumn_ASC, catenumpb.IndexColumn_DESC} {
+			indexes = append(indexes, descpb.IndexDescriptor{
+				ID:                  descpb.IndexID(len(indexes) + 2),
+				Name:                "v_" + strings.ToLower(dir.String()),
+				KeyColumnIDs:        []descpb.ColumnID{2},
+				KeyColumnNames:      []string{"v"},
+				KeyColumnDirections: []catenumpb.IndexColumn_Direction{dir},
+				KeySuffixColumnIDs:  []descpb.ColumnID{1},
+				CompositeColumnIDs:  compositeColumnIDs,
+				Version:             descpb.LatestIndexDescriptorVersion,
+			})
+		}
+	}
+	tableDesc := descpb.TableDescriptor{
+		ID:   100,
+		Name: "t",
+		Columns: []descpb.ColumnDescriptor{
+			{ID: 1, Name: "k", Type: types.Int},
+			{ID: 2, Name: "v", Type: typ, Nullable: true},
+		},
+		NextColumnID: 3,
+		Families: []descpb.ColumnFamilyDescriptor{{
+			ID:          0,
+			Name:        "primary",
+			ColumnIDs:   []descpb.ColumnID{1, 2},
+			ColumnNames: []string{"k", "v"},
+		}},
+		NextFamilyID: 1,
+		PrimaryIndex: descpb.IndexDescriptor{
+			ID:                  1,
+			Name:                "t_pkey",
+			Unique:              true,
+			KeyColumnIDs:        []descpb.ColumnID{1},
+			KeyColumnNames:      []string{"k"},
+			KeyColumnDirections: []catenumpb.IndexColumn_Direction{catenumpb.IndexColumn_ASC},
+			StoreColumnIDs:      []descpb.ColumnID{2},
+			StoreColumnNames:    []string{"v"},
+			EncodingType:        catenumpb.PrimaryIndexEncoding,
+			Version:             descpb.LatestIndexDescriptorVersion,
+		},
+		Indexes:     indexes,
+		NextIndexID: descpb.IndexID(len(indexes) + 2),
+	}
+	return tabledesc.NewBuilder(&tableDesc).BuildImmutableTable()
+}
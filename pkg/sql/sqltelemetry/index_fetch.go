@@ -0,0 +1,29 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package sqltelemetry
+
+import "github.com/cockroachdb/cockroach/pkg/server/telemetry"
+
+// IndexFetchInvertedCounter is to be incremented every time a fetcher
+// starts a scan of an inverted index.
+var IndexFetchInvertedCounter = telemetry.GetCounterOnce("sql.index_fetch.inverted")
+
+// IndexFetchPartialCounter is to be incremented every time a fetcher
+// starts a scan of a partial index.
+var IndexFetchPartialCounter = telemetry.GetCounterOnce("sql.index_fetch.partial")
+
+// IndexFetchCompositeCounter is to be incremented every time a fetcher
+// starts a scan of an index with composite key columns.
+var IndexFetchCompositeCounter = telemetry.GetCounterOnce("sql.index_fetch.composite")
+
+// IndexFetchMultiFamilyCounter is to be incremented every time a fetcher
+// starts a scan of an index which can have more than one KV per row.
+var IndexFetchMultiFamilyCounter = telemetry.GetCounterOnce("sql.index_fetch.multi_family")